@@ -1,6 +1,7 @@
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -17,13 +18,199 @@ var (
 	AddToScheme   = SchemeBuilder.AddToScheme
 )
 
+const (
+	// AnnotationExtend pushes the expiry forward by the given Go duration (e.g. "2h").
+	// The operator consumes the annotation and removes it once applied.
+	AnnotationExtend = "fgtech.io/extend"
+	// AnnotationLastActivity carries the RFC3339 timestamp of the last activity
+	// reported by an instance. It is used by idle mode when no heartbeat path is set.
+	AnnotationLastActivity = "fgtech.io/last-activity"
+	// AnnotationMaxLifetime is read from the Namespace and bounds the lifetime
+	// (TTL plus extensions) of every Fgtech it contains.
+	AnnotationMaxLifetime = "fgtech.io/max-lifetime"
+	// AnnotationExpiryPolicy is read from the Namespace and sets the expiry
+	// policy of Fgtech resources that do not declare spec.expiryPolicy.
+	AnnotationExpiryPolicy = "fgtech.io/expiry-policy"
+	// AnnotationSchedule is read from the Namespace and holds the JSON encoded
+	// ScheduleSpec applied to Fgtech resources without spec.schedule.
+	AnnotationSchedule = "fgtech.io/schedule"
+	// AnnotationWake brings a hibernated or archived Fgtech back with a fresh TTL.
+	// The operator consumes the annotation and removes it once applied.
+	AnnotationWake = "fgtech.io/wake"
+	// AnnotationDefaultClass set to "true" on a FgtechClass makes it apply to
+	// every Fgtech without spec.className.
+	AnnotationDefaultClass = "fgtech.io/is-default-class"
+	// AnnotationPaused set to "true" stops the operator from touching the
+	// Fgtech, its workload and its expiry until removed.
+	AnnotationPaused = "fgtech.io/paused"
+	// AnnotationRestartedAt carries a timestamp; each new value recreates the
+	// Pod once. It is copied on the Pod, like kubectl rollout restart does.
+	AnnotationRestartedAt = "fgtech.io/restartedAt"
+)
+
+// FinalizerCleanup orders the teardown of a Fgtech: route removal, optional
+// pre-delete hook, then workload deletion.
+const FinalizerCleanup = "fgtech.io/cleanup"
+
+// Expiry policies applied when a Fgtech reaches its expiry.
+const (
+	// ExpiryPolicyDelete removes the workload and the Fgtech itself.
+	ExpiryPolicyDelete = "delete"
+	// ExpiryPolicyHibernate removes the Pod, keeps the Service and the Fgtech, and
+	// routes the path to the default backend wake-up page.
+	ExpiryPolicyHibernate = "hibernate"
+	// ExpiryPolicyArchive removes the Pod, the Service and the route but keeps the Fgtech.
+	ExpiryPolicyArchive = "archive"
+)
+
+// Phases reported in FgtechStatus.Phase.
+const (
+	PhaseRunning    = "Running"
+	PhaseHibernated = "Hibernated"
+	PhaseArchived   = "Archived"
+	// PhaseScaledDown means the workload is stopped outside its schedule windows.
+	PhaseScaledDown = "ScaledDown"
+)
+
+// Pre-delete hook phases reported in PreDeleteStatus.Phase.
+const (
+	PreDeleteRunning   = "Running"
+	PreDeleteRetrying  = "Retrying"
+	PreDeleteSucceeded = "Succeeded"
+	PreDeleteFailed    = "Failed"
+)
+
+// Condition types reported in FgtechStatus.Conditions.
+const (
+	// ConditionExpiringSoon is True once a configured warning threshold before expiry is crossed.
+	ConditionExpiringSoon = "ExpiringSoon"
+	// ConditionPodHealthy reflects the health of the workload Pod: True when
+	// Ready, False with the failure reason (ErrImagePull, CrashLoopBackOff,
+	// OOMKilled, Evicted...), Unknown while starting.
+	ConditionPodHealthy = "PodHealthy"
+	// ConditionTemplateRendered reports whether spec.templateRef renders;
+	// False with TemplateNotFound or InvalidParameters otherwise.
+	ConditionTemplateRendered = "TemplateRendered"
+	// ConditionPaused is True while AnnotationPaused is set.
+	ConditionPaused = "Paused"
+)
+
 // FgtechSpec defines the desired state of Fgtech
 type FgtechSpec struct {
-	Version        string `json:"version"`
-	Image          string `json:"image"`
-	ExtraPath      string `json:"extrapath,omitempty"`
-	TTLSeconds     *int64 `json:"ttlSeconds,omitempty"`
-	ServiceAccount string `json:"serviceaccount,omitempty"`
+	Version        string    `json:"version"`
+	Image          string    `json:"image"`
+	ExtraPath      string    `json:"extrapath,omitempty"`
+	TTLSeconds     *int64    `json:"ttlSeconds,omitempty"`
+	ServiceAccount string    `json:"serviceaccount,omitempty"`
+	Idle           *IdleSpec `json:"idle,omitempty"`
+	// ClassName references the FgtechClass providing defaults and placement.
+	// When empty, the class annotated as default applies, if any.
+	ClassName string `json:"className,omitempty"`
+	// ExpiryPolicy is one of delete, hibernate or archive. When empty, the
+	// namespace annotation then the operator default apply.
+	ExpiryPolicy string `json:"expiryPolicy,omitempty"`
+	// Schedule restricts the hours during which the workload runs. When nil,
+	// the namespace default schedule applies, if any.
+	Schedule *ScheduleSpec `json:"schedule,omitempty"`
+	// PreDelete runs once the route is removed and before the workload is deleted.
+	PreDelete *PreDeleteHook `json:"preDelete,omitempty"`
+	// Command replaces the image entrypoint.
+	Command        []string             `json:"command,omitempty"`
+	Env            []corev1.EnvVar      `json:"env,omitempty"`
+	Volumes        []corev1.Volume      `json:"volumes,omitempty"`
+	VolumeMounts   []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	ReadinessProbe *corev1.Probe        `json:"readinessProbe,omitempty"`
+	LivenessProbe  *corev1.Probe        `json:"livenessProbe,omitempty"`
+	// TemplateRef renders a FgtechTemplate of the namespace. Fields set on the
+	// Fgtech win over the template; env and volumes are merged by name.
+	TemplateRef *TemplateRef `json:"templateRef,omitempty"`
+}
+
+// PreDeleteHook is either a Job built from the instance image (Command) or an
+// HTTP POST to the instance Service (HTTPPath). Command wins when both are set.
+type PreDeleteHook struct {
+	Command  []string `json:"command,omitempty"`
+	HTTPPath string   `json:"httpPath,omitempty"`
+	// TimeoutSeconds bounds the hook, measured from the deletion request;
+	// defaults to 300. Teardown goes on once it is reached.
+	TimeoutSeconds *int64 `json:"timeoutSeconds,omitempty"`
+}
+
+// ScheduleSpec describes when an instance runs. The workload is up while at
+// least one window has seen its up time more recently than its down time.
+type ScheduleSpec struct {
+	// TimeZone is an IANA name such as Europe/Paris; defaults to UTC.
+	TimeZone string           `json:"timeZone,omitempty"`
+	Windows  []ScheduleWindow `json:"windows"`
+}
+
+// ScheduleWindow pairs two standard 5-field cron expressions.
+type ScheduleWindow struct {
+	Up   string `json:"up"`
+	Down string `json:"down"`
+}
+
+// IdleSpec switches expiry to idle mode: the instance expires once no activity
+// has been observed for TimeoutSeconds.
+type IdleSpec struct {
+	TimeoutSeconds int64 `json:"timeoutSeconds"`
+	// HeartbeatPath is queried on the instance Service; it must answer
+	// {"lastActivity": "<RFC3339>"}. When empty, the last-activity annotation is used.
+	HeartbeatPath string `json:"heartbeatPath,omitempty"`
+}
+
+// FgtechStatus defines the observed state of Fgtech
+type FgtechStatus struct {
+	// ObservedGeneration is the spec generation last reconciled successfully.
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	Phase              string `json:"phase,omitempty"`
+	// ActiveSince is the start of the current lifetime: the creation time, or
+	// the last wake-up. TTL and maximum lifetime are measured from it.
+	ActiveSince *metav1.Time `json:"activeSince,omitempty"`
+	// ExpiresAt is the single source of truth for the instance expiry.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// ExtendedSeconds accumulates the extensions granted through AnnotationExtend.
+	ExtendedSeconds int64        `json:"extendedSeconds,omitempty"`
+	LastActivityAt  *metav1.Time `json:"lastActivityAt,omitempty"`
+	// ExpiryWarningSeconds is the tightest warning threshold already notified.
+	ExpiryWarningSeconds int64              `json:"expiryWarningSeconds,omitempty"`
+	Conditions           []metav1.Condition `json:"conditions,omitempty"`
+	// NextScheduleTransition is the next time the schedule scales the workload up or down.
+	NextScheduleTransition *metav1.Time `json:"nextScheduleTransition,omitempty"`
+	// PodRecreations counts the failed Pods replaced by the operator in a row;
+	// it drives the recreation backoff and resets once the Pod stays healthy.
+	PodRecreations      int32        `json:"podRecreations,omitempty"`
+	LastPodRecreationAt *metav1.Time `json:"lastPodRecreationAt,omitempty"`
+	LastPodFailure      *PodFailure  `json:"lastPodFailure,omitempty"`
+	// RestartedAt is when the Pod was last recreated for AnnotationRestartedAt.
+	RestartedAt *metav1.Time `json:"restartedAt,omitempty"`
+	// Template is the last successful rendering of spec.templateRef.
+	Template *TemplateStatus `json:"template,omitempty"`
+	// PreDelete tracks the HTTP pre-delete hook of a deleted instance.
+	PreDelete *PreDeleteStatus `json:"preDelete,omitempty"`
+}
+
+// PreDeleteStatus tracks an HTTP pre-delete hook, called in the background
+// while the reconciler polls it.
+type PreDeleteStatus struct {
+	// Phase is Running while a call is in flight, Retrying after a transport
+	// error or a 5xx, then Succeeded or Failed.
+	Phase         string       `json:"phase"`
+	Attempts      int32        `json:"attempts,omitempty"`
+	LastAttemptAt *metav1.Time `json:"lastAttemptAt,omitempty"`
+	Message       string       `json:"message,omitempty"`
+}
+
+// PodFailure describes the last failure observed on the workload Pod.
+type PodFailure struct {
+	PodUID    string `json:"podUID,omitempty"`
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message,omitempty"`
+	ExitCode  *int32 `json:"exitCode,omitempty"`
+	// LogTail holds the last lines of the failed container log.
+	LogTail    string      `json:"logTail,omitempty"`
+	ObservedAt metav1.Time `json:"observedAt"`
 }
 
 // +kubebuilder:object:root=true
@@ -34,11 +221,15 @@ type FgtechSpec struct {
 // +kubebuilder:printcolumn:name="ExtraPath",type=string,JSONPath=`.spec.extrapath`
 // +kubebuilder:printcolumn:name="TTL",type=integer,JSONPath=`.spec.ttlSeconds`
 // +kubebuilder:printcolumn:name="ServiceAccount",type=string,JSONPath=`.spec.serviceaccount`
+// +kubebuilder:printcolumn:name="Class",type=string,JSONPath=`.spec.className`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="ExpiresAt",type=date,JSONPath=`.status.expiresAt`
 type Fgtech struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec FgtechSpec `json:"spec,omitempty"`
+	Spec   FgtechSpec   `json:"spec,omitempty"`
+	Status FgtechStatus `json:"status,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -48,8 +239,13 @@ type FgtechList struct {
 	Items           []Fgtech `json:"items"`
 }
 
+// IsPaused reports whether the Fgtech carries AnnotationPaused.
+func (f *Fgtech) IsPaused() bool {
+	return f.Annotations[AnnotationPaused] == "true"
+}
+
 func addKnownTypes(s *runtime.Scheme) error {
-	s.AddKnownTypes(GroupVersion, &Fgtech{}, &FgtechList{})
+	s.AddKnownTypes(GroupVersion, &Fgtech{}, &FgtechList{}, &FgtechClass{}, &FgtechClassList{}, &FgtechTemplate{}, &FgtechTemplateList{}, &FgtechOperatorConfig{}, &FgtechOperatorConfigList{})
 	metav1.AddToGroupVersion(s, GroupVersion)
 	return nil
 }
@@ -58,7 +254,184 @@ func (in *Fgtech) DeepCopyInto(out *Fgtech) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *FgtechSpec) DeepCopyInto(out *FgtechSpec) {
+	*out = *in
+	if in.TTLSeconds != nil {
+		out.TTLSeconds = new(int64)
+		*out.TTLSeconds = *in.TTLSeconds
+	}
+	if in.Idle != nil {
+		out.Idle = new(IdleSpec)
+		*out.Idle = *in.Idle
+	}
+	if in.Schedule != nil {
+		out.Schedule = in.Schedule.DeepCopy()
+	}
+	if in.PreDelete != nil {
+		out.PreDelete = in.PreDelete.DeepCopy()
+	}
+	if in.Command != nil {
+		out.Command = make([]string, len(in.Command))
+		copy(out.Command, in.Command)
+	}
+	if in.Env != nil {
+		out.Env = make([]corev1.EnvVar, len(in.Env))
+		for i := range in.Env {
+			in.Env[i].DeepCopyInto(&out.Env[i])
+		}
+	}
+	if in.Volumes != nil {
+		out.Volumes = make([]corev1.Volume, len(in.Volumes))
+		for i := range in.Volumes {
+			in.Volumes[i].DeepCopyInto(&out.Volumes[i])
+		}
+	}
+	if in.VolumeMounts != nil {
+		out.VolumeMounts = make([]corev1.VolumeMount, len(in.VolumeMounts))
+		for i := range in.VolumeMounts {
+			in.VolumeMounts[i].DeepCopyInto(&out.VolumeMounts[i])
+		}
+	}
+	if in.ReadinessProbe != nil {
+		out.ReadinessProbe = in.ReadinessProbe.DeepCopy()
+	}
+	if in.LivenessProbe != nil {
+		out.LivenessProbe = in.LivenessProbe.DeepCopy()
+	}
+	if in.TemplateRef != nil {
+		out.TemplateRef = in.TemplateRef.DeepCopy()
+	}
+}
+
+func (in *PreDeleteHook) DeepCopyInto(out *PreDeleteHook) {
+	*out = *in
+	if in.Command != nil {
+		out.Command = make([]string, len(in.Command))
+		copy(out.Command, in.Command)
+	}
+	if in.TimeoutSeconds != nil {
+		out.TimeoutSeconds = new(int64)
+		*out.TimeoutSeconds = *in.TimeoutSeconds
+	}
+}
+
+func (in *PreDeleteHook) DeepCopy() *PreDeleteHook {
+	if in == nil {
+		return nil
+	}
+	out := new(PreDeleteHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *ScheduleSpec) DeepCopyInto(out *ScheduleSpec) {
+	*out = *in
+	if in.Windows != nil {
+		out.Windows = make([]ScheduleWindow, len(in.Windows))
+		copy(out.Windows, in.Windows)
+	}
+}
+
+func (in *ScheduleSpec) DeepCopy() *ScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechSpec) DeepCopy() *FgtechSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechStatus) DeepCopyInto(out *FgtechStatus) {
+	*out = *in
+	if in.ActiveSince != nil {
+		out.ActiveSince = in.ActiveSince.DeepCopy()
+	}
+	if in.ExpiresAt != nil {
+		out.ExpiresAt = in.ExpiresAt.DeepCopy()
+	}
+	if in.LastActivityAt != nil {
+		out.LastActivityAt = in.LastActivityAt.DeepCopy()
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+	if in.NextScheduleTransition != nil {
+		out.NextScheduleTransition = in.NextScheduleTransition.DeepCopy()
+	}
+	if in.LastPodRecreationAt != nil {
+		out.LastPodRecreationAt = in.LastPodRecreationAt.DeepCopy()
+	}
+	if in.LastPodFailure != nil {
+		out.LastPodFailure = in.LastPodFailure.DeepCopy()
+	}
+	if in.RestartedAt != nil {
+		out.RestartedAt = in.RestartedAt.DeepCopy()
+	}
+	if in.Template != nil {
+		out.Template = in.Template.DeepCopy()
+	}
+	if in.PreDelete != nil {
+		out.PreDelete = in.PreDelete.DeepCopy()
+	}
+}
+
+func (in *PreDeleteStatus) DeepCopyInto(out *PreDeleteStatus) {
+	*out = *in
+	if in.LastAttemptAt != nil {
+		out.LastAttemptAt = in.LastAttemptAt.DeepCopy()
+	}
+}
+
+func (in *PreDeleteStatus) DeepCopy() *PreDeleteStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PreDeleteStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *PodFailure) DeepCopyInto(out *PodFailure) {
+	*out = *in
+	if in.ExitCode != nil {
+		out.ExitCode = new(int32)
+		*out.ExitCode = *in.ExitCode
+	}
+	in.ObservedAt.DeepCopyInto(&out.ObservedAt)
+}
+
+func (in *PodFailure) DeepCopy() *PodFailure {
+	if in == nil {
+		return nil
+	}
+	out := new(PodFailure)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechStatus) DeepCopy() *FgtechStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechStatus)
+	in.DeepCopyInto(out)
+	return out
 }
 
 func (in *Fgtech) DeepCopy() *Fgtech {
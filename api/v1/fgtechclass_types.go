@@ -0,0 +1,153 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// FgtechClassSpec bundles the defaults and placement applied to the Fgtech
+// resources referencing the class. Empty fields fall back to the operator
+// configuration.
+type FgtechClassSpec struct {
+	// DefaultTTLSeconds applies to Fgtech resources without spec.ttlSeconds.
+	DefaultTTLSeconds *int64 `json:"defaultTTLSeconds,omitempty"`
+	// MaxTTLSeconds caps the TTL, whether it comes from the spec or the default.
+	MaxTTLSeconds     *int64                      `json:"maxTTLSeconds,omitempty"`
+	Resources         corev1.ResourceRequirements `json:"resources,omitempty"`
+	NodeSelector      map[string]string           `json:"nodeSelector,omitempty"`
+	Tolerations       []corev1.Toleration         `json:"tolerations,omitempty"`
+	PriorityClassName string                      `json:"priorityClassName,omitempty"`
+	// PodSecurityContext is set on the Pod, SecurityContext on its container.
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	SecurityContext    *corev1.SecurityContext    `json:"securityContext,omitempty"`
+	// IngressClassName selects the Ingress serving the routes of the class.
+	IngressClassName string `json:"ingressClassName,omitempty"`
+	// AllowedRegistries restricts the images the class accepts. Entries are
+	// registries (ghcr.io) or repository prefixes (ghcr.io/fgtech); images
+	// without registry belong to docker.io. Empty allows every image.
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// RecreatePods rolls class changes out to the running Pods, which are
+	// deleted and recreated. By default only the Pods created afterwards
+	// get the new settings.
+	RecreatePods bool `json:"recreatePods,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=fgtechclasses,scope=Cluster
+// +kubebuilder:printcolumn:name="DefaultTTL",type=integer,JSONPath=`.spec.defaultTTLSeconds`
+// +kubebuilder:printcolumn:name="MaxTTL",type=integer,JSONPath=`.spec.maxTTLSeconds`
+// +kubebuilder:printcolumn:name="IngressClass",type=string,JSONPath=`.spec.ingressClassName`
+type FgtechClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec FgtechClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+type FgtechClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FgtechClass `json:"items"`
+}
+
+// IsDefault reports whether the class carries AnnotationDefaultClass.
+func (c *FgtechClass) IsDefault() bool {
+	return c.Annotations[AnnotationDefaultClass] == "true"
+}
+
+func (in *FgtechClassSpec) DeepCopyInto(out *FgtechClassSpec) {
+	*out = *in
+	if in.DefaultTTLSeconds != nil {
+		out.DefaultTTLSeconds = new(int64)
+		*out.DefaultTTLSeconds = *in.DefaultTTLSeconds
+	}
+	if in.MaxTTLSeconds != nil {
+		out.MaxTTLSeconds = new(int64)
+		*out.MaxTTLSeconds = *in.MaxTTLSeconds
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.NodeSelector != nil {
+		out.NodeSelector = make(map[string]string, len(in.NodeSelector))
+		for k, v := range in.NodeSelector {
+			out.NodeSelector[k] = v
+		}
+	}
+	if in.Tolerations != nil {
+		out.Tolerations = make([]corev1.Toleration, len(in.Tolerations))
+		for i := range in.Tolerations {
+			in.Tolerations[i].DeepCopyInto(&out.Tolerations[i])
+		}
+	}
+	if in.PodSecurityContext != nil {
+		out.PodSecurityContext = in.PodSecurityContext.DeepCopy()
+	}
+	if in.SecurityContext != nil {
+		out.SecurityContext = in.SecurityContext.DeepCopy()
+	}
+	if in.AllowedRegistries != nil {
+		out.AllowedRegistries = make([]string, len(in.AllowedRegistries))
+		copy(out.AllowedRegistries, in.AllowedRegistries)
+	}
+}
+
+func (in *FgtechClassSpec) DeepCopy() *FgtechClassSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechClassSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechClass) DeepCopyInto(out *FgtechClass) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+func (in *FgtechClass) DeepCopy() *FgtechClass {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechClass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechClass) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func (in *FgtechClassList) DeepCopyInto(out *FgtechClassList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]FgtechClass, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *FgtechClassList) DeepCopy() *FgtechClassList {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechClassList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechClassList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// OperatorConfigName is the name of the FgtechOperatorConfig the operator reads;
+// other instances are ignored.
+const OperatorConfigName = "default"
+
+// ConditionConfigValid reports whether the FgtechOperatorConfig validates and
+// is in effect.
+const ConditionConfigValid = "Valid"
+
+// FgtechOperatorConfigSpec overrides the operator environment variables. Empty
+// fields keep the value of the matching variable.
+type FgtechOperatorConfigSpec struct {
+	// IngressFQDN overrides FGTECH_INGRESS_FQDN.
+	IngressFQDN string `json:"ingressFQDN,omitempty"`
+	// IngressTLSSecret overrides FGTECH_INGRESS_TLS_SECRET.
+	IngressTLSSecret string `json:"ingressTLSSecret,omitempty"`
+	// IngressClassName overrides FGTECH_INGRESS_CLASSNAME.
+	IngressClassName string `json:"ingressClassName,omitempty"`
+	// DefaultTTLSeconds overrides FGTECH_DEFAULT_TTL_SECONDS.
+	DefaultTTLSeconds *int64 `json:"defaultTTLSeconds,omitempty"`
+	// PodServiceAccount overrides FGTECH_POD_SERVICEACCOUNT.
+	PodServiceAccount string `json:"podServiceAccount,omitempty"`
+	// PodPort overrides FGTECH_POD_PORT.
+	PodPort *int32 `json:"podPort,omitempty"`
+	// TTLSweepInterval overrides FGTECH_TTL_SWEEP_INTERVAL.
+	TTLSweepInterval *metav1.Duration `json:"ttlSweepInterval,omitempty"`
+	// MaxLifetime overrides FGTECH_MAX_LIFETIME; 0s means unbounded.
+	MaxLifetime *metav1.Duration `json:"maxLifetime,omitempty"`
+	// ExpiryWarnings overrides FGTECH_EXPIRY_WARNINGS; an empty list disables the warnings.
+	ExpiryWarnings []metav1.Duration `json:"expiryWarnings,omitempty"`
+	// ExpiryPolicy overrides FGTECH_EXPIRY_POLICY.
+	ExpiryPolicy string `json:"expiryPolicy,omitempty"`
+	// ActivatorService overrides FGTECH_ACTIVATOR_SERVICE.
+	ActivatorService string `json:"activatorService,omitempty"`
+}
+
+// FgtechOperatorConfigStatus reports whether the operator applied the spec.
+type FgtechOperatorConfigStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=fgtechoperatorconfigs,scope=Cluster
+// +kubebuilder:printcolumn:name="FQDN",type=string,JSONPath=`.spec.ingressFQDN`
+// +kubebuilder:printcolumn:name="IngressClass",type=string,JSONPath=`.spec.ingressClassName`
+// +kubebuilder:printcolumn:name="Valid",type=string,JSONPath=`.status.conditions[?(@.type=="Valid")].status`
+type FgtechOperatorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FgtechOperatorConfigSpec   `json:"spec,omitempty"`
+	Status FgtechOperatorConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+type FgtechOperatorConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FgtechOperatorConfig `json:"items"`
+}
+
+func (in *FgtechOperatorConfigSpec) DeepCopyInto(out *FgtechOperatorConfigSpec) {
+	*out = *in
+	if in.DefaultTTLSeconds != nil {
+		out.DefaultTTLSeconds = new(int64)
+		*out.DefaultTTLSeconds = *in.DefaultTTLSeconds
+	}
+	if in.PodPort != nil {
+		out.PodPort = new(int32)
+		*out.PodPort = *in.PodPort
+	}
+	if in.TTLSweepInterval != nil {
+		out.TTLSweepInterval = new(metav1.Duration)
+		*out.TTLSweepInterval = *in.TTLSweepInterval
+	}
+	if in.MaxLifetime != nil {
+		out.MaxLifetime = new(metav1.Duration)
+		*out.MaxLifetime = *in.MaxLifetime
+	}
+	if in.ExpiryWarnings != nil {
+		out.ExpiryWarnings = make([]metav1.Duration, len(in.ExpiryWarnings))
+		copy(out.ExpiryWarnings, in.ExpiryWarnings)
+	}
+}
+
+func (in *FgtechOperatorConfigStatus) DeepCopyInto(out *FgtechOperatorConfigStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+func (in *FgtechOperatorConfigStatus) DeepCopy() *FgtechOperatorConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechOperatorConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechOperatorConfig) DeepCopyInto(out *FgtechOperatorConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *FgtechOperatorConfig) DeepCopy() *FgtechOperatorConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechOperatorConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechOperatorConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func (in *FgtechOperatorConfigList) DeepCopyInto(out *FgtechOperatorConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]FgtechOperatorConfig, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *FgtechOperatorConfigList) DeepCopy() *FgtechOperatorConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechOperatorConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechOperatorConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
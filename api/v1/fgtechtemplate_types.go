@@ -0,0 +1,226 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Parameter types accepted in TemplateParameter.Type.
+const (
+	ParameterTypeString  = "string"
+	ParameterTypeInteger = "integer"
+	ParameterTypeBoolean = "boolean"
+)
+
+// TemplateRef points a Fgtech at a FgtechTemplate of its namespace.
+type TemplateRef struct {
+	Name       string            `json:"name"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// WorkloadTemplate is the part of a Fgtech spec a template provides. String
+// fields, probe ports included, may reference parameters as ${name}.
+type WorkloadTemplate struct {
+	Image          string               `json:"image,omitempty"`
+	Command        []string             `json:"command,omitempty"`
+	Env            []corev1.EnvVar      `json:"env,omitempty"`
+	Volumes        []corev1.Volume      `json:"volumes,omitempty"`
+	VolumeMounts   []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	ReadinessProbe *corev1.Probe        `json:"readinessProbe,omitempty"`
+	LivenessProbe  *corev1.Probe        `json:"livenessProbe,omitempty"`
+}
+
+// TemplateParameter declares a parameter of a FgtechTemplate.
+type TemplateParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Type is string (default), integer or boolean.
+	Type string `json:"type,omitempty"`
+	// Default makes the parameter optional.
+	Default *string `json:"default,omitempty"`
+}
+
+// FgtechTemplateSpec holds the parameterised workload and its parameters.
+type FgtechTemplateSpec struct {
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
+	Template   WorkloadTemplate    `json:"template"`
+}
+
+// TemplateStatus records the last successful rendering of the template
+// referenced by a Fgtech. It keeps serving while a newer rendering fails.
+type TemplateStatus struct {
+	Name string `json:"name"`
+	// ObservedGeneration is the template generation rendered.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Parameters are the values used, defaults included.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Rendered   WorkloadTemplate  `json:"rendered"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=fgtechtemplates,scope=Namespaced
+// +kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.spec.template.image`
+type FgtechTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec FgtechTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+type FgtechTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FgtechTemplate `json:"items"`
+}
+
+func (in *TemplateRef) DeepCopyInto(out *TemplateRef) {
+	*out = *in
+	if in.Parameters != nil {
+		out.Parameters = make(map[string]string, len(in.Parameters))
+		for k, v := range in.Parameters {
+			out.Parameters[k] = v
+		}
+	}
+}
+
+func (in *TemplateRef) DeepCopy() *TemplateRef {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *WorkloadTemplate) DeepCopyInto(out *WorkloadTemplate) {
+	*out = *in
+	if in.Command != nil {
+		out.Command = make([]string, len(in.Command))
+		copy(out.Command, in.Command)
+	}
+	if in.Env != nil {
+		out.Env = make([]corev1.EnvVar, len(in.Env))
+		for i := range in.Env {
+			in.Env[i].DeepCopyInto(&out.Env[i])
+		}
+	}
+	if in.Volumes != nil {
+		out.Volumes = make([]corev1.Volume, len(in.Volumes))
+		for i := range in.Volumes {
+			in.Volumes[i].DeepCopyInto(&out.Volumes[i])
+		}
+	}
+	if in.VolumeMounts != nil {
+		out.VolumeMounts = make([]corev1.VolumeMount, len(in.VolumeMounts))
+		for i := range in.VolumeMounts {
+			in.VolumeMounts[i].DeepCopyInto(&out.VolumeMounts[i])
+		}
+	}
+	if in.ReadinessProbe != nil {
+		out.ReadinessProbe = in.ReadinessProbe.DeepCopy()
+	}
+	if in.LivenessProbe != nil {
+		out.LivenessProbe = in.LivenessProbe.DeepCopy()
+	}
+}
+
+func (in *WorkloadTemplate) DeepCopy() *WorkloadTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *TemplateParameter) DeepCopyInto(out *TemplateParameter) {
+	*out = *in
+	if in.Default != nil {
+		out.Default = new(string)
+		*out.Default = *in.Default
+	}
+}
+
+func (in *FgtechTemplateSpec) DeepCopyInto(out *FgtechTemplateSpec) {
+	*out = *in
+	if in.Parameters != nil {
+		out.Parameters = make([]TemplateParameter, len(in.Parameters))
+		for i := range in.Parameters {
+			in.Parameters[i].DeepCopyInto(&out.Parameters[i])
+		}
+	}
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+func (in *TemplateStatus) DeepCopyInto(out *TemplateStatus) {
+	*out = *in
+	if in.Parameters != nil {
+		out.Parameters = make(map[string]string, len(in.Parameters))
+		for k, v := range in.Parameters {
+			out.Parameters[k] = v
+		}
+	}
+	in.Rendered.DeepCopyInto(&out.Rendered)
+}
+
+func (in *TemplateStatus) DeepCopy() *TemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechTemplate) DeepCopyInto(out *FgtechTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+func (in *FgtechTemplate) DeepCopy() *FgtechTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func (in *FgtechTemplateList) DeepCopyInto(out *FgtechTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]FgtechTemplate, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *FgtechTemplateList) DeepCopy() *FgtechTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(FgtechTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FgtechTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// podSelector returns the label selector cacheOptions applies to Pods.
+func podSelector(t testing.TB, opts cache.Options) labels.Selector {
+	t.Helper()
+	for obj, byObject := range opts.ByObject {
+		if _, ok := obj.(*corev1.Pod); ok {
+			return byObject.Label
+		}
+	}
+	t.Fatalf("no cache options for pods")
+	return nil
+}
+
+func TestCacheOptionsSelectManagedObjects(t *testing.T) {
+	opts := cacheOptions(defaultConfig(), nil)
+	if len(opts.ByObject) != 4 {
+		t.Fatalf("ByObject = %v, want Pods, Services, Jobs and Ingresses", opts.ByObject)
+	}
+	selector := podSelector(t, opts)
+	if !selector.Matches(labels.Set(pod.ManagedLabels("demo"))) {
+		t.Fatalf("selector %s rejects the instance pods", selector)
+	}
+	if selector.Matches(labels.Set{"app": "web"}) {
+		t.Fatalf("selector %s accepts foreign pods", selector)
+	}
+}
+
+// clusterPods returns total Pods of which managed belong to the operator.
+func clusterPods(total, managed int) []k8sruntime.Object {
+	objs := make([]k8sruntime.Object, 0, total)
+	for i := 0; i < total; i++ {
+		l := map[string]string{"app": "web", "tier": "frontend"}
+		if i < managed {
+			l = pod.ManagedLabels(fmt.Sprintf("fg-%d", i))
+		}
+		objs = append(objs, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("pod-%d", i),
+				Namespace:   fmt.Sprintf("ns-%d", i%50),
+				Labels:      l,
+				Annotations: map[string]string{"note": "some payload kept in the cache"},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:    "main",
+				Image:   "registry.example.com/team/app:1.0.0",
+				Command: []string{"/bin/app", "--serve", "--port=8080"},
+				Env:     []corev1.EnvVar{{Name: "MODE", Value: "production"}},
+			}}},
+		})
+	}
+	return objs
+}
+
+// BenchmarkPodCacheMemory syncs a Pod informer over 5000 Pods, 100 of them
+// created by the operator, with and without the cacheOptions label selector,
+// and reports the objects and heap bytes the informer holds.
+func BenchmarkPodCacheMemory(b *testing.B) {
+	objs := clusterPods(5000, 100)
+	for _, bc := range []struct {
+		name     string
+		selector labels.Selector
+	}{
+		{name: "unfiltered", selector: labels.Everything()},
+		{name: "managed", selector: podSelector(b, cacheOptions(defaultConfig(), nil))},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cs := kubefake.NewSimpleClientset(objs...)
+			var objects int
+			var heap uint64
+			for i := 0; i < b.N; i++ {
+				before := heapInUse()
+				factory := informers.NewSharedInformerFactoryWithOptions(cs, 0,
+					informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.LabelSelector = bc.selector.String() }))
+				informer := factory.Core().V1().Pods().Informer()
+				ctx, cancel := context.WithCancel(context.Background())
+				factory.Start(ctx.Done())
+				if !toolscache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+					b.Fatalf("informer did not sync")
+				}
+				objects = len(informer.GetStore().List())
+				if after := heapInUse(); after > before {
+					heap = after - before
+				}
+				cancel()
+				factory.Shutdown()
+			}
+			b.ReportMetric(float64(objects), "objects")
+			b.ReportMetric(float64(heap), "heap-bytes")
+		})
+	}
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
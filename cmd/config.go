@@ -0,0 +1,642 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/controllers"
+	"github.com/fgtech/ia/cursor/pkg/archive"
+	"github.com/fgtech/ia/cursor/pkg/audit"
+	"github.com/fgtech/ia/cursor/pkg/tracing"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	logFormatConsole = "console"
+	logFormatJSON    = "json"
+)
+
+// managerConfig is the whole manager configuration. Each field is loaded from
+// the file given by --config, then the environment, then the command line,
+// each source overriding the previous one.
+type managerConfig struct {
+	MetricsAddr             string
+	HealthProbeAddr         string
+	ActivatorAddr           string
+	LeaderElect             bool
+	MaxConcurrentReconciles int
+	SyncPeriod              time.Duration
+	IngressSyncDelay        time.Duration
+	// RateLimit paces the retries of the Fgtech and ingress sync controllers.
+	RateLimit controllers.RateLimit
+	// WatchNamespaces restricts the manager cache; empty watches every namespace.
+	WatchNamespaces []string
+	// WatchNamespaceSelector narrows the watched namespaces to the ones whose
+	// labels match; it is resolved at startup.
+	WatchNamespaceSelector string
+	// NamespacedRBAC runs the operator with Roles in the watched namespaces
+	// only: cluster-scoped resources are neither read nor watched.
+	NamespacedRBAC bool
+	LogFormat      string
+	// OperatorNamespace is the namespace the operator runs in, holding the
+	// shard Leases.
+	OperatorNamespace string
+	// Sharding splits the namespaces between the replicas instead of
+	// electing a leader.
+	Sharding bool
+
+	IngressHost           string
+	IngressTLSSecret      string
+	IngressClassName      string
+	DefaultTTLSeconds     int64
+	DefaultServiceAccount string
+	PodPort               int32
+	TTLSweepInterval      time.Duration
+	MaxLifetime           time.Duration
+	ExpiryWarnings        []time.Duration
+	NotifyWebhooks        []string
+	ExpiryPolicy          string
+	ActivatorHost         string
+	// ArchiveStore selects where definitions are archived before deletion:
+	// configmap (namespace recycle bin), s3 or none.
+	ArchiveStore           string
+	ArchiveRetention       time.Duration
+	ArchiveIncludeWorkload bool
+	ArchiveS3              archive.S3Options
+
+	// AuditSinks receive a record of every spec change: stdout,
+	// file:<path> or an http(s) URL.
+	AuditSinks          []string
+	AuditFileMaxSizeMB  int64
+	AuditFileMaxBackups int64
+
+	// TracingExporter sends the spans to stdout, an OTLP/HTTP collector
+	// reached at TracingEndpoint, or nowhere.
+	TracingExporter string
+	TracingEndpoint string
+	TracingInsecure bool
+}
+
+// cliOptions are the command-line switches that select what the binary does
+// rather than how the manager runs.
+type cliOptions struct {
+	ConfigFile        string
+	PrintConfig       bool
+	RestoreRef        string
+	RestoreTTLSeconds int64
+}
+
+func defaultConfig() managerConfig {
+	return managerConfig{
+		MetricsAddr:             ":8080",
+		HealthProbeAddr:         ":8081",
+		ActivatorAddr:           ":8082",
+		MaxConcurrentReconciles: 1,
+		SyncPeriod:              10 * time.Hour,
+		IngressSyncDelay:        controllers.DefaultIngressSyncDelay,
+		LogFormat:               logFormatConsole,
+		IngressTLSSecret:        "fgtech-tls",
+		DefaultServiceAccount:   "default",
+		DefaultTTLSeconds:       int64(3600),
+		PodPort:                 8080,
+		TTLSweepInterval:        controllers.DefaultTTLSweepInterval,
+		ExpiryWarnings:          []time.Duration{time.Hour, 10 * time.Minute},
+		ExpiryPolicy:            fgtechv1.ExpiryPolicyDelete,
+		ArchiveStore:            archiveStoreConfigMap,
+		ArchiveRetention:        7 * 24 * time.Hour,
+		AuditFileMaxSizeMB:      100,
+		AuditFileMaxBackups:     5,
+		TracingExporter:         tracing.ExporterNone,
+		RateLimit: controllers.RateLimit{
+			BaseDelay: controllers.DefaultRateLimitBaseDelay,
+			MaxDelay:  controllers.DefaultRateLimitMaxDelay,
+			QPS:       controllers.DefaultRateLimitQPS,
+			Burst:     controllers.DefaultRateLimitBurst,
+		},
+	}
+}
+
+// setting binds one configuration field to its YAML key, environment
+// variable and flag.
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	// boolean flags may be given without value.
+	boolean bool
+	// emptyEnv makes a set but empty variable meaningful (an empty list);
+	// otherwise it is ignored.
+	emptyEnv bool
+	// secret values are redacted by --print-config.
+	secret bool
+	parse  func(c *managerConfig, v string) error
+	value  func(c *managerConfig) interface{}
+}
+
+func stringSetting(key, env, flagName, usage string, field func(*managerConfig) *string) setting {
+	return setting{key: key, env: env, flag: flagName, usage: usage,
+		parse: func(c *managerConfig, v string) error { *field(c) = v; return nil },
+		value: func(c *managerConfig) interface{} { return *field(c) },
+	}
+}
+
+func enumSetting(key, env, flagName, usage string, field func(*managerConfig) *string, allowed ...string) setting {
+	s := stringSetting(key, env, flagName, usage, field)
+	s.parse = func(c *managerConfig, v string) error {
+		for _, a := range allowed {
+			if v == a {
+				*field(c) = v
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+	return s
+}
+
+func boolSetting(key, env, flagName, usage string, field func(*managerConfig) *bool) setting {
+	return setting{key: key, env: env, flag: flagName, usage: usage, boolean: true,
+		parse: func(c *managerConfig, v string) error {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return errors.New("must be a boolean")
+			}
+			*field(c) = parsed
+			return nil
+		},
+		value: func(c *managerConfig) interface{} { return *field(c) },
+	}
+}
+
+func intSetting(key, env, flagName, usage string, min, max int64, set func(*managerConfig, int64), get func(*managerConfig) int64) setting {
+	return setting{key: key, env: env, flag: flagName, usage: usage,
+		parse: func(c *managerConfig, v string) error {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || parsed < min || parsed > max {
+				return fmt.Errorf("must be an integer between %d and %d", min, max)
+			}
+			set(c, parsed)
+			return nil
+		},
+		value: func(c *managerConfig) interface{} { return get(c) },
+	}
+}
+
+// durationSetting accepts Go durations; zero only when allowZero is set.
+func durationSetting(key, env, flagName, usage string, allowZero bool, field func(*managerConfig) *time.Duration) setting {
+	return setting{key: key, env: env, flag: flagName, usage: usage,
+		parse: func(c *managerConfig, v string) error {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed < 0 || (parsed == 0 && !allowZero) {
+				return errors.New("must be a positive duration")
+			}
+			*field(c) = parsed
+			return nil
+		},
+		value: func(c *managerConfig) interface{} { return field(c).String() },
+	}
+}
+
+func listSetting(key, env, flagName, usage string, field func(*managerConfig) *[]string) setting {
+	return setting{key: key, env: env, flag: flagName, usage: usage,
+		parse: func(c *managerConfig, v string) error { *field(c) = splitList(v); return nil },
+		value: func(c *managerConfig) interface{} { return *field(c) },
+	}
+}
+
+var settings = []setting{
+	stringSetting("metricsBindAddress", "FGTECH_METRICS_BIND_ADDRESS", "metrics-bind-address",
+		"The address the metric endpoint binds to.",
+		func(c *managerConfig) *string { return &c.MetricsAddr }),
+	stringSetting("healthProbeBindAddress", "FGTECH_HEALTH_PROBE_BIND_ADDRESS", "health-probe-bind-address",
+		"The address the health probe endpoint binds to.",
+		func(c *managerConfig) *string { return &c.HealthProbeAddr }),
+	stringSetting("activatorBindAddress", "FGTECH_ACTIVATOR_BIND_ADDRESS", "activator-bind-address",
+		"The address the wake-on-request activator binds to. Set to 0 to disable it.",
+		func(c *managerConfig) *string { return &c.ActivatorAddr }),
+	boolSetting("leaderElect", "FGTECH_LEADER_ELECT", "leader-elect",
+		"Enable leader election for controller manager.",
+		func(c *managerConfig) *bool { return &c.LeaderElect }),
+	intSetting("maxConcurrentReconciles", "FGTECH_MAX_CONCURRENT_RECONCILES", "max-concurrent-reconciles",
+		"Number of Fgtech resources reconciled in parallel.", 1, 1024,
+		func(c *managerConfig, v int64) { c.MaxConcurrentReconciles = int(v) },
+		func(c *managerConfig) int64 { return int64(c.MaxConcurrentReconciles) }),
+	durationSetting("syncPeriod", "FGTECH_SYNC_PERIOD", "sync-period",
+		"Period after which every watched resource is reconciled again.", false,
+		func(c *managerConfig) *time.Duration { return &c.SyncPeriod }),
+	durationSetting("ingressSyncDelay", "FGTECH_INGRESS_SYNC_DELAY", "ingress-sync-delay",
+		"How long a namespace ingress sync waits to gather the changes that follow. 0 syncs right away.", true,
+		func(c *managerConfig) *time.Duration { return &c.IngressSyncDelay }),
+	durationSetting("rateLimitBaseDelay", "FGTECH_RATE_LIMIT_BASE_DELAY", "rate-limit-base-delay",
+		"Delay before the first retry of a failed reconciliation, doubled on each failure.", false,
+		func(c *managerConfig) *time.Duration { return &c.RateLimit.BaseDelay }),
+	durationSetting("rateLimitMaxDelay", "FGTECH_RATE_LIMIT_MAX_DELAY", "rate-limit-max-delay",
+		"Upper bound of the delay between the retries of a failed reconciliation.", false,
+		func(c *managerConfig) *time.Duration { return &c.RateLimit.MaxDelay }),
+	{
+		key: "rateLimitQPS", env: "FGTECH_RATE_LIMIT_QPS", flag: "rate-limit-qps",
+		usage: "Retries per second allowed to each controller (errors and Requeue results); event-driven and RequeueAfter reconciliations are not limited.",
+		parse: func(c *managerConfig, v string) error {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil || parsed <= 0 {
+				return errors.New("must be a positive number")
+			}
+			c.RateLimit.QPS = parsed
+			return nil
+		},
+		value: func(c *managerConfig) interface{} { return c.RateLimit.QPS },
+	},
+	intSetting("rateLimitBurst", "FGTECH_RATE_LIMIT_BURST", "rate-limit-burst",
+		"Retries allowed at once above rateLimitQPS.", 1, 1<<20,
+		func(c *managerConfig, v int64) { c.RateLimit.Burst = int(v) },
+		func(c *managerConfig) int64 { return int64(c.RateLimit.Burst) }),
+	listSetting("watchNamespaces", "FGTECH_WATCH_NAMESPACES", "watch-namespaces",
+		"Comma-separated namespaces the operator watches. Empty watches all namespaces.",
+		func(c *managerConfig) *[]string { return &c.WatchNamespaces }),
+	{
+		key: "watchNamespaceSelector", env: "FGTECH_WATCH_NAMESPACE_SELECTOR", flag: "watch-namespace-selector",
+		usage: "Label selector of the namespaces the operator watches, e.g. fgtech.io/enabled=true. The operator restarts when the matching namespaces change.",
+		parse: func(c *managerConfig, v string) error {
+			if _, err := labels.Parse(v); err != nil {
+				return fmt.Errorf("must be a label selector: %w", err)
+			}
+			c.WatchNamespaceSelector = v
+			return nil
+		},
+		value: func(c *managerConfig) interface{} { return c.WatchNamespaceSelector },
+	},
+	boolSetting("namespacedRBAC", "FGTECH_NAMESPACED_RBAC", "namespaced-rbac",
+		"Run with Roles in the watched namespaces only: FgtechClass and FgtechOperatorConfig are ignored.",
+		func(c *managerConfig) *bool { return &c.NamespacedRBAC }),
+	enumSetting("logFormat", "FGTECH_LOG_FORMAT", "log-format",
+		"Log encoding: console or json.",
+		func(c *managerConfig) *string { return &c.LogFormat }, logFormatConsole, logFormatJSON),
+	stringSetting("operatorNamespace", "FGTECH_OPERATOR_NAMESPACE", "operator-namespace",
+		"Namespace of the operator, holding the shard Leases. Required with --sharding.",
+		func(c *managerConfig) *string { return &c.OperatorNamespace }),
+	boolSetting("sharding", "FGTECH_SHARDING", "sharding",
+		"Split the namespaces between the replicas by consistent hash, each one reconciling its own share.",
+		func(c *managerConfig) *bool { return &c.Sharding }),
+
+	stringSetting("ingressFQDN", "FGTECH_INGRESS_FQDN", "ingress-fqdn",
+		"Host serving the instance routes.",
+		func(c *managerConfig) *string { return &c.IngressHost }),
+	stringSetting("ingressTLSSecret", "FGTECH_INGRESS_TLS_SECRET", "ingress-tls-secret",
+		"TLS secret of the instance routes.",
+		func(c *managerConfig) *string { return &c.IngressTLSSecret }),
+	stringSetting("ingressClassName", "FGTECH_INGRESS_CLASSNAME", "ingress-class-name",
+		"Ingress class of the routes when no FgtechClass sets one.",
+		func(c *managerConfig) *string { return &c.IngressClassName }),
+	intSetting("defaultTTLSeconds", "FGTECH_DEFAULT_TTL_SECONDS", "default-ttl-seconds",
+		"TTL of the instances without spec.ttlSeconds.", 1, 1<<62,
+		func(c *managerConfig, v int64) { c.DefaultTTLSeconds = v },
+		func(c *managerConfig) int64 { return c.DefaultTTLSeconds }),
+	stringSetting("podServiceAccount", "FGTECH_POD_SERVICEACCOUNT", "pod-service-account",
+		"Service account of the instance pods.",
+		func(c *managerConfig) *string { return &c.DefaultServiceAccount }),
+	intSetting("podPort", "FGTECH_POD_PORT", "pod-port",
+		"Port the instances listen on.", 1, 65535,
+		func(c *managerConfig, v int64) { c.PodPort = int32(v) },
+		func(c *managerConfig) int64 { return int64(c.PodPort) }),
+	durationSetting("ttlSweepInterval", "FGTECH_TTL_SWEEP_INTERVAL", "ttl-sweep-interval",
+		"Period of the safety-net expiry sweep.", false,
+		func(c *managerConfig) *time.Duration { return &c.TTLSweepInterval }),
+	durationSetting("maxLifetime", "FGTECH_MAX_LIFETIME", "max-lifetime",
+		"Upper bound of TTL plus extensions. 0 means unbounded.", true,
+		func(c *managerConfig) *time.Duration { return &c.MaxLifetime }),
+	{
+		key: "expiryWarnings", env: "FGTECH_EXPIRY_WARNINGS", flag: "expiry-warnings", emptyEnv: true,
+		usage: "Comma-separated durations before expiry at which a warning is raised. Empty disables the warnings.",
+		parse: func(c *managerConfig, v string) error {
+			var warnings []time.Duration
+			for _, item := range splitList(v) {
+				parsed, err := time.ParseDuration(item)
+				if err != nil || parsed <= 0 {
+					return fmt.Errorf("%q is not a positive duration", item)
+				}
+				warnings = append(warnings, parsed)
+			}
+			c.ExpiryWarnings = warnings
+			return nil
+		},
+		value: func(c *managerConfig) interface{} {
+			out := make([]string, 0, len(c.ExpiryWarnings))
+			for _, d := range c.ExpiryWarnings {
+				out = append(out, d.String())
+			}
+			return out
+		},
+	},
+	// Webhook URLs often embed a token.
+	secret(listSetting("notifyWebhooks", "FGTECH_NOTIFY_WEBHOOKS", "notify-webhooks",
+		"Comma-separated URLs receiving the lifecycle notifications.",
+		func(c *managerConfig) *[]string { return &c.NotifyWebhooks })),
+	{
+		key:  "auditSinks",
+		env:  "FGTECH_AUDIT_SINKS",
+		flag: "audit-sinks",
+		usage: "Comma-separated destinations of the spec change audit records: stdout, file:<path> " +
+			"or an http(s) URL.",
+		parse: func(c *managerConfig, v string) error {
+			sinks := splitList(v)
+			for _, spec := range sinks {
+				if err := audit.CheckSpec(spec); err != nil {
+					return err
+				}
+			}
+			c.AuditSinks = sinks
+			return nil
+		},
+		value: func(c *managerConfig) interface{} { return c.AuditSinks },
+	},
+	intSetting("auditFileMaxSizeMB", "FGTECH_AUDIT_FILE_MAX_SIZE_MB", "audit-file-max-size-mb",
+		"Size in megabytes past which an audit file is rotated.", 1, 1<<20,
+		func(c *managerConfig, v int64) { c.AuditFileMaxSizeMB = v },
+		func(c *managerConfig) int64 { return c.AuditFileMaxSizeMB }),
+	intSetting("auditFileMaxBackups", "FGTECH_AUDIT_FILE_MAX_BACKUPS", "audit-file-max-backups",
+		"Rotated audit files kept.", 0, 1000,
+		func(c *managerConfig, v int64) { c.AuditFileMaxBackups = v },
+		func(c *managerConfig) int64 { return c.AuditFileMaxBackups }),
+	enumSetting("tracingExporter", "FGTECH_TRACING_EXPORTER", "tracing-exporter",
+		"Destination of the OpenTelemetry spans: none, stdout or otlp.",
+		func(c *managerConfig) *string { return &c.TracingExporter },
+		tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP),
+	stringSetting("tracingEndpoint", "FGTECH_TRACING_ENDPOINT", "tracing-endpoint",
+		"host:port of the OTLP/HTTP collector. Empty uses OTEL_EXPORTER_OTLP_ENDPOINT.",
+		func(c *managerConfig) *string { return &c.TracingEndpoint }),
+	boolSetting("tracingInsecure", "FGTECH_TRACING_INSECURE", "tracing-insecure",
+		"Send the spans to the OTLP collector over plain HTTP.",
+		func(c *managerConfig) *bool { return &c.TracingInsecure }),
+	enumSetting("expiryPolicy", "FGTECH_EXPIRY_POLICY", "expiry-policy",
+		"Action on expiry when neither the Fgtech nor its namespace sets one.",
+		func(c *managerConfig) *string { return &c.ExpiryPolicy },
+		fgtechv1.ExpiryPolicyDelete, fgtechv1.ExpiryPolicyHibernate, fgtechv1.ExpiryPolicyArchive),
+	stringSetting("activatorService", "FGTECH_ACTIVATOR_SERVICE", "activator-service",
+		"Host of the activator Service routing hibernated instances.",
+		func(c *managerConfig) *string { return &c.ActivatorHost }),
+
+	enumSetting("archiveStore", "FGTECH_ARCHIVE_STORE", "archive-store",
+		"Where definitions are archived before deletion: configmap, s3 or none.",
+		func(c *managerConfig) *string { return &c.ArchiveStore },
+		archiveStoreConfigMap, archiveStoreS3, archiveStoreNone),
+	durationSetting("archiveRetention", "FGTECH_ARCHIVE_RETENTION", "archive-retention",
+		"How long archive entries are kept. 0 keeps them forever.", true,
+		func(c *managerConfig) *time.Duration { return &c.ArchiveRetention }),
+	boolSetting("archiveIncludeWorkload", "FGTECH_ARCHIVE_INCLUDE_WORKLOAD", "archive-include-workload",
+		"Archive the Pod and Service alongside the Fgtech.",
+		func(c *managerConfig) *bool { return &c.ArchiveIncludeWorkload }),
+	stringSetting("archiveS3Endpoint", "FGTECH_ARCHIVE_S3_ENDPOINT", "archive-s3-endpoint",
+		"Endpoint of the s3 archive store.",
+		func(c *managerConfig) *string { return &c.ArchiveS3.Endpoint }),
+	stringSetting("archiveS3Bucket", "FGTECH_ARCHIVE_S3_BUCKET", "archive-s3-bucket",
+		"Bucket of the s3 archive store.",
+		func(c *managerConfig) *string { return &c.ArchiveS3.Bucket }),
+	stringSetting("archiveS3Region", "FGTECH_ARCHIVE_S3_REGION", "archive-s3-region",
+		"Region of the s3 archive store.",
+		func(c *managerConfig) *string { return &c.ArchiveS3.Region }),
+	stringSetting("archiveS3Prefix", "FGTECH_ARCHIVE_S3_PREFIX", "archive-s3-prefix",
+		"Key prefix of the s3 archive entries.",
+		func(c *managerConfig) *string { return &c.ArchiveS3.Prefix }),
+	stringSetting("archiveS3AccessKeyID", "AWS_ACCESS_KEY_ID", "archive-s3-access-key-id",
+		"Access key of the s3 archive store.",
+		func(c *managerConfig) *string { return &c.ArchiveS3.AccessKeyID }),
+	secret(stringSetting("archiveS3SecretAccessKey", "AWS_SECRET_ACCESS_KEY", "archive-s3-secret-access-key",
+		"Secret key of the s3 archive store. Prefer the environment over the command line.",
+		func(c *managerConfig) *string { return &c.ArchiveS3.SecretAccessKey })),
+}
+
+func secret(s setting) setting {
+	s.secret = true
+	return s
+}
+
+// loadConfig builds the configuration from the file named by --config, the
+// environment and args, in increasing precedence. Every invalid value is
+// reported, prefixed by its source.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (managerConfig, cliOptions, error) {
+	cfg := defaultConfig()
+	var opts cliOptions
+
+	fs := flag.NewFlagSet("manager", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.ConfigFile, "config", "", "YAML configuration file; the environment and the flags override it.")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "Print the effective configuration as YAML, then exit.")
+	fs.StringVar(&opts.RestoreRef, "restore", "", "Restore the archive entry <namespace>/<id> as a new Fgtech, then exit.")
+	fs.Int64Var(&opts.RestoreTTLSeconds, "restore-ttl-seconds", 0, "TTL in seconds given to the restored Fgtech. 0 keeps the archived TTL.")
+	flagValues := map[string]string{}
+	for _, s := range settings {
+		name := s.flag
+		record := func(v string) error { flagValues[name] = v; return nil }
+		if s.boolean {
+			fs.BoolFunc(name, s.usage, record)
+		} else {
+			fs.Func(name, s.usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return cfg, opts, err
+	}
+
+	var errs []error
+	if opts.ConfigFile != "" {
+		values, err := readConfigFile(opts.ConfigFile)
+		if err != nil {
+			return cfg, opts, err
+		}
+		for _, s := range settings {
+			if v, ok := values[s.key]; ok {
+				if err := s.parse(&cfg, v); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %s: %w", opts.ConfigFile, s.key, err))
+				}
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env); ok && (v != "" || s.emptyEnv) {
+			if err := s.parse(&cfg, v); err != nil {
+				errs = append(errs, fmt.Errorf("env %s=%q: %w", s.env, v, err))
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flagValues[s.flag]; ok {
+			if err := s.parse(&cfg, v); err != nil {
+				errs = append(errs, fmt.Errorf("flag --%s=%q: %w", s.flag, v, err))
+			}
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	return cfg, opts, errors.Join(errs...)
+}
+
+// validate checks the rules spanning several settings.
+func (c managerConfig) validate() []error {
+	var errs []error
+	if c.ArchiveStore == archiveStoreS3 && (c.ArchiveS3.Endpoint == "" || c.ArchiveS3.Bucket == "") {
+		errs = append(errs, errors.New("archiveS3Endpoint and archiveS3Bucket are required by the s3 archive store"))
+	}
+	if c.IngressTLSSecret == "" {
+		errs = append(errs, errors.New("ingressTLSSecret must not be empty"))
+	}
+	if c.DefaultServiceAccount == "" {
+		errs = append(errs, errors.New("podServiceAccount must not be empty"))
+	}
+	if c.RateLimit.BaseDelay > c.RateLimit.MaxDelay {
+		errs = append(errs, errors.New("rateLimitBaseDelay must not exceed rateLimitMaxDelay"))
+	}
+	if c.NamespacedRBAC && len(c.WatchNamespaces) == 0 {
+		errs = append(errs, errors.New("namespacedRBAC requires watchNamespaces"))
+	}
+	if c.Sharding && c.LeaderElect {
+		errs = append(errs, errors.New("sharding replaces leaderElect: every replica runs, on its own namespaces"))
+	}
+	if c.Sharding && c.OperatorNamespace == "" {
+		errs = append(errs, errors.New("sharding requires operatorNamespace, where the shard Leases live"))
+	}
+	if c.NamespacedRBAC && c.WatchNamespaceSelector != "" {
+		errs = append(errs, errors.New("watchNamespaceSelector lists the cluster namespaces and cannot be combined with namespacedRBAC"))
+	}
+	return errs
+}
+
+// readConfigFile returns the settings of a YAML file as strings, lists joined
+// with commas. Unknown keys are rejected.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		known[s.key] = true
+	}
+	var errs []error
+	values := make(map[string]string, len(raw))
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !known[k] {
+			errs = append(errs, fmt.Errorf("%s: unknown key %s", path, k))
+			continue
+		}
+		v, err := scalarString(raw[k])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, k, err))
+			continue
+		}
+		values[k] = v
+	}
+	return values, errors.Join(errs...)
+}
+
+func scalarString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalarString(item)
+			if err != nil {
+				return "", err
+			}
+			if strings.Contains(s, ",") {
+				return "", fmt.Errorf("list item %q must not contain a comma", s)
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// printConfig writes cfg as a configuration file --config accepts.
+func printConfig(w io.Writer, cfg managerConfig) error {
+	out := make(map[string]interface{}, len(settings))
+	for _, s := range settings {
+		v := s.value(&cfg)
+		if s.secret {
+			v = redact(v)
+		}
+		out[s.key] = v
+	}
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// redact hides a secret value, item by item for lists; empty values stay so.
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return v
+		}
+	case []string:
+		out := make([]string, len(v))
+		for i := range out {
+			out[i] = "<redacted>"
+		}
+		return out
+	}
+	return "<redacted>"
+}
+
+// operatorConfig returns the settings a FgtechOperatorConfig may override.
+func (c managerConfig) operatorConfig() controllers.OperatorConfig {
+	return controllers.OperatorConfig{
+		IngressHost:       c.IngressHost,
+		IngressTLSSecret:  c.IngressTLSSecret,
+		IngressClassName:  c.IngressClassName,
+		DefaultTTLSeconds: c.DefaultTTLSeconds,
+		DefaultSA:         c.DefaultServiceAccount,
+		DefaultPodPort:    c.PodPort,
+		TTLSweepInterval:  c.TTLSweepInterval,
+		MaxLifetime:       c.MaxLifetime,
+		ExpiryWarnings:    c.ExpiryWarnings,
+		ExpiryPolicy:      c.ExpiryPolicy,
+		ActivatorHost:     c.ActivatorHost,
+	}
+}
+
+// splitList parses a comma-separated value, ignoring blank items.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
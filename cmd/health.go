@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/fgtech/ia/cursor/controllers"
+	"github.com/fgtech/ia/cursor/pkg/health"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/fgtech/ia/cursor/pkg/shard"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// probeTargets follows the ingress class checked by /readyz through
+// FgtechOperatorConfig changes.
+type probeTargets struct {
+	mu           sync.RWMutex
+	ingressClass string
+}
+
+func newProbeTargets(cfg controllers.OperatorConfig) *probeTargets {
+	p := &probeTargets{}
+	p.Reconfigure(cfg)
+	return p
+}
+
+// Reconfigure implements controllers.Reconfigurable.
+func (p *probeTargets) Reconfigure(cfg controllers.OperatorConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ingressClass = cfg.IngressClassName
+}
+
+func (p *probeTargets) IngressClass() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.ingressClass
+}
+
+// addHealthChecks registers the /readyz and /healthz checks. Readiness reads
+// the IngressClass with apiReader, keeping it out of the cache; being
+// cluster-scoped, it is not checked with namespacedRBAC. The TLS Secrets are
+// read the same way in the namespaces of the managed Ingresses, those of this
+// replica's shard with sharding, which also requires a live shard Lease. Liveness only
+// watches the TTL sweep: a wedged loop is the one failure a restart fixes.
+func addHealthChecks(mgr manager.Manager, cfg managerConfig, apiReader client.Reader, apiServer rest.Interface, targets *probeTargets, ttlWatcher controllers.TTLWatcher, membership *shard.Membership) error {
+	if err := mgr.AddReadyzCheck("caches", health.CachesSynced(mgr.GetCache())); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("apiserver", health.APIServer(apiServer)); err != nil {
+		return err
+	}
+	if !cfg.NamespacedRBAC {
+		if err := mgr.AddReadyzCheck("ingress-class", health.IngressClass(apiReader, targets.IngressClass)); err != nil {
+			return err
+		}
+	}
+	var owns func(namespace string) bool
+	if membership != nil {
+		owns = membership.Owns
+	}
+	if err := mgr.AddReadyzCheck("tls-secret", health.IngressSecrets(mgr.GetClient(), apiReader, pod.ManagedLabels(""), owns)); err != nil {
+		return err
+	}
+	if membership != nil {
+		if err := mgr.AddReadyzCheck("shard", membership.ReadinessCheck); err != nil {
+			return err
+		}
+	}
+	return mgr.AddHealthzCheck("ttl-sweep", ttlWatcher.LivenessCheck)
+}
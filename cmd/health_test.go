@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fgtech/ia/cursor/controllers"
+)
+
+func TestProbeTargetsFollowOperatorConfig(t *testing.T) {
+	p := newProbeTargets(controllers.OperatorConfig{IngressClassName: "nginx"})
+	if p.IngressClass() != "nginx" {
+		t.Fatalf("unexpected ingress class %q", p.IngressClass())
+	}
+
+	p.Reconfigure(controllers.OperatorConfig{IngressClassName: "traefik"})
+	if p.IngressClass() != "traefik" {
+		t.Fatalf("ingress class not reconfigured: %q", p.IngressClass())
+	}
+}
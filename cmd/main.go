@@ -1,18 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"strconv"
+	"strings"
+	"time"
 
 	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
 	"github.com/fgtech/ia/cursor/controllers"
+	"github.com/fgtech/ia/cursor/pkg/activator"
+	"github.com/fgtech/ia/cursor/pkg/archive"
+	"github.com/fgtech/ia/cursor/pkg/audit"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/ingress"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/fgtech/ia/cursor/pkg/notify"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/fgtech/ia/cursor/pkg/shard"
+	"github.com/fgtech/ia/cursor/pkg/tracing"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
@@ -20,123 +41,440 @@ var (
 	scheme = runtime.NewScheme()
 )
 
-type envConfig struct {
-	IngressHost           string
-	IngressTLSSecret      string
-	IngressClassName      string
-	DefaultTTLSeconds     int64
-	DefaultServiceAccount string
-	PodPort               int32
-}
-
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(fgtechv1.AddToScheme(scheme))
 }
 
 func main() {
-	var metricsAddr string
-	var healthProbeAddr string
-	var enableLeaderElection bool
+	cfg, opts, err := loadConfig(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if opts.PrintConfig {
+		if err := printConfig(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&healthProbeAddr, "health-probe-bind-address", ":8081", "The address the health probe endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager.")
-	flag.Parse()
+	ctrl.SetLogger(newLogger(cfg.LogFormat))
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	if opts.RestoreRef != "" {
+		if err := runRestore(cfg, opts.RestoreRef, opts.RestoreTTLSeconds); err != nil {
+			ctrl.Log.Error(err, "restore failed", "entry", opts.RestoreRef)
+			os.Exit(1)
+		}
+		return
+	}
 
-	envCfg, err := loadEnvConfig()
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter: cfg.TracingExporter,
+		Endpoint: cfg.TracingEndpoint,
+		Insecure: cfg.TracingInsecure,
+	})
 	if err != nil {
-		ctrl.Log.Error(err, "invalid environment configuration")
+		ctrl.Log.Error(err, "unable to configure tracing", "exporter", cfg.TracingExporter)
 		os.Exit(1)
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig := ctrl.GetConfigOrDie()
+	namespaces := cfg.WatchNamespaces
+	var apiReader client.Reader
+	if cfg.WatchNamespaceSelector != "" {
+		if apiReader, err = client.New(restConfig, client.Options{Scheme: scheme}); err == nil {
+			namespaces, err = resolveNamespaces(context.Background(), apiReader, cfg)
+		}
+		if err != nil {
+			ctrl.Log.Error(err, "unable to resolve watched namespaces", "selector", cfg.WatchNamespaceSelector)
+			os.Exit(1)
+		}
+		ctrl.Log.Info("watching selected namespaces", "selector", cfg.WatchNamespaceSelector, "namespaces", namespaces)
+	}
+
+	// The recycle bin is only read on expiry; caching every ConfigMap
+	// of the cluster for it is not worth the memory.
+	uncached := []client.Object{&corev1.ConfigMap{}}
+	if cfg.NamespacedRBAC {
+		// Roles cannot grant list/watch on Namespaces; each one is read on
+		// its own with the get a Role in that namespace grants.
+		uncached = append(uncached, &corev1.Namespace{})
+	}
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme: scheme,
+		Client: client.Options{
+			Cache: &client.CacheOptions{DisableFor: uncached},
+		},
+		Cache: cacheOptions(cfg, namespaces),
 		Metrics: metricsserver.Options{
-			BindAddress: metricsAddr,
+			BindAddress: cfg.MetricsAddr,
 		},
-		HealthProbeBindAddress: healthProbeAddr,
-		LeaderElection:         enableLeaderElection,
+		HealthProbeBindAddress: cfg.HealthProbeAddr,
+		LeaderElection:         cfg.LeaderElect,
 		LeaderElectionID:       "fgtech-operator",
 	})
 	if err != nil {
 		ctrl.Log.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	if apiReader != nil {
+		selection := &namespaceSelectionWatcher{
+			reader:   apiReader,
+			log:      ctrl.Log.WithName("namespaces"),
+			cfg:      cfg,
+			current:  namespaces,
+			interval: namespaceSelectorPollInterval,
+			backoff:  namespaceRestartBackoff,
+		}
+		if err := mgr.Add(selection); err != nil {
+			ctrl.Log.Error(err, "unable to start namespace selection watcher")
+			os.Exit(1)
+		}
+		if len(namespaces) == 0 {
+			// The controllers would watch every namespace: only the probes
+			// and the watcher run until a namespace matches.
+			if err := mgr.AddReadyzCheck("namespaces", selection.ReadinessCheck); err != nil {
+				ctrl.Log.Error(err, "unable to set up health checks")
+				os.Exit(1)
+			}
+			runManager(mgr, shutdownTracing)
+			return
+		}
+	}
+
+	if err := ingress.IndexFields(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		ctrl.Log.Error(err, "unable to register field indexes")
+		os.Exit(1)
+	}
+	var classReader client.Reader = mgr.GetClient()
+	if cfg.NamespacedRBAC {
+		classReader = nil
+	}
+	instanceClasses := class.NewResolver(classReader, class.Defaults{})
+	ctrlmetrics.Registry.MustRegister(metrics.NewInstanceCollector(mgr.GetClient(), instanceClasses, ctrl.Log.WithName("metrics"), nil))
+
+	var sinks []notify.Sink
+	for _, url := range cfg.NotifyWebhooks {
+		sinks = append(sinks, notify.NewWebhookSink(url))
+	}
+	notifier := notify.NewDispatcher(ctrl.Log.WithName("notify"), sinks...)
+	if err := mgr.Add(notifier); err != nil {
+		ctrl.Log.Error(err, "unable to start notification dispatcher")
+		os.Exit(1)
+	}
+
+	auditor, err := newAuditor(cfg)
+	if err != nil {
+		ctrl.Log.Error(err, "unable to configure audit sinks")
+		os.Exit(1)
+	}
+	if err := mgr.Add(auditor); err != nil {
+		ctrl.Log.Error(err, "unable to start audit dispatcher")
+		os.Exit(1)
+	}
+
+	archiver, err := newArchiver(mgr.GetClient(), cfg)
+	if err != nil {
+		ctrl.Log.Error(err, "unable to configure archive store")
+		os.Exit(1)
+	}
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		ctrl.Log.Error(err, "unable to create kubernetes clientset")
+		os.Exit(1)
+	}
+
+	fallback := cfg.operatorConfig()
+	opCfg := fallback
+	if !cfg.NamespacedRBAC {
+		if opCfg, _, err = controllers.LoadOperatorConfig(context.Background(), mgr.GetAPIReader(), fallback); err != nil {
+			ctrl.Log.Error(err, "unable to read FgtechOperatorConfig")
+			os.Exit(1)
+		}
+		if err := opCfg.Validate(); err != nil {
+			ctrl.Log.Error(err, "invalid FgtechOperatorConfig, falling back to the environment")
+			opCfg = fallback
+		}
+	}
+	if err := opCfg.Validate(); err != nil {
+		ctrl.Log.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+
+	// The reconcilers trace their API calls along with their own spans.
+	tracedClient := mgr.GetClient()
+	if cfg.TracingExporter != tracing.ExporterNone {
+		tracedClient = tracing.Client(tracedClient)
+	}
 
-	if err = (&controllers.FgtechReconciler{
-		Client:            mgr.GetClient(),
-		Scheme:            mgr.GetScheme(),
-		Log:               ctrl.Log.WithName("controllers").WithName("Fgtech"),
-		IngressHost:       envCfg.IngressHost,
-		IngressTLSSecret:  envCfg.IngressTLSSecret,
-		IngressClassName:  envCfg.IngressClassName,
-		DefaultTTLSeconds: envCfg.DefaultTTLSeconds,
-		DefaultSA:         envCfg.DefaultServiceAccount,
-		DefaultPodPort:    envCfg.PodPort,
-	}).SetupWithManager(mgr); err != nil {
+	membership, err := newMembership(mgr, cfg)
+	if err != nil {
+		ctrl.Log.Error(err, "unable to set up sharding")
+		os.Exit(1)
+	}
+	// A nil *shard.Membership must not become a non-nil Sharder.
+	var sharder controllers.Sharder
+	if membership != nil {
+		sharder = membership
+	}
+
+	recorder := mgr.GetEventRecorderFor("fgtech-operator")
+	ingressSync := &controllers.IngressSyncReconciler{
+		Client:                  tracedClient,
+		Log:                     ctrl.Log.WithName("controllers").WithName("IngressSync"),
+		IngressHost:             opCfg.IngressHost,
+		IngressTLSSecret:        opCfg.IngressTLSSecret,
+		IngressClassName:        opCfg.IngressClassName,
+		ActivatorHost:           opCfg.ActivatorHost,
+		Recorder:                recorder,
+		NamespacedRBAC:          cfg.NamespacedRBAC,
+		Delay:                   cfg.IngressSyncDelay,
+		MaxConcurrentReconciles: cfg.MaxConcurrentReconciles,
+		RateLimit:               cfg.RateLimit,
+		Shard:                   sharder,
+	}
+	if err = ingressSync.SetupWithManager(mgr); err != nil {
+		ctrl.Log.Error(err, "unable to create controller", "controller", "IngressSync")
+		os.Exit(1)
+	}
+
+	reconciler := &controllers.FgtechReconciler{
+		Client:                  tracedClient,
+		Scheme:                  mgr.GetScheme(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("Fgtech"),
+		IngressHost:             opCfg.IngressHost,
+		IngressTLSSecret:        opCfg.IngressTLSSecret,
+		IngressClassName:        opCfg.IngressClassName,
+		DefaultTTLSeconds:       opCfg.DefaultTTLSeconds,
+		DefaultSA:               opCfg.DefaultSA,
+		DefaultPodPort:          opCfg.DefaultPodPort,
+		ActivatorHost:           opCfg.ActivatorHost,
+		MaxLifetime:             opCfg.MaxLifetime,
+		ExpiryWarnings:          opCfg.ExpiryWarnings,
+		DefaultExpiryPolicy:     opCfg.ExpiryPolicy,
+		Recorder:                recorder,
+		Notifier:                notifier,
+		Auditor:                 auditor,
+		Archiver:                archiver,
+		LogFetcher:              pod.ClientsetLogFetcher{Client: clientset},
+		IngressSync:             ingressSync,
+		MaxConcurrentReconciles: cfg.MaxConcurrentReconciles,
+		RateLimit:               cfg.RateLimit,
+		NamespacedRBAC:          cfg.NamespacedRBAC,
+		Shard:                   sharder,
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		ctrl.Log.Error(err, "unable to create controller", "controller", "Fgtech")
 		os.Exit(1)
 	}
 
-	if err := mgr.Add(controllers.NewTTLWatcher(
-		mgr.GetClient(),
+	ttlWatcher := controllers.NewTTLWatcher(
+		tracedClient,
 		ctrl.Log.WithName("ttlwatcher"),
-		envCfg.DefaultTTLSeconds,
-		envCfg.IngressHost,
-		envCfg.IngressTLSSecret,
-		envCfg.IngressClassName,
-	)); err != nil {
+		controllers.TTLWatcherOptions{
+			Interval:            opCfg.TTLSweepInterval,
+			DefaultTTLSeconds:   opCfg.DefaultTTLSeconds,
+			IngressHost:         opCfg.IngressHost,
+			IngressTLSSecret:    opCfg.IngressTLSSecret,
+			IngressClassName:    opCfg.IngressClassName,
+			ActivatorHost:       opCfg.ActivatorHost,
+			DefaultExpiryPolicy: opCfg.ExpiryPolicy,
+			Notifier:            notifier,
+			Recorder:            recorder,
+			Archiver:            archiver,
+			Namespaces:          namespaces,
+			NamespacedRBAC:      cfg.NamespacedRBAC,
+			IngressSync:         ingressSync,
+			Shard:               sharder,
+		},
+	)
+	if err := mgr.Add(ttlWatcher); err != nil {
 		ctrl.Log.Error(err, "unable to start ttl watcher")
 		os.Exit(1)
 	}
 
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		ctrl.Log.Error(err, "problem running manager")
+	probes := newProbeTargets(opCfg)
+	if err := addHealthChecks(mgr, cfg, mgr.GetAPIReader(), clientset.Discovery().RESTClient(), probes, ttlWatcher, membership); err != nil {
+		ctrl.Log.Error(err, "unable to set up health checks")
 		os.Exit(1)
 	}
+
+	if !cfg.NamespacedRBAC {
+		if err = (&controllers.OperatorConfigReconciler{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("controllers").WithName("OperatorConfig"),
+			Recorder:    recorder,
+			Fallback:    fallback,
+			Current:     opCfg,
+			Targets:     []controllers.Reconfigurable{reconciler, ttlWatcher, ingressSync, probes},
+			IngressSync: ingressSync,
+		}).SetupWithManager(mgr); err != nil {
+			ctrl.Log.Error(err, "unable to create controller", "controller", "OperatorConfig")
+			os.Exit(1)
+		}
+	}
+
+	if cfg.ActivatorAddr != "0" {
+		if err := mgr.Add(activator.New(mgr.GetClient(), ctrl.Log.WithName("activator"), activator.Options{
+			BindAddress: cfg.ActivatorAddr,
+		})); err != nil {
+			ctrl.Log.Error(err, "unable to start activator")
+			os.Exit(1)
+		}
+	}
+
+	runManager(mgr, shutdownTracing)
+}
+
+// runManager runs mgr until it stops and flushes the pending spans. A change
+// of the selected namespaces is a clean exit: the kubelet restarts the
+// operator, which then watches the new set.
+func runManager(mgr ctrl.Manager, shutdownTracing func(context.Context) error) {
+	runErr := mgr.Start(ctrl.SetupSignalHandler())
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		ctrl.Log.Error(err, "unable to flush spans")
+	}
+	if errors.Is(runErr, errNamespacesChanged) {
+		ctrl.Log.Info("restarting for the new watched namespaces", "change", runErr.Error())
+		return
+	}
+	if runErr != nil {
+		ctrl.Log.Error(runErr, "problem running manager")
+		os.Exit(1)
+	}
+}
+
+// tracingShutdownTimeout bounds the flush of the pending spans on exit.
+const tracingShutdownTimeout = 5 * time.Second
+
+// newMembership adds the shard membership to mgr when sharding is on; it
+// returns nil otherwise.
+func newMembership(mgr ctrl.Manager, cfg managerConfig) (*shard.Membership, error) {
+	if !cfg.Sharding {
+		return nil, nil
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	membership := shard.New(mgr.GetClient(), mgr.GetAPIReader(), ctrl.Log.WithName("shard"), shard.Options{
+		Namespace: cfg.OperatorNamespace,
+		Group:     "fgtech-operator",
+		Identity:  identity,
+	})
+	if err := mgr.Add(membership); err != nil {
+		return nil, err
+	}
+	return membership, nil
 }
 
-func loadEnvConfig() (envConfig, error) {
-	cfg := envConfig{
-		IngressHost:           os.Getenv("FGTECH_INGRESS_FQDN"),
-		IngressTLSSecret:      os.Getenv("FGTECH_INGRESS_TLS_SECRET"),
-		IngressClassName:      os.Getenv("FGTECH_INGRESS_CLASSNAME"),
-		DefaultServiceAccount: os.Getenv("FGTECH_POD_SERVICEACCOUNT"),
-		DefaultTTLSeconds:     int64(3600),
-		PodPort:               8080,
+const (
+	archiveStoreConfigMap = "configmap"
+	archiveStoreS3        = "s3"
+	archiveStoreNone      = "none"
+)
+
+// newArchiveStore builds the configured archive store; nil means archiving is disabled.
+func newArchiveStore(c client.Client, cfg managerConfig) (archive.Store, error) {
+	switch cfg.ArchiveStore {
+	case archiveStoreNone:
+		return nil, nil
+	case archiveStoreS3:
+		return archive.NewS3Store(cfg.ArchiveS3)
+	default:
+		return archive.NewConfigMapStore(c), nil
 	}
+}
 
-	if cfg.IngressHost == "" {
-		return cfg, fmt.Errorf("FGTECH_INGRESS_FQDN missing")
+func newArchiver(c client.Client, cfg managerConfig) (*archive.Archiver, error) {
+	store, err := newArchiveStore(c, cfg)
+	if err != nil || store == nil {
+		return nil, err
 	}
-	if cfg.IngressClassName == "" {
-		return cfg, fmt.Errorf("FGTECH_INGRESS_CLASSNAME missing")
+	return &archive.Archiver{
+		Client:          c,
+		Store:           store,
+		Retention:       cfg.ArchiveRetention,
+		IncludeWorkload: cfg.ArchiveIncludeWorkload,
+	}, nil
+}
+
+// runRestore recreates the Fgtech held by the archive entry ref (<namespace>/<id>).
+func runRestore(cfg managerConfig, ref string, ttlSeconds int64) error {
+	namespace, id, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || id == "" {
+		return fmt.Errorf("restore expects <namespace>/<id>, got %q", ref)
 	}
-	if cfg.IngressTLSSecret == "" {
-		cfg.IngressTLSSecret = "fgtech-tls"
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	store, err := newArchiveStore(c, cfg)
+	if err != nil {
+		return err
 	}
-	if cfg.DefaultServiceAccount == "" {
-		cfg.DefaultServiceAccount = "default"
+	if store == nil {
+		return fmt.Errorf("archiving is disabled (FGTECH_ARCHIVE_STORE=none)")
+	}
+
+	fg, err := archive.Restore(context.Background(), c, store, namespace, id, ttlSeconds)
+	if err != nil {
+		return err
 	}
+	ctrl.Log.Info("fgtech restored", "namespace", fg.Namespace, "name", fg.Name, "entry", id)
+	return nil
+}
 
-	if v := os.Getenv("FGTECH_DEFAULT_TTL_SECONDS"); v != "" {
-		parsed, err := strconv.ParseInt(v, 10, 64)
-		if err != nil || parsed <= 0 {
-			return cfg, fmt.Errorf("invalid FGTECH_DEFAULT_TTL_SECONDS: %s", v)
+// cacheOptions restricts the manager cache to the watched namespaces; nil
+// watches every namespace. Of the Pods, Services, Jobs and Ingresses, only
+// the ones the operator created are cached.
+func cacheOptions(cfg managerConfig, namespaces []string) cache.Options {
+	managed := cache.ByObject{Label: pod.ManagedSelector()}
+	opts := cache.Options{
+		SyncPeriod: &cfg.SyncPeriod,
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Pod{}:           managed,
+			&corev1.Service{}:       managed,
+			&batchv1.Job{}:          managed,
+			&networkingv1.Ingress{}: managed,
+		},
+	}
+	if len(namespaces) > 0 {
+		opts.DefaultNamespaces = make(map[string]cache.Config, len(namespaces))
+		for _, ns := range namespaces {
+			opts.DefaultNamespaces[ns] = cache.Config{}
 		}
-		cfg.DefaultTTLSeconds = parsed
 	}
+	return opts
+}
 
-	if v := os.Getenv("FGTECH_POD_PORT"); v != "" {
-		parsed, err := strconv.ParseInt(v, 10, 32)
-		if err != nil || parsed <= 0 || parsed > 65535 {
-			return cfg, fmt.Errorf("invalid FGTECH_POD_PORT: %s", v)
+// newAuditor opens the sinks of cfg.AuditSinks; without any, the dispatcher
+// drops every record.
+func newAuditor(cfg managerConfig) (*audit.Dispatcher, error) {
+	file := audit.FileOptions{MaxBytes: cfg.AuditFileMaxSizeMB << 20, MaxBackups: int(cfg.AuditFileMaxBackups)}
+	var sinks []audit.Sink
+	for _, spec := range cfg.AuditSinks {
+		sink, err := audit.NewSink(spec, file)
+		if err != nil {
+			return nil, err
 		}
-		cfg.PodPort = int32(parsed)
+		sinks = append(sinks, sink)
 	}
+	return audit.NewDispatcher(ctrl.Log.WithName("audit"), sinks...), nil
+}
 
-	return cfg, nil
+func newLogger(format string) logr.Logger {
+	if format == logFormatJSON {
+		return zap.New(zap.UseDevMode(false))
+	}
+	return zap.New(zap.UseDevMode(true))
 }
@@ -1,20 +1,61 @@
 package main
 
 import (
+	"bytes"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestLoadEnvConfigDefaults(t *testing.T) {
-	clearEnv(t)
-	os.Setenv("FGTECH_INGRESS_FQDN", "apps.example.com")
-	os.Setenv("FGTECH_INGRESS_CLASSNAME", "nginx")
+func envOf(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	return path
+}
 
-	cfg, err := loadEnvConfig()
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, opts, err := loadConfig(nil, envOf(map[string]string{
+		"FGTECH_INGRESS_FQDN":      "apps.example.com",
+		"FGTECH_INGRESS_CLASSNAME": "nginx",
+	}))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	if opts != (cliOptions{}) {
+		t.Fatalf("options = %+v, want none", opts)
+	}
+	if cfg.MetricsAddr != ":8080" || cfg.HealthProbeAddr != ":8081" || cfg.ActivatorAddr != ":8082" {
+		t.Fatalf("unexpected bind addresses %s %s %s", cfg.MetricsAddr, cfg.HealthProbeAddr, cfg.ActivatorAddr)
+	}
+	if cfg.LeaderElect {
+		t.Fatalf("LeaderElect = true, want false")
+	}
+	if cfg.MaxConcurrentReconciles != 1 {
+		t.Fatalf("MaxConcurrentReconciles = %d, want 1", cfg.MaxConcurrentReconciles)
+	}
+	if cfg.SyncPeriod != 10*time.Hour {
+		t.Fatalf("SyncPeriod = %s, want 10h", cfg.SyncPeriod)
+	}
+	if len(cfg.WatchNamespaces) != 0 {
+		t.Fatalf("WatchNamespaces = %v, want all namespaces", cfg.WatchNamespaces)
+	}
+	if cfg.LogFormat != "console" {
+		t.Fatalf("LogFormat = %s, want console", cfg.LogFormat)
+	}
 	if cfg.IngressHost != "apps.example.com" {
 		t.Fatalf("IngressHost = %s, want apps.example.com", cfg.IngressHost)
 	}
@@ -33,18 +74,47 @@ func TestLoadEnvConfigDefaults(t *testing.T) {
 	if cfg.PodPort != 8080 {
 		t.Fatalf("PodPort = %d, want 8080", cfg.PodPort)
 	}
+	if cfg.TTLSweepInterval != 10*time.Minute {
+		t.Fatalf("TTLSweepInterval = %s, want 10m", cfg.TTLSweepInterval)
+	}
+	if cfg.MaxLifetime != 0 {
+		t.Fatalf("MaxLifetime = %s, want unbounded", cfg.MaxLifetime)
+	}
+	if len(cfg.ExpiryWarnings) != 2 || cfg.ExpiryWarnings[0] != time.Hour || cfg.ExpiryWarnings[1] != 10*time.Minute {
+		t.Fatalf("ExpiryWarnings = %v, want [1h 10m]", cfg.ExpiryWarnings)
+	}
+	if len(cfg.NotifyWebhooks) != 0 {
+		t.Fatalf("NotifyWebhooks = %v, want none", cfg.NotifyWebhooks)
+	}
+	if cfg.ExpiryPolicy != "delete" {
+		t.Fatalf("ExpiryPolicy = %s, want delete", cfg.ExpiryPolicy)
+	}
+	if cfg.ArchiveStore != "configmap" {
+		t.Fatalf("ArchiveStore = %s, want configmap", cfg.ArchiveStore)
+	}
+	if cfg.ArchiveRetention != 7*24*time.Hour {
+		t.Fatalf("ArchiveRetention = %s, want 168h", cfg.ArchiveRetention)
+	}
+	if cfg.ArchiveIncludeWorkload {
+		t.Fatalf("ArchiveIncludeWorkload = true, want false")
+	}
 }
 
-func TestLoadEnvConfigOverrides(t *testing.T) {
-	clearEnv(t)
-	os.Setenv("FGTECH_INGRESS_FQDN", "apps.example.com")
-	os.Setenv("FGTECH_INGRESS_TLS_SECRET", "custom-tls")
-	os.Setenv("FGTECH_INGRESS_CLASSNAME", "nginx-custom")
-	os.Setenv("FGTECH_DEFAULT_TTL_SECONDS", "7200")
-	os.Setenv("FGTECH_POD_SERVICEACCOUNT", "sa-custom")
-	os.Setenv("FGTECH_POD_PORT", "9090")
-
-	cfg, err := loadEnvConfig()
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	cfg, _, err := loadConfig(nil, envOf(map[string]string{
+		"FGTECH_INGRESS_FQDN":        "apps.example.com",
+		"FGTECH_INGRESS_TLS_SECRET":  "custom-tls",
+		"FGTECH_INGRESS_CLASSNAME":   "nginx-custom",
+		"FGTECH_DEFAULT_TTL_SECONDS": "7200",
+		"FGTECH_POD_SERVICEACCOUNT":  "sa-custom",
+		"FGTECH_POD_PORT":            "9090",
+		"FGTECH_TTL_SWEEP_INTERVAL":  "30m",
+		"FGTECH_MAX_LIFETIME":        "72h",
+		"FGTECH_EXPIRY_WARNINGS":     "30m, 5m",
+		"FGTECH_NOTIFY_WEBHOOKS":     "http://chat-bridge/hook,http://audit/hook",
+		"FGTECH_EXPIRY_POLICY":       "hibernate",
+		"FGTECH_ACTIVATOR_SERVICE":   "fgtech-activator.fgtech-system.svc.cluster.local",
+	}))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -64,47 +134,310 @@ func TestLoadEnvConfigOverrides(t *testing.T) {
 	if cfg.IngressClassName != "nginx-custom" {
 		t.Fatalf("IngressClassName = %s, want nginx-custom", cfg.IngressClassName)
 	}
+	if cfg.TTLSweepInterval != 30*time.Minute {
+		t.Fatalf("TTLSweepInterval = %s, want 30m", cfg.TTLSweepInterval)
+	}
+	if cfg.MaxLifetime != 72*time.Hour {
+		t.Fatalf("MaxLifetime = %s, want 72h", cfg.MaxLifetime)
+	}
+	if len(cfg.ExpiryWarnings) != 2 || cfg.ExpiryWarnings[0] != 30*time.Minute || cfg.ExpiryWarnings[1] != 5*time.Minute {
+		t.Fatalf("ExpiryWarnings = %v, want [30m 5m]", cfg.ExpiryWarnings)
+	}
+	if len(cfg.NotifyWebhooks) != 2 || cfg.NotifyWebhooks[1] != "http://audit/hook" {
+		t.Fatalf("NotifyWebhooks = %v", cfg.NotifyWebhooks)
+	}
+	if cfg.ExpiryPolicy != "hibernate" {
+		t.Fatalf("ExpiryPolicy = %s, want hibernate", cfg.ExpiryPolicy)
+	}
+	if cfg.ActivatorHost != "fgtech-activator.fgtech-system.svc.cluster.local" {
+		t.Fatalf("ActivatorHost = %s", cfg.ActivatorHost)
+	}
 }
 
-func TestLoadEnvConfigMissingHost(t *testing.T) {
-	clearEnv(t)
-	if _, err := loadEnvConfig(); err == nil {
-		t.Fatalf("expected error for missing FGTECH_INGRESS_FQDN")
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := `
+ingressFQDN: file.example.com
+ingressClassName: file-class
+defaultTTLSeconds: 600
+podPort: 9000
+leaderElect: true
+expiryWarnings: [15m, 1m]
+watchNamespaces:
+  - team-a
+  - team-b
+`
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		check func(managerConfig) bool
+	}{
+		{
+			name: "file only",
+			file: file,
+			check: func(c managerConfig) bool {
+				return c.IngressHost == "file.example.com" && c.DefaultTTLSeconds == 600 && c.LeaderElect
+			},
+		},
+		{
+			name: "file lists",
+			file: file,
+			check: func(c managerConfig) bool {
+				return reflect.DeepEqual(c.WatchNamespaces, []string{"team-a", "team-b"}) && len(c.ExpiryWarnings) == 2
+			},
+		},
+		{
+			name: "env overrides file",
+			file: file,
+			env:  map[string]string{"FGTECH_INGRESS_FQDN": "env.example.com"},
+			check: func(c managerConfig) bool {
+				return c.IngressHost == "env.example.com" && c.IngressClassName == "file-class"
+			},
+		},
+		{
+			name:  "flag overrides env and file",
+			file:  file,
+			env:   map[string]string{"FGTECH_POD_PORT": "9100"},
+			args:  []string{"--pod-port=9200"},
+			check: func(c managerConfig) bool { return c.PodPort == 9200 },
+		},
+		{
+			name:  "flag overrides file",
+			file:  file,
+			args:  []string{"--leader-elect=false", "--default-ttl-seconds", "60"},
+			check: func(c managerConfig) bool { return !c.LeaderElect && c.DefaultTTLSeconds == 60 },
+		},
+		{
+			name:  "boolean flag without value",
+			args:  []string{"--leader-elect"},
+			check: func(c managerConfig) bool { return c.LeaderElect },
+		},
+		{
+			name:  "empty env variable is ignored",
+			file:  file,
+			env:   map[string]string{"FGTECH_INGRESS_FQDN": ""},
+			check: func(c managerConfig) bool { return c.IngressHost == "file.example.com" },
+		},
+		{
+			name:  "empty warnings disable them",
+			file:  file,
+			env:   map[string]string{"FGTECH_EXPIRY_WARNINGS": ""},
+			check: func(c managerConfig) bool { return len(c.ExpiryWarnings) == 0 },
+		},
+		{
+			name: "manager settings",
+			args: []string{"--max-concurrent-reconciles=4", "--sync-period=1h", "--log-format=json", "--watch-namespaces=team-c", "--ingress-sync-delay=0s"},
+			check: func(c managerConfig) bool {
+				return c.MaxConcurrentReconciles == 4 && c.SyncPeriod == time.Hour && c.LogFormat == "json" && c.WatchNamespaces[0] == "team-c" &&
+					c.IngressSyncDelay == 0
+			},
+		},
+		{
+			name: "namespace scope",
+			file: file,
+			env:  map[string]string{"FGTECH_WATCH_NAMESPACE_SELECTOR": "fgtech.io/enabled=true"},
+			check: func(c managerConfig) bool {
+				return c.WatchNamespaceSelector == "fgtech.io/enabled=true" && !c.NamespacedRBAC
+			},
+		},
+		{
+			name:  "namespaced RBAC",
+			file:  file,
+			args:  []string{"--namespaced-rbac"},
+			check: func(c managerConfig) bool { return c.NamespacedRBAC && len(c.WatchNamespaces) == 2 },
+		},
+		{
+			name: "audit sinks",
+			env:  map[string]string{"FGTECH_AUDIT_SINKS": "stdout, file:/var/log/fgtech/audit.log"},
+			args: []string{"--audit-file-max-backups=0"},
+			check: func(c managerConfig) bool {
+				return len(c.AuditSinks) == 2 && c.AuditSinks[1] == "file:/var/log/fgtech/audit.log" &&
+					c.AuditFileMaxSizeMB == 100 && c.AuditFileMaxBackups == 0
+			},
+		},
+		{
+			name:  "operator namespace",
+			env:   map[string]string{"FGTECH_OPERATOR_NAMESPACE": "fgtech-system"},
+			check: func(c managerConfig) bool { return c.OperatorNamespace == "fgtech-system" },
+		},
+		{
+			name:  "sharding",
+			env:   map[string]string{"FGTECH_OPERATOR_NAMESPACE": "fgtech-system", "FGTECH_SHARDING": "true"},
+			check: func(c managerConfig) bool { return c.Sharding && !c.LeaderElect },
+		},
+		{
+			name: "rate limit",
+			env:  map[string]string{"FGTECH_RATE_LIMIT_QPS": "2.5", "FGTECH_RATE_LIMIT_MAX_DELAY": "5m"},
+			args: []string{"--rate-limit-base-delay=1s", "--rate-limit-burst=20"},
+			check: func(c managerConfig) bool {
+				l := c.RateLimit
+				return l.BaseDelay == time.Second && l.MaxDelay == 5*time.Minute && l.QPS == 2.5 && l.Burst == 20
+			},
+		},
+		{
+			name: "otlp tracing",
+			env:  map[string]string{"FGTECH_TRACING_EXPORTER": "otlp", "FGTECH_TRACING_ENDPOINT": "otel-collector:4318"},
+			args: []string{"--tracing-insecure"},
+			check: func(c managerConfig) bool {
+				return c.TracingExporter == "otlp" && c.TracingEndpoint == "otel-collector:4318" && c.TracingInsecure
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"--config", writeConfigFile(t, tt.file)}, args...)
+			}
+			cfg, _, err := loadConfig(args, envOf(tt.env))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Fatalf("unexpected config %+v", cfg)
+			}
+		})
 	}
 }
 
-func TestLoadEnvConfigMissingClass(t *testing.T) {
-	clearEnv(t)
-	os.Setenv("FGTECH_INGRESS_FQDN", "apps.example.com")
-	if _, err := loadEnvConfig(); err == nil {
-		t.Fatalf("expected error for missing FGTECH_INGRESS_CLASSNAME")
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{name: "bad TTL", env: map[string]string{"FGTECH_DEFAULT_TTL_SECONDS": "-1"}, want: []string{"FGTECH_DEFAULT_TTL_SECONDS"}},
+		{name: "bad port", env: map[string]string{"FGTECH_POD_PORT": "0"}, want: []string{"FGTECH_POD_PORT"}},
+		{name: "bad sweep interval", env: map[string]string{"FGTECH_TTL_SWEEP_INTERVAL": "soon"}, want: []string{"FGTECH_TTL_SWEEP_INTERVAL"}},
+		{name: "bad expiry policy", env: map[string]string{"FGTECH_EXPIRY_POLICY": "shred"}, want: []string{"FGTECH_EXPIRY_POLICY"}},
+		{name: "bad archive store", env: map[string]string{"FGTECH_ARCHIVE_STORE": "tape"}, want: []string{"FGTECH_ARCHIVE_STORE"}},
+		{name: "bad log format", args: []string{"--log-format=xml"}, want: []string{"--log-format"}},
+		{name: "bad concurrency", args: []string{"--max-concurrent-reconciles=0"}, want: []string{"--max-concurrent-reconciles"}},
+		{name: "bad rate limit qps", env: map[string]string{"FGTECH_RATE_LIMIT_QPS": "0"}, want: []string{"FGTECH_RATE_LIMIT_QPS"}},
+		{name: "rate limit base above max", args: []string{"--rate-limit-base-delay=10m", "--rate-limit-max-delay=1m"}, want: []string{"rateLimitBaseDelay must not exceed"}},
+		{name: "bad audit sink", env: map[string]string{"FGTECH_AUDIT_SINKS": "syslog"}, want: []string{"FGTECH_AUDIT_SINKS"}},
+		{name: "sharding with leader election", args: []string{"--sharding", "--leader-elect", "--operator-namespace=fgtech-system"}, want: []string{"sharding replaces leaderElect"}},
+		{name: "sharding without namespace", env: map[string]string{"FGTECH_SHARDING": "true"}, want: []string{"sharding requires operatorNamespace"}},
+		{name: "bad tracing exporter", args: []string{"--tracing-exporter=jaeger"}, want: []string{"--tracing-exporter"}},
+		{name: "unknown flag", args: []string{"--ingress-host=x"}, want: []string{"ingress-host"}},
+		{name: "bad namespace selector", args: []string{"--watch-namespace-selector=a in (b"}, want: []string{"--watch-namespace-selector"}},
+		{name: "namespaced RBAC without namespaces", env: map[string]string{"FGTECH_NAMESPACED_RBAC": "true"}, want: []string{"namespacedRBAC requires watchNamespaces"}},
+		{
+			name: "namespaced RBAC with selector",
+			args: []string{"--namespaced-rbac", "--watch-namespaces=team-a", "--watch-namespace-selector=fgtech.io/enabled"},
+			want: []string{"cannot be combined with namespacedRBAC"},
+		},
+		{name: "unknown file key", file: "ingressHost: x\n", want: []string{"unknown key ingressHost"}},
+		{name: "bad file value", file: "podPort: http\n", want: []string{"podPort"}},
+		{
+			name: "aggregated",
+			file: "defaultTTLSeconds: 0\n",
+			env:  map[string]string{"FGTECH_POD_PORT": "70000"},
+			args: []string{"--sync-period=never"},
+			want: []string{"defaultTTLSeconds", "FGTECH_POD_PORT", "--sync-period"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"--config", writeConfigFile(t, tt.file)}, args...)
+			}
+			_, _, err := loadConfig(args, envOf(tt.env))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("error %q does not mention %s", err.Error(), want)
+				}
+			}
+		})
 	}
 }
 
-func TestLoadEnvConfigBadTTL(t *testing.T) {
-	clearEnv(t)
-	os.Setenv("FGTECH_INGRESS_FQDN", "apps.example.com")
-	os.Setenv("FGTECH_DEFAULT_TTL_SECONDS", "-1")
-	if _, err := loadEnvConfig(); err == nil {
-		t.Fatalf("expected error for invalid FGTECH_DEFAULT_TTL_SECONDS")
+func TestLoadConfigRequiresHostAndClass(t *testing.T) {
+	cfg, _, err := loadConfig(nil, envOf(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cfg.operatorConfig().Validate(); err == nil {
+		t.Fatalf("expected error for missing FGTECH_INGRESS_FQDN")
+	}
+
+	cfg, _, _ = loadConfig(nil, envOf(map[string]string{"FGTECH_INGRESS_FQDN": "apps.example.com"}))
+	if err := cfg.operatorConfig().Validate(); err == nil {
+		t.Fatalf("expected error for missing FGTECH_INGRESS_CLASSNAME")
+	}
+
+	cfg, _, _ = loadConfig(nil, envOf(map[string]string{"FGTECH_INGRESS_FQDN": "apps.example.com", "FGTECH_INGRESS_CLASSNAME": "nginx"}))
+	if err := cfg.operatorConfig().Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
 }
 
-func TestLoadEnvConfigBadPort(t *testing.T) {
-	clearEnv(t)
-	os.Setenv("FGTECH_INGRESS_FQDN", "apps.example.com")
-	os.Setenv("FGTECH_POD_PORT", "0")
-	if _, err := loadEnvConfig(); err == nil {
-		t.Fatalf("expected error for invalid FGTECH_POD_PORT")
+func TestLoadConfigArchiveS3(t *testing.T) {
+	env := map[string]string{
+		"FGTECH_INGRESS_FQDN":      "apps.example.com",
+		"FGTECH_INGRESS_CLASSNAME": "nginx",
+		"FGTECH_ARCHIVE_STORE":     "s3",
+	}
+	if _, _, err := loadConfig(nil, envOf(env)); err == nil {
+		t.Fatalf("expected error when the s3 store has no endpoint nor bucket")
+	}
+
+	env["FGTECH_ARCHIVE_S3_ENDPOINT"] = "http://minio:9000"
+	env["FGTECH_ARCHIVE_S3_BUCKET"] = "fgtech"
+	env["FGTECH_ARCHIVE_RETENTION"] = "24h"
+	env["FGTECH_ARCHIVE_INCLUDE_WORKLOAD"] = "true"
+	cfg, _, err := loadConfig(nil, envOf(env))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ArchiveStore != "s3" || cfg.ArchiveS3.Endpoint != "http://minio:9000" || cfg.ArchiveS3.Bucket != "fgtech" {
+		t.Fatalf("unexpected s3 archive config: %+v", cfg)
+	}
+	if cfg.ArchiveRetention != 24*time.Hour || !cfg.ArchiveIncludeWorkload {
+		t.Fatalf("unexpected archive options: retention=%s workload=%v", cfg.ArchiveRetention, cfg.ArchiveIncludeWorkload)
 	}
 }
 
-func clearEnv(t *testing.T) {
-	t.Helper()
-	os.Unsetenv("FGTECH_INGRESS_FQDN")
-	os.Unsetenv("FGTECH_INGRESS_TLS_SECRET")
-	os.Unsetenv("FGTECH_INGRESS_CLASSNAME")
-	os.Unsetenv("FGTECH_DEFAULT_TTL_SECONDS")
-	os.Unsetenv("FGTECH_POD_SERVICEACCOUNT")
-	os.Unsetenv("FGTECH_POD_PORT")
+func TestPrintConfigRoundTrips(t *testing.T) {
+	secrets := map[string]string{
+		"AWS_SECRET_ACCESS_KEY":  "s3cr3t",
+		"FGTECH_NOTIFY_WEBHOOKS": "https://hooks.example.com/services/t0k3n,https://chat.example.com/hook?token=t0k3n",
+	}
+	env := map[string]string{"FGTECH_INGRESS_FQDN": "apps.example.com"}
+	for k, v := range secrets {
+		env[k] = v
+	}
+	cfg, opts, err := loadConfig([]string{"--print-config", "--watch-namespaces=team-a,team-b"}, envOf(env))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.PrintConfig {
+		t.Fatalf("PrintConfig not set")
+	}
+
+	var out bytes.Buffer
+	if err := printConfig(&out, cfg); err != nil {
+		t.Fatalf("printConfig: %v", err)
+	}
+	if strings.Contains(out.String(), "s3cr3t") || strings.Contains(out.String(), "t0k3n") {
+		t.Fatalf("secret printed:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "notifyWebhooks:\n- <redacted>\n- <redacted>\n") {
+		t.Fatalf("expected one redacted entry per webhook:\n%s", out.String())
+	}
+
+	reloaded, _, err := loadConfig([]string{"--config", writeConfigFile(t, out.String())}, envOf(secrets))
+	if err != nil {
+		t.Fatalf("reload printed config: %v\n%s", err, out.String())
+	}
+	if !reflect.DeepEqual(reloaded, cfg) {
+		t.Fatalf("printed config does not round-trip:\n got %+v\nwant %+v", reloaded, cfg)
+	}
 }
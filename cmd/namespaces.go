@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// namespaceSelectorPollInterval is how often the namespaces matching
+// watchNamespaceSelector are listed again.
+const namespaceSelectorPollInterval = time.Minute
+
+// namespaceRestartBackoff is how long the operator runs before a change of
+// the selected namespaces restarts it. The kubelet forgets its restart
+// backoff once a container ran for ten minutes, so relabelling namespaces
+// never puts the Pod in CrashLoopBackOff.
+const namespaceRestartBackoff = 10 * time.Minute
+
+// errNamespacesChanged stops the manager when the selected namespaces
+// change; main then exits with status 0 to be restarted with the new set.
+var errNamespacesChanged = errors.New("watched namespaces changed")
+
+// resolveNamespaces returns the namespaces the manager watches: watchNamespaces,
+// narrowed to the ones matching watchNamespaceSelector when it is set. Nil
+// means every namespace; an empty, non-nil slice that none matches.
+func resolveNamespaces(ctx context.Context, r client.Reader, cfg managerConfig) ([]string, error) {
+	if cfg.WatchNamespaceSelector == "" {
+		return cfg.WatchNamespaces, nil
+	}
+	selector, err := labels.Parse(cfg.WatchNamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	var list corev1.NamespaceList
+	if err := r.List(ctx, &list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	namespaces := []string{}
+	for _, ns := range list.Items {
+		if len(cfg.WatchNamespaces) == 0 || slices.Contains(cfg.WatchNamespaces, ns.Name) {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+	slices.Sort(namespaces)
+	return namespaces, nil
+}
+
+// namespaceSelectionWatcher stops the manager when the namespaces matching
+// watchNamespaceSelector change: the cache cannot add or drop namespaces
+// once started, so the operator is restarted with the new set. An operator
+// watching namespaces restarts no earlier than backoff after its start; an
+// idle one, that no namespace matched, restarts at once.
+type namespaceSelectionWatcher struct {
+	reader   client.Reader
+	log      logr.Logger
+	cfg      managerConfig
+	current  []string
+	interval time.Duration
+	backoff  time.Duration
+	clock    clock.PassiveClock
+	started  time.Time
+	pending  []string
+}
+
+// Start implements manager.Runnable.
+func (w *namespaceSelectionWatcher) Start(ctx context.Context) error {
+	if w.clock == nil {
+		w.clock = clock.RealClock{}
+	}
+	w.started = w.clock.Now()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.check(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// check returns errNamespacesChanged when the matching namespaces differ
+// from the ones the cache was built with and the backoff has elapsed.
+// Listing failures are only logged.
+func (w *namespaceSelectionWatcher) check(ctx context.Context) error {
+	namespaces, err := resolveNamespaces(ctx, w.reader, w.cfg)
+	if err != nil {
+		w.log.Error(err, "unable to resolve watched namespaces", "selector", w.cfg.WatchNamespaceSelector)
+		return nil
+	}
+	if slices.Equal(namespaces, w.current) {
+		w.pending = nil
+		return nil
+	}
+	if len(w.current) > 0 {
+		if wait := w.backoff - w.clock.Since(w.started); wait > 0 {
+			if !slices.Equal(namespaces, w.pending) {
+				w.log.Info("watched namespaces changed, restart delayed", "from", w.current, "to", namespaces, "delay", wait.Round(time.Second))
+				w.pending = namespaces
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w from %v to %v", errNamespacesChanged, w.current, namespaces)
+}
+
+// ReadinessCheck fails while no namespace matches: the operator then
+// reconciles nothing until the watcher restarts it.
+func (w *namespaceSelectionWatcher) ReadinessCheck(*http.Request) error {
+	if len(w.current) == 0 {
+		return fmt.Errorf("no namespace matches %q", w.cfg.WatchNamespaceSelector)
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every replica
+// caches the watched namespaces, leader or not.
+func (w *namespaceSelectionWatcher) NeedLeaderElection() bool {
+	return false
+}
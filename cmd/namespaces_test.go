@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestResolveNamespaces(t *testing.T) {
+	enabled := map[string]string{"fgtech.io/enabled": "true"}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		namespace("team-b", enabled),
+		namespace("team-a", enabled),
+		namespace("team-c", nil),
+	).Build()
+
+	tests := []struct {
+		name string
+		cfg  managerConfig
+		want []string
+	}{
+		{name: "all namespaces", cfg: managerConfig{}},
+		{name: "list only", cfg: managerConfig{WatchNamespaces: []string{"team-c"}}, want: []string{"team-c"}},
+		{name: "selector", cfg: managerConfig{WatchNamespaceSelector: "fgtech.io/enabled=true"}, want: []string{"team-a", "team-b"}},
+		{
+			name: "selector within list",
+			cfg:  managerConfig{WatchNamespaceSelector: "fgtech.io/enabled", WatchNamespaces: []string{"team-b", "team-c"}},
+			want: []string{"team-b"},
+		},
+		{name: "no match", cfg: managerConfig{WatchNamespaceSelector: "fgtech.io/enabled=false"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveNamespaces(context.Background(), cl, tt.cfg)
+			if err != nil {
+				t.Fatalf("resolveNamespaces: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("namespaces = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func enableNamespace(t *testing.T, cl client.Client, name string) {
+	t.Helper()
+	var ns corev1.Namespace
+	if err := cl.Get(context.Background(), client.ObjectKey{Name: name}, &ns); err != nil {
+		t.Fatalf("get namespace: %v", err)
+	}
+	ns.Labels = map[string]string{"fgtech.io/enabled": "true"}
+	if err := cl.Update(context.Background(), &ns); err != nil {
+		t.Fatalf("label namespace: %v", err)
+	}
+}
+
+func TestNamespaceSelectionWatcherDetectsChanges(t *testing.T) {
+	ctx := context.Background()
+	enabled := map[string]string{"fgtech.io/enabled": "true"}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace("team-a", enabled), namespace("team-b", nil)).Build()
+	clk := clocktesting.NewFakePassiveClock(time.Now())
+	w := &namespaceSelectionWatcher{
+		reader:  cl,
+		log:     logr.Discard(),
+		cfg:     managerConfig{WatchNamespaceSelector: "fgtech.io/enabled=true"},
+		current: []string{"team-a"},
+		backoff: namespaceRestartBackoff,
+		clock:   clk,
+		started: clk.Now(),
+	}
+
+	if err := w.check(ctx); err != nil {
+		t.Fatalf("unexpected restart: %v", err)
+	}
+
+	enableNamespace(t, cl, "team-b")
+	if err := w.check(ctx); err != nil {
+		t.Fatalf("restart before the backoff: %v", err)
+	}
+	clk.SetTime(clk.Now().Add(namespaceRestartBackoff))
+	err := w.check(ctx)
+	if !errors.Is(err, errNamespacesChanged) || !strings.Contains(err.Error(), "[team-a team-b]") {
+		t.Fatalf("expected a restart for the new namespace, got %v", err)
+	}
+}
+
+func TestNamespaceSelectionWatcherLeavesIdleAtOnce(t *testing.T) {
+	ctx := context.Background()
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace("team-a", nil)).Build()
+	clk := clocktesting.NewFakePassiveClock(time.Now())
+	w := &namespaceSelectionWatcher{
+		reader:  cl,
+		log:     logr.Discard(),
+		cfg:     managerConfig{WatchNamespaceSelector: "fgtech.io/enabled=true"},
+		current: []string{},
+		backoff: namespaceRestartBackoff,
+		clock:   clk,
+		started: clk.Now(),
+	}
+
+	if err := w.check(ctx); err != nil {
+		t.Fatalf("unexpected restart: %v", err)
+	}
+	if err := w.ReadinessCheck(nil); err == nil {
+		t.Fatal("expected an idle operator not to be ready")
+	}
+
+	enableNamespace(t, cl, "team-a")
+	if err := w.check(ctx); !errors.Is(err, errNamespacesChanged) {
+		t.Fatalf("expected an immediate restart, got %v", err)
+	}
+}
+
+func TestCacheOptionsNamespaces(t *testing.T) {
+	cfg := defaultConfig()
+	if opts := cacheOptions(cfg, nil); opts.DefaultNamespaces != nil {
+		t.Fatalf("expected every namespace to be cached, got %v", opts.DefaultNamespaces)
+	}
+	opts := cacheOptions(cfg, []string{"team-a", "team-b"})
+	if len(opts.DefaultNamespaces) != 2 {
+		t.Fatalf("DefaultNamespaces = %v, want team-a and team-b", opts.DefaultNamespaces)
+	}
+	if _, ok := opts.DefaultNamespaces["team-a"]; !ok {
+		t.Fatalf("team-a not cached: %v", opts.DefaultNamespaces)
+	}
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"regexp"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/audit"
+)
+
+// envValueField matches the spec fields holding an environment variable
+// value, which may be a credential.
+var envValueField = regexp.MustCompile(`^spec\.env\[\d+\]\.value$`)
+
+// auditUpdate records the spec fields changed between old and updated; status
+// and metadata updates are not audited. Environment variable values are
+// recorded as redacted.
+func (r *FgtechReconciler) auditUpdate(old, updated *fgtechv1.Fgtech) {
+	if r.Auditor == nil {
+		return
+	}
+	changes, err := audit.Diff("spec", old.Spec, updated.Spec)
+	if err != nil {
+		r.Log.Error(err, "unable to diff fgtech spec", "name", updated.Name, "namespace", updated.Namespace)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	changes = audit.Redact(changes, envValueField.MatchString)
+	r.Auditor.Audit(auditRecord(audit.OperationUpdate, updated, audit.SpecManager(old, updated), changes))
+}
+
+// auditDelete records the removal of fg.
+func (r *FgtechReconciler) auditDelete(fg *fgtechv1.Fgtech) {
+	if r.Auditor == nil {
+		return
+	}
+	r.Auditor.Audit(auditRecord(audit.OperationDelete, fg, "", nil))
+}
+
+func auditRecord(operation string, fg *fgtechv1.Fgtech, manager string, changes []audit.Change) audit.Record {
+	return audit.Record{
+		Operation:  operation,
+		Namespace:  fg.Namespace,
+		Name:       fg.Name,
+		UID:        string(fg.UID),
+		Generation: fg.Generation,
+		Manager:    manager,
+		Changes:    changes,
+	}
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/audit"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type recordingAuditor struct {
+	records []audit.Record
+}
+
+func (a *recordingAuditor) Audit(rec audit.Record) {
+	a.records = append(a.records, rec)
+}
+
+func TestAuditRecordsSpecChangesOnly(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "uid-1", Generation: 1},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:1.25"},
+	}
+	r, _ := newTestReconciler(t, now)
+	auditor := &recordingAuditor{}
+	r.Auditor = auditor
+
+	statusOnly := old.DeepCopy()
+	statusOnly.Status.Phase = fgtechv1.PhaseRunning
+	r.auditUpdate(old, statusOnly)
+	if len(auditor.records) != 0 {
+		t.Fatalf("status update audited: %+v", auditor.records)
+	}
+
+	updated := old.DeepCopy()
+	updated.Generation = 2
+	updated.Spec.Image = "nginx:1.27"
+	updated.ManagedFields = []metav1.ManagedFieldsEntry{{
+		Manager:   "kubectl-edit",
+		Operation: metav1.ManagedFieldsOperationUpdate,
+		Time:      &metav1.Time{Time: now},
+		FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:image":{}}}`)},
+	}}
+	r.auditUpdate(old, updated)
+	r.auditDelete(updated)
+
+	if len(auditor.records) != 2 {
+		t.Fatalf("records = %+v, want an update and a delete", auditor.records)
+	}
+	rec := auditor.records[0]
+	if rec.Operation != audit.OperationUpdate || rec.UID != "uid-1" || rec.Generation != 2 || rec.Manager != "kubectl-edit" {
+		t.Fatalf("unexpected update record %+v", rec)
+	}
+	if len(rec.Changes) != 1 || rec.Changes[0] != (audit.Change{Field: "spec.image", Old: "nginx:1.25", New: "nginx:1.27"}) {
+		t.Fatalf("changes = %+v", rec.Changes)
+	}
+	if del := auditor.records[1]; del.Operation != audit.OperationDelete || len(del.Changes) != 0 {
+		t.Fatalf("unexpected delete record %+v", del)
+	}
+}
+
+func TestAuditRedactsEnvValues(t *testing.T) {
+	old := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx:1.25", Env: []corev1.EnvVar{{Name: "API_TOKEN", Value: "s3cr3t"}}},
+	}
+	r, _ := newTestReconciler(t, time.Now())
+	auditor := &recordingAuditor{}
+	r.Auditor = auditor
+
+	updated := old.DeepCopy()
+	updated.Spec.Env[0].Value = "n3w-s3cr3t"
+	updated.Spec.Env = append(updated.Spec.Env, corev1.EnvVar{Name: "PASSWORD", Value: "hunter2"})
+	r.auditUpdate(old, updated)
+
+	if len(auditor.records) != 1 {
+		t.Fatalf("records = %+v, want one update", auditor.records)
+	}
+	data, err := json.Marshal(auditor.records[0])
+	if err != nil {
+		t.Fatalf("marshal record: %v", err)
+	}
+	for _, secret := range []string{"s3cr3t", "hunter2"} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("record leaks %q: %s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), `"field":"spec.env[0].value"`) || !strings.Contains(string(data), `"name":"PASSWORD"`) {
+		t.Fatalf("record does not tell which variables changed: %s", data)
+	}
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/archive"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// expirer applies the expiry policy of a Fgtech. It is shared by the reconciler
+// and the safety-net sweep so both expire resources the same way.
+type expirer struct {
+	client        client.Client
+	defaultPolicy string
+	// archiver, when set, snapshots the Fgtech before the delete policy removes it.
+	archiver *archive.Archiver
+}
+
+// policyFor resolves the expiry policy: spec first, then the namespace
+// annotation, then the operator default, then delete.
+func (e *expirer) policyFor(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) (string, error) {
+	if isValidExpiryPolicy(fg.Spec.ExpiryPolicy) {
+		return fg.Spec.ExpiryPolicy, nil
+	}
+
+	var ns corev1.Namespace
+	if err := e.client.Get(ctx, types.NamespacedName{Name: fg.Namespace}, &ns); err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	if v := ns.Annotations[fgtechv1.AnnotationExpiryPolicy]; v != "" {
+		if isValidExpiryPolicy(v) {
+			return v, nil
+		}
+		log.Info("ignoring invalid namespace expiry policy", "namespace", fg.Namespace, "value", v)
+	}
+
+	if isValidExpiryPolicy(e.defaultPolicy) {
+		return e.defaultPolicy, nil
+	}
+	return fgtechv1.ExpiryPolicyDelete, nil
+}
+
+// expire applies the resolved policy to an expired Fgtech and returns it.
+func (e *expirer) expire(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) (applied string, err error) {
+	defer func() {
+		if err == nil {
+			metrics.Expirations.WithLabelValues(applied).Inc()
+		}
+	}()
+	policy, err := e.policyFor(ctx, fg, log)
+	if err != nil {
+		return "", err
+	}
+
+	switch policy {
+	case fgtechv1.ExpiryPolicyHibernate:
+		if err := deleteWorkload(ctx, e.client, fg, true); err != nil {
+			return "", err
+		}
+		return policy, e.setPhase(ctx, fg, fgtechv1.PhaseHibernated)
+	case fgtechv1.ExpiryPolicyArchive:
+		if err := deleteWorkload(ctx, e.client, fg, false); err != nil {
+			return "", err
+		}
+		return policy, e.setPhase(ctx, fg, fgtechv1.PhaseArchived)
+	default:
+		if e.archiver != nil {
+			entry, err := e.archiver.Archive(ctx, fg)
+			if entry == nil {
+				// Keep the Fgtech until its definition is safely stored.
+				return "", err
+			}
+			if err != nil {
+				log.Error(err, "archive retention not applied", "namespace", fg.Namespace)
+			}
+			log.Info("fgtech archived before deletion", "entry", entry.ID)
+		}
+		return fgtechv1.ExpiryPolicyDelete, deleteExpired(ctx, e.client, fg)
+	}
+}
+
+func (e *expirer) setPhase(ctx context.Context, fg *fgtechv1.Fgtech, phase string) error {
+	if fg.Status.Phase == phase {
+		return nil
+	}
+	fg.Status.Phase = phase
+	return e.client.Status().Update(ctx, fg)
+}
+
+// handleWake consumes the wake annotation. Only a hibernated or archived
+// Fgtech is woken: on a running one the annotation would grant a fresh
+// lifetime, past the extensions and the maximum lifetime, so it is dropped.
+func (r *FgtechReconciler) handleWake(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) error {
+	if !isDormant(fg) {
+		patch := client.MergeFrom(fg.DeepCopy())
+		delete(fg.Annotations, fgtechv1.AnnotationWake)
+		if err := r.Patch(ctx, fg, patch); err != nil {
+			return err
+		}
+		log.Info("ignoring wake annotation on a running fgtech")
+		r.recordEvent(fg, corev1.EventTypeWarning, "WakeIgnored", fgtechv1.AnnotationWake+" ignored: the instance is neither hibernated nor archived")
+		return nil
+	}
+	if err := wake(ctx, r.Client, fg, r.now()); err != nil {
+		return err
+	}
+	log.Info("fgtech woken up")
+	r.recordEvent(fg, corev1.EventTypeNormal, "Woken", "wake requested, workload restored with a fresh TTL")
+	return nil
+}
+
+// wake puts a hibernated or archived Fgtech back in the Running phase with a
+// fresh lifetime starting at now.
+func wake(ctx context.Context, c client.Client, fg *fgtechv1.Fgtech, now time.Time) error {
+	fg.Status.Phase = fgtechv1.PhaseRunning
+	fg.Status.ActiveSince = &metav1.Time{Time: now.Truncate(time.Second)}
+	fg.Status.ExpiresAt = nil
+	fg.Status.ExtendedSeconds = 0
+	fg.Status.ExpiryWarningSeconds = 0
+	fg.Status.LastActivityAt = nil
+	if err := c.Status().Update(ctx, fg); err != nil {
+		return err
+	}
+
+	if _, ok := fg.Annotations[fgtechv1.AnnotationWake]; ok {
+		patch := client.MergeFrom(fg.DeepCopy())
+		delete(fg.Annotations, fgtechv1.AnnotationWake)
+		if err := c.Patch(ctx, fg, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteExpired deletes the Fgtech. With the cleanup finalizer the reconciler
+// tears the route and the workload down; Fgtech resources that do not carry it
+// yet have their Pod and Service removed here.
+func deleteExpired(ctx context.Context, c client.Client, fg *fgtechv1.Fgtech) error {
+	if !controllerutil.ContainsFinalizer(fg, fgtechv1.FinalizerCleanup) {
+		if err := deleteWorkload(ctx, c, fg, false); err != nil {
+			return err
+		}
+	}
+	return deleteIgnoreNotFound(ctx, c, fg)
+}
+
+// deleteWorkload removes the Pod and, unless keepService is set, the Service
+// backing a Fgtech.
+func deleteWorkload(ctx context.Context, c client.Client, fg *fgtechv1.Fgtech, keepService bool) error {
+	if err := deleteIgnoreNotFound(ctx, c, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.PodNameFor(fg),
+			Namespace: fg.Namespace,
+		},
+	}); err != nil {
+		return err
+	}
+
+	if keepService {
+		return nil
+	}
+	return deleteIgnoreNotFound(ctx, c, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.ServiceNameFor(fg),
+			Namespace: fg.Namespace,
+		},
+	})
+}
+
+func deleteIgnoreNotFound(ctx context.Context, c client.Client, obj client.Object) error {
+	err := c.Delete(ctx, obj)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func isValidExpiryPolicy(p string) bool {
+	switch p {
+	case fgtechv1.ExpiryPolicyDelete, fgtechv1.ExpiryPolicyHibernate, fgtechv1.ExpiryPolicyArchive:
+		return true
+	}
+	return false
+}
+
+// isDormant reports whether the Fgtech was hibernated or archived and must not run.
+func isDormant(fg *fgtechv1.Fgtech) bool {
+	return fg.Status.Phase == fgtechv1.PhaseHibernated || fg.Status.Phase == fgtechv1.PhaseArchived
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/archive"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileHibernatesExpiredFgtech(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "default",
+		Annotations: map[string]string{fgtechv1.AnnotationExpiryPolicy: fgtechv1.ExpiryPolicyHibernate},
+	}}
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	podObj := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod.PodNameFor(fg), Namespace: fg.Namespace}}
+	svcObj := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: pod.ServiceNameFor(fg), Namespace: fg.Namespace}}
+	r, cl := newTestReconciler(t, now, ns, fg, podObj, svcObj)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("expected fgtech to be kept: %v", err)
+	}
+	if got.Status.Phase != fgtechv1.PhaseHibernated {
+		t.Fatalf("Phase = %q, want %q", got.Status.Phase, fgtechv1.PhaseHibernated)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(podObj), &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected pod to be deleted, got err: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(svcObj), &corev1.Service{}); err != nil {
+		t.Fatalf("expected service to be kept: %v", err)
+	}
+
+	// Waking up restores the workload with a fresh TTL.
+	patch := client.MergeFrom(got.DeepCopy())
+	got.Annotations = map[string]string{fgtechv1.AnnotationWake: "true"}
+	if err := cl.Patch(context.Background(), &got, patch); err != nil {
+		t.Fatalf("annotate wake: %v", err)
+	}
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Reconcile after wake: %v", err)
+	}
+	if res.RequeueAfter != time.Hour {
+		t.Fatalf("RequeueAfter = %s, want a fresh 1h TTL", res.RequeueAfter)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.Phase != fgtechv1.PhaseRunning {
+		t.Fatalf("Phase = %q, want %q", got.Status.Phase, fgtechv1.PhaseRunning)
+	}
+	if _, ok := got.Annotations[fgtechv1.AnnotationWake]; ok {
+		t.Fatalf("expected wake annotation to be consumed")
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(podObj), &corev1.Pod{}); err != nil {
+		t.Fatalf("expected pod to be recreated: %v", err)
+	}
+}
+
+func TestTTLWatcherArchivesExpiredFgtech(t *testing.T) {
+	now := time.Now()
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+		},
+		Spec: fgtechv1.FgtechSpec{ExpiryPolicy: fgtechv1.ExpiryPolicyArchive},
+	}
+	svcObj := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: pod.ServiceNameFor(fg), Namespace: fg.Namespace}}
+	_, cl := newTestReconciler(t, now, fg, svcObj)
+	recorder := record.NewFakeRecorder(5)
+	w := &ttlWatcher{client: cl, recorder: recorder, defaultTTLSeconds: 3600, ingressHost: "example.com"}
+
+	if err := w.sweep(context.Background(), now); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("expected fgtech to be kept: %v", err)
+	}
+	if ev := <-recorder.Events; ev != "Normal Expired TTL reached, archive policy applied" {
+		t.Fatalf("unexpected event %q", ev)
+	}
+	if got.Status.Phase != fgtechv1.PhaseArchived {
+		t.Fatalf("Phase = %q, want %q", got.Status.Phase, fgtechv1.PhaseArchived)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(svcObj), &corev1.Service{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected service to be deleted, got err: %v", err)
+	}
+}
+
+type failingStore struct{ archive.Store }
+
+func (failingStore) Put(context.Context, *archive.Entry) error {
+	return errors.New("store unavailable")
+}
+
+func TestReconcileArchivesBeforeDelete(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	store := archive.NewConfigMapStore(cl)
+	r.Archiver = &archive.Archiver{Client: cl, Store: failingStore{store}, Now: r.now}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	if _, err := r.Reconcile(context.Background(), req); err == nil {
+		t.Fatalf("expected archive failure to be reported")
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &fgtechv1.Fgtech{}); err != nil {
+		t.Fatalf("fgtech must be kept while it cannot be archived: %v", err)
+	}
+
+	r.Archiver.Store = store
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &fgtechv1.Fgtech{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected fgtech to be deleted, got err: %v", err)
+	}
+	entries, err := store.List(context.Background(), "default")
+	if err != nil {
+		t.Fatalf("list archive: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "demo" || entries[0].Fgtech.Spec.Image != "nginx:latest" {
+		t.Fatalf("unexpected archive entries: %+v", entries)
+	}
+}
+
+func TestReconcileIgnoresWakeOnRunningFgtech(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	activeSince := metav1.NewTime(now.Add(-50 * time.Minute))
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: activeSince,
+			Annotations:       map[string]string{fgtechv1.AnnotationWake: "true"},
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		Status: fgtechv1.FgtechStatus{
+			Phase:           fgtechv1.PhaseRunning,
+			ActiveSince:     &activeSince,
+			ExtendedSeconds: 600,
+		},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	r.buildManagers()
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != 20*time.Minute {
+		t.Fatalf("RequeueAfter = %s, want the remaining 20m", res.RequeueAfter)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.ActiveSince == nil || !got.Status.ActiveSince.Equal(&activeSince) || got.Status.ExtendedSeconds != 600 {
+		t.Fatalf("lifetime reset by wake: activeSince %v, extended %d", got.Status.ActiveSince, got.Status.ExtendedSeconds)
+	}
+	if _, ok := got.Annotations[fgtechv1.AnnotationWake]; ok {
+		t.Fatalf("expected wake annotation to be dropped")
+	}
+	want := "Warning WakeIgnored fgtech.io/wake ignored: the instance is neither hibernated nor archived"
+	for len(recorder.Events) > 0 {
+		if <-recorder.Events == want {
+			return
+		}
+	}
+	t.Fatalf("missing event %q", want)
+}
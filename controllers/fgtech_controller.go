@@ -2,71 +2,260 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
 
 	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/activity"
+	"github.com/fgtech/ia/cursor/pkg/archive"
+	"github.com/fgtech/ia/cursor/pkg/audit"
+	"github.com/fgtech/ia/cursor/pkg/class"
 	"github.com/fgtech/ia/cursor/pkg/ingress"
+	"github.com/fgtech/ia/cursor/pkg/notify"
 	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/fgtech/ia/cursor/pkg/tracing"
 	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // FgtechReconciler reconciles a Fgtech object
 // +kubebuilder:rbac:groups=fgtech.fgtech.io,resources=fgteches,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=fgtech.fgtech.io,resources=fgteches/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=fgtech.fgtech.io,resources=fgteches/finalizers,verbs=update
+// +kubebuilder:rbac:groups=fgtech.fgtech.io,resources=fgtechclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=fgtech.fgtech.io,resources=fgtechtemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 type FgtechReconciler struct {
 	client.Client
 	Scheme            *runtime.Scheme
 	Log               logr.Logger
-	podMgr            *pod.Manager
-	ingressMgr        *ingress.Manager
+	cfg               *reconcileConfig
+	configMu          sync.RWMutex
 	IngressHost       string
 	IngressTLSSecret  string
 	IngressClassName  string
 	DefaultTTLSeconds int64
 	DefaultSA         string
 	DefaultPodPort    int32
+	// ActivatorHost, when set, routes hibernated instances to the activator
+	// instead of the default backend wake-up page.
+	ActivatorHost string
+	// MaxLifetime bounds TTL plus extensions when the namespace sets no
+	// fgtech.io/max-lifetime annotation. Zero means unbounded.
+	MaxLifetime time.Duration
+	// DefaultExpiryPolicy applies when neither the Fgtech nor its namespace sets one.
+	DefaultExpiryPolicy string
+	// ActivityProbe reports activity for idle-mode instances; defaults to activity.DefaultProbe.
+	ActivityProbe activity.Probe
+	// ExpiryWarnings lists the thresholds before expiry at which the
+	// ExpiringSoon condition, event and notification are raised.
+	ExpiryWarnings []time.Duration
+	Recorder       record.EventRecorder
+	Notifier       notify.Publisher
+	// Auditor, when set, receives a record of every spec change and deletion.
+	Auditor audit.Auditor
+	// Archiver, when set, stores the Fgtech definition before the delete policy removes it.
+	Archiver *archive.Archiver
+	// LogFetcher captures the tail of a failed container log into status; optional.
+	LogFetcher pod.LogFetcher
+	// Clock drives TTL expiry; it defaults to the wall clock when nil.
+	Clock clock.PassiveClock
+	// MaxConcurrentReconciles defaults to 1.
+	MaxConcurrentReconciles int
+	// RateLimit paces the retries of the failed reconciliations; the zero
+	// value keeps the controller-runtime defaults.
+	RateLimit RateLimit
+	// IngressSync, when set, receives the namespaces whose ingress needs a
+	// sync; without it the ingress is synced inline.
+	IngressSync IngressSyncer
+	// Shard, when set, limits the reconciler to the namespaces of this
+	// replica's shard.
+	Shard Sharder
+	// NamespacedRBAC runs the reconciler with Roles only: FgtechClasses, being
+	// cluster-scoped, are neither watched nor resolved and the defaults apply.
+	NamespacedRBAC bool
+	// hookClient and hookBaseURL serve HTTP pre-delete hooks; they default to a
+	// 30s client and the instance Service URL.
+	hookClient  *http.Client
+	hookBaseURL func(*fgtechv1.Fgtech) string
+	// preDeleteCalls tracks the HTTP pre-delete hooks called in the background.
+	preDeleteCalls preDeleteCalls
+	// startedAt is when the reconciler was set up; the Fgtech resources
+	// created before it without the cleanup finalizer predate this release.
+	startedAt time.Time
 }
 
-func (r *FgtechReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *FgtechReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "Fgtech.Reconcile", tracing.Object(req.Namespace, req.Name)...)
+	defer func() { tracing.EndResult(span, result, err) }()
+	if !owns(r.Shard, req.Namespace) {
+		// Requests mapped from cluster-scoped objects skip the predicates.
+		return ctrl.Result{}, nil
+	}
+	r.configMu.RLock()
+	cfg := r.cfg
+	r.configMu.RUnlock()
 	log := r.Log.WithValues("fgtech", req.NamespacedName)
 
 	var fgtech fgtechv1.Fgtech
 	if err := r.Get(ctx, req.NamespacedName, &fgtech); err != nil {
 		if apierrors.IsNotFound(err) {
-			if err := r.ingressManager().SyncNamespace(ctx, req.Namespace, log); err != nil {
+			if err := r.syncIngress(ctx, cfg, req.Namespace, log); err != nil {
 				return ctrl.Result{}, err
 			}
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
 	}
+	tracing.SetUID(ctx, fgtech.UID)
 
-	podResult, err := r.podManager().Ensure(ctx, &fgtech, log)
+	// Deletion goes through a pause: the instance would otherwise stay
+	// Terminating until someone thinks of removing the annotation.
+	if !fgtech.DeletionTimestamp.IsZero() {
+		if fgtech.IsPaused() {
+			log.V(1).Info("finalizing paused fgtech")
+		}
+		return r.finalize(ctx, cfg, &fgtech, log)
+	}
+	// A paused Fgtech is left alone otherwise.
+	if paused, err := r.syncPaused(ctx, &fgtech, log); paused || err != nil {
+		return ctrl.Result{}, err
+	}
+	seedOnly := r.predatesObservation(&fgtech)
+	if err := r.ensureFinalizer(ctx, &fgtech); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if _, ok := fgtech.Annotations[fgtechv1.AnnotationWake]; ok {
+		if err := r.handleWake(ctx, &fgtech, log); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if isDormant(&fgtech) {
+		return ctrl.Result{}, r.reconcileDormant(ctx, cfg, &fgtech, log)
+	}
+
+	expiry, hasTTL, err := r.refreshExpiry(ctx, cfg, &fgtech, log)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	if podResult.Requeue || podResult.RequeueAfter > 0 {
-		return podResult, nil
+	if hasTTL && !r.now().Before(expiry) {
+		policy, err := r.expirer(cfg).expire(ctx, &fgtech, log)
+		if err != nil {
+			r.recordEvent(&fgtech, corev1.EventTypeWarning, "ExpiryFailed", fmt.Sprintf("TTL reached, expiry policy not applied: %v", err))
+			return ctrl.Result{}, err
+		}
+		log.Info("fgtech expired", "expiry", expiry, "policy", policy)
+		r.recordEvent(&fgtech, corev1.EventTypeNormal, "Expired", fmt.Sprintf("TTL reached, %s policy applied", policy))
+		r.publish(notify.TypeExpired, &fgtech, map[string]string{
+			"expiresAt": expiry.UTC().Format(time.RFC3339),
+			"policy":    policy,
+		})
+		if policy == fgtechv1.ExpiryPolicyDelete {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, r.syncIngress(ctx, cfg, fgtech.Namespace, log)
+	}
+
+	var untilWarning time.Duration
+	if hasTTL {
+		if untilWarning, err = r.checkExpiryWarnings(ctx, &fgtech, expiry, cfg.expiryWarnings, log); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	up, untilTransition, err := r.applySchedule(ctx, &fgtech, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if up {
+		workload, err := r.renderTemplate(ctx, &fgtech, log)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if workload != nil {
+			workload = workload.DeepCopy()
+			podResult, err := cfg.podMgr.Ensure(ctx, workload, log)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !equality.Semantic.DeepEqual(fgtech.Status, workload.Status) {
+				fgtech.Status = workload.Status
+				if err := r.Status().Update(ctx, &fgtech); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			if podResult.Requeue || podResult.RequeueAfter > 0 {
+				return podResult, nil
+			}
+		}
+	}
+
+	if err := r.syncIngress(ctx, cfg, fgtech.Namespace, log); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	if err := r.ingressManager().SyncNamespace(ctx, fgtech.Namespace, log); err != nil {
+	if err := r.markObserved(ctx, &fgtech, seedOnly); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	requeue := []time.Duration{untilWarning, untilTransition}
+	if hasTTL {
+		requeue = append(requeue, expiry.Sub(r.now()))
+		if usesHeartbeat(&fgtech) {
+			requeue = append(requeue, idlePollInterval)
+		}
+	}
+	return ctrl.Result{RequeueAfter: soonest(requeue...)}, nil
+}
+
+// reconcileDormant keeps a hibernated or archived Fgtech scaled to zero and its
+// route pointed at the wake-up page (hibernated) or removed (archived).
+func (r *FgtechReconciler) reconcileDormant(ctx context.Context, cfg *reconcileConfig, fg *fgtechv1.Fgtech, log logr.Logger) error {
+	keepService := fg.Status.Phase == fgtechv1.PhaseHibernated
+	if err := deleteWorkload(ctx, r.Client, fg, keepService); err != nil {
+		return err
+	}
+	return r.syncIngress(ctx, cfg, fg.Namespace, log)
+}
+
+func (r *FgtechReconciler) expirer(cfg *reconcileConfig) *expirer {
+	return &expirer{client: r.Client, defaultPolicy: cfg.expiryPolicy, archiver: r.Archiver}
+}
+
+func (r *FgtechReconciler) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock.Now()
 }
 
 func (r *FgtechReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.startedAt = r.now()
 	pred := predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
 			r.Log.Info("ajout", "name", e.Object.GetName(), "namespace", e.Object.GetNamespace())
@@ -74,32 +263,147 @@ func (r *FgtechReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			r.Log.Info("modification", "name", e.ObjectNew.GetName(), "namespace", e.ObjectNew.GetNamespace())
+			oldFg, okOld := e.ObjectOld.(*fgtechv1.Fgtech)
+			newFg, okNew := e.ObjectNew.(*fgtechv1.Fgtech)
+			if okOld && okNew {
+				r.auditUpdate(oldFg, newFg)
+			}
 			return true
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
 			r.Log.Info("supprission", "name", e.Object.GetName(), "namespace", e.Object.GetNamespace())
+			if fg, ok := e.Object.(*fgtechv1.Fgtech); ok {
+				r.publish(notify.TypeDeleted, fg, nil)
+				r.auditDelete(fg)
+			}
 			return true
 		},
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&fgtechv1.Fgtech{}).
 		Owns(&corev1.Pod{}).
 		Owns(&corev1.Service{}).
+		Owns(&batchv1.Job{})
+	if !r.NamespacedRBAC {
+		b = b.Watches(&fgtechv1.FgtechClass{}, handler.EnqueueRequestsFromMapFunc(r.fgtechesForClass))
+	}
+	if r.Shard != nil {
+		b = b.WatchesRawSource(shardResyncSource{shard: r.Shard, reader: mgr.GetClient(), log: r.Log}).
+			WithEventFilter(shardPredicate(r.Shard))
+	}
+	r.buildManagers()
+	return b.
+		Watches(&fgtechv1.FgtechTemplate{}, handler.EnqueueRequestsFromMapFunc(r.fgtechesForTemplate)).
 		WithEventFilter(pred).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             r.RateLimit.limiter(),
+		}).
 		Complete(r)
 }
 
-func (r *FgtechReconciler) podManager() *pod.Manager {
-	if r.podMgr == nil {
-		r.podMgr = pod.NewManager(r.Client, r.Scheme, r.DefaultTTLSeconds, r.DefaultSA, r.DefaultPodPort)
+// Reconfigure implements Reconfigurable. It rebuilds the managers; the
+// running reconciliations finish with the configuration they started with.
+func (r *FgtechReconciler) Reconfigure(cfg OperatorConfig) {
+	r.configMu.Lock()
+	defer r.configMu.Unlock()
+	r.IngressHost = cfg.IngressHost
+	r.IngressTLSSecret = cfg.IngressTLSSecret
+	r.IngressClassName = cfg.IngressClassName
+	r.DefaultTTLSeconds = cfg.DefaultTTLSeconds
+	r.DefaultSA = cfg.DefaultSA
+	r.DefaultPodPort = cfg.DefaultPodPort
+	r.ActivatorHost = cfg.ActivatorHost
+	r.MaxLifetime = cfg.MaxLifetime
+	r.ExpiryWarnings = cfg.ExpiryWarnings
+	r.DefaultExpiryPolicy = cfg.ExpiryPolicy
+	r.buildManagers()
+}
+
+// syncIngress hands namespace to IngressSync, or syncs it inline without one.
+func (r *FgtechReconciler) syncIngress(ctx context.Context, cfg *reconcileConfig, namespace string, log logr.Logger) error {
+	if r.IngressSync != nil {
+		r.IngressSync.Enqueue(namespace)
+		return nil
 	}
-	return r.podMgr
+	return cfg.ingressMgr.SyncNamespace(ctx, namespace, log)
 }
 
-func (r *FgtechReconciler) ingressManager() *ingress.Manager {
-	if r.ingressMgr == nil {
-		r.ingressMgr = ingress.NewManager(r.Client, r.IngressHost, r.IngressTLSSecret, r.IngressClassName)
+// reconcileConfig is the configuration a reconciliation runs with: the
+// managers and the settings read past them. It is never modified, only
+// replaced by buildManagers; configMu guards the pointer, never a whole
+// reconciliation.
+type reconcileConfig struct {
+	classes        *class.Resolver
+	podMgr         *pod.Manager
+	ingressMgr     *ingress.Manager
+	defaultSA      string
+	maxLifetime    time.Duration
+	expiryWarnings []time.Duration
+	expiryPolicy   string
+}
+
+// buildManagers builds the class resolver and the pod and ingress managers
+// from the current settings into a new reconcileConfig. It runs before the
+// controller starts or under configMu.
+func (r *FgtechReconciler) buildManagers() {
+	var reader client.Reader = r.Client
+	if r.NamespacedRBAC {
+		reader = nil
+	}
+	classes := class.NewResolver(reader, class.Defaults{
+		TTLSeconds:       r.DefaultTTLSeconds,
+		ServiceAccount:   r.DefaultSA,
+		Port:             r.DefaultPodPort,
+		IngressClassName: r.IngressClassName,
+	})
+
+	opts := []pod.Option{}
+	if r.Clock != nil {
+		opts = append(opts, pod.WithClock(r.Clock))
+	}
+	if r.Recorder != nil {
+		opts = append(opts, pod.WithRecorder(r.Recorder))
+	}
+	if r.LogFetcher != nil {
+		opts = append(opts, pod.WithLogFetcher(r.LogFetcher))
+	}
+	r.cfg = &reconcileConfig{
+		classes:        classes,
+		podMgr:         pod.NewManager(r.Client, r.Scheme, classes, opts...),
+		ingressMgr:     ingress.NewManager(r.Client, r.IngressHost, r.IngressTLSSecret, classes, ingressOptions(r.ActivatorHost, r.Recorder)...),
+		defaultSA:      r.DefaultSA,
+		maxLifetime:    r.MaxLifetime,
+		expiryWarnings: append([]time.Duration(nil), r.ExpiryWarnings...),
+		expiryPolicy:   r.DefaultExpiryPolicy,
+	}
+}
+
+// fgtechesForClass enqueues the Fgtech resources a class change may affect:
+// the ones naming it and the ones relying on the default class.
+func (r *FgtechReconciler) fgtechesForClass(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list fgtechv1.FgtechList
+	if err := r.List(ctx, &list); err != nil {
+		r.Log.Error(err, "unable to list fgteches for class", "class", obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, item := range list.Items {
+		if item.Spec.ClassName == obj.GetName() || item.Spec.ClassName == "" {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
+	}
+	return requests
+}
+
+func ingressOptions(activatorHost string, recorder record.EventRecorder) []ingress.Option {
+	var opts []ingress.Option
+	if activatorHost != "" {
+		opts = append(opts, ingress.WithActivator(activatorHost))
+	}
+	if recorder != nil {
+		opts = append(opts, ingress.WithRecorder(recorder))
 	}
-	return r.ingressMgr
+	return opts
 }
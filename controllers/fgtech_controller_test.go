@@ -0,0 +1,407 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/fgtech/ia/cursor/pkg/tracing"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newTestReconciler(t *testing.T, now time.Time, objs ...client.Object) (*FgtechReconciler, client.Client) {
+	t.Helper()
+	scheme := newScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(&fgtechv1.Fgtech{}, &fgtechv1.FgtechOperatorConfig{}).Build()
+	r := &FgtechReconciler{
+		Client:            cl,
+		Scheme:            scheme,
+		Log:               logr.Discard(),
+		IngressHost:       "apps.example.com",
+		IngressTLSSecret:  "fgtech-tls",
+		IngressClassName:  "nginx",
+		DefaultTTLSeconds: 3600,
+		DefaultSA:         "default",
+		DefaultPodPort:    8080,
+		Clock:             clocktesting.NewFakePassiveClock(now),
+	}
+	r.buildManagers()
+	return r, cl
+}
+
+func TestReconcileRequeuesAtExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-20 * time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, _ := newTestReconciler(t, now, fg)
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != 40*time.Minute {
+		t.Fatalf("RequeueAfter = %s, want 40m", res.RequeueAfter)
+	}
+}
+
+func TestReconcileTracesSpans(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			UID:               "1234",
+			CreationTimestamp: metav1.NewTime(now.Add(-20 * time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, _ := newTestReconciler(t, now, fg)
+	// The first pass creates the pod, the second one its Service.
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+	}
+
+	// Later spans of the same name replace earlier ones: the map holds the
+	// second pass.
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range sr.Ended() {
+		spans[s.Name()] = s
+	}
+	root, ok := spans["Fgtech.Reconcile"]
+	if !ok {
+		t.Fatalf("no Fgtech.Reconcile span among %v", spans)
+	}
+	want := map[attribute.Key]string{
+		tracing.AttrNamespace: "default",
+		tracing.AttrName:      "demo",
+		tracing.AttrUID:       "1234",
+		tracing.AttrOutcome:   tracing.OutcomeRequeue,
+	}
+	got := map[attribute.Key]string{}
+	for _, kv := range root.Attributes() {
+		got[kv.Key] = kv.Value.Emit()
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("Fgtech.Reconcile %s = %q, want %q", k, got[k], v)
+		}
+	}
+	for _, name := range []string{"Pod.Ensure", "Pod.ensureService", "Ingress.SyncNamespace"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Fatalf("no %s span", name)
+		}
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Fatalf("%s is not part of the reconcile trace", name)
+		}
+	}
+}
+
+func TestReconcileDeletesExpiredFgtech(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != 0 {
+		t.Fatalf("RequeueAfter = %s, want 0", res.RequeueAfter)
+	}
+
+	// The cleanup finalizer holds the Fgtech until the next reconcile tears it down.
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("expected fgtech to be terminating: %v", err)
+	}
+	if got.DeletionTimestamp.IsZero() {
+		t.Fatalf("expected deletion to be requested")
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}); err != nil {
+		t.Fatalf("Reconcile after deletion: %v", err)
+	}
+	err = cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got)
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("expected fgtech to be deleted, got err: %v", err)
+	}
+}
+
+func TestReconcilePersistsPodHealth(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-20 * time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:missing"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	var p corev1.Pod
+	if err := cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: pod.PodNameFor(fg)}, &p); err != nil {
+		t.Fatalf("get pod: %v", err)
+	}
+	p.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "fgtech",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull", Message: "manifest unknown"}},
+	}}
+	if err := cl.Status().Update(context.Background(), &p); err != nil {
+		t.Fatalf("update pod status: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, fgtechv1.ConditionPodHealthy)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "ErrImagePull" || cond.Message != "manifest unknown" {
+		t.Fatalf("unexpected PodHealthy condition %+v", cond)
+	}
+	if got.Status.LastPodFailure == nil || got.Status.LastPodFailure.Reason != "ErrImagePull" {
+		t.Fatalf("unexpected last pod failure %+v", got.Status.LastPodFailure)
+	}
+}
+
+func TestReconcileResolvesClassTTL(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	short := &fgtechv1.FgtechClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "short",
+			Annotations: map[string]string{fgtechv1.AnnotationDefaultClass: "true"},
+		},
+		Spec: fgtechv1.FgtechClassSpec{DefaultTTLSeconds: int64Ptr(1800)},
+	}
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-20 * time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	missing := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "lost", Namespace: "default"},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest", ClassName: "missing"},
+	}
+	r, cl := newTestReconciler(t, now, short, fg, missing)
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != 10*time.Minute {
+		t.Fatalf("RequeueAfter = %s, want 10m from the class TTL", res.RequeueAfter)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.ExpiresAt == nil || !got.Status.ExpiresAt.Time.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("expiresAt = %v, want %s", got.Status.ExpiresAt, now.Add(10*time.Minute))
+	}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(missing)}); err == nil {
+		t.Fatalf("expected an error for a missing class")
+	}
+	if err := cl.Get(context.Background(), types.NamespacedName{Name: pod.PodNameFor(missing), Namespace: "default"}, &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected no pod while the class is missing, got err: %v", err)
+	}
+
+	requests := r.fgtechesForClass(context.Background(), short)
+	if len(requests) != 1 || requests[0].Name != "demo" {
+		t.Fatalf("fgtechesForClass = %v, want only demo", requests)
+	}
+}
+
+// TestConcurrentReconciles runs several workers over Fgtech resources sharing
+// namespaces while the operator configuration changes; run it with -race.
+func TestConcurrentReconciles(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var objs []client.Object
+	for i := 0; i < 8; i++ {
+		objs = append(objs, &fgtechv1.Fgtech{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              fmt.Sprintf("demo-%d", i),
+				Namespace:         fmt.Sprintf("team-%d", i%2),
+				CreationTimestamp: metav1.NewTime(now),
+			},
+			Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		})
+	}
+	r, cl := newTestReconciler(t, now, objs...)
+	r.MaxConcurrentReconciles = len(objs)
+	cfg := OperatorConfig{
+		IngressHost:       r.IngressHost,
+		IngressTLSSecret:  r.IngressTLSSecret,
+		IngressClassName:  r.IngressClassName,
+		DefaultTTLSeconds: r.DefaultTTLSeconds,
+		DefaultSA:         r.DefaultSA,
+		DefaultPodPort:    r.DefaultPodPort,
+		ExpiryPolicy:      fgtechv1.ExpiryPolicyDelete,
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*len(objs))
+	// Like the controller, a worker never reconciles a request another one holds.
+	for _, obj := range objs {
+		wg.Add(1)
+		go func(req ctrl.Request) {
+			defer wg.Done()
+			for i := 0; i < 3; i++ {
+				if _, err := r.Reconcile(context.Background(), req); err != nil {
+					errs <- fmt.Errorf("%s: %w", req, err)
+				}
+			}
+		}(ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)})
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			r.Reconfigure(cfg)
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Reconcile %v", err)
+	}
+
+	for _, obj := range objs {
+		fg := obj.(*fgtechv1.Fgtech)
+		if err := cl.Get(context.Background(), types.NamespacedName{Namespace: fg.Namespace, Name: pod.PodNameFor(fg)}, &corev1.Pod{}); err != nil {
+			t.Fatalf("pod of %s: %v", fg.Name, err)
+		}
+	}
+	for _, namespace := range []string{"team-0", "team-1"} {
+		if err := cl.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: "fgtech-global-ingress"}, &networkingv1.Ingress{}); err != nil {
+			t.Fatalf("ingress of %s: %v", namespace, err)
+		}
+	}
+}
+
+func TestReconfigureDoesNotWaitForReconcile(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now)},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	blocked, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	r.Client = interceptor.NewClient(cl.(client.WithWatch), interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, ok := obj.(*corev1.Pod); ok {
+				// A slow API call in the middle of the reconciliation.
+				once.Do(func() {
+					close(blocked)
+					<-release
+				})
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	})
+	r.buildManagers()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)})
+		done <- err
+	}()
+	<-blocked
+
+	reconfigured := make(chan struct{})
+	go func() {
+		r.Reconfigure(OperatorConfig{IngressHost: "other.example.com", DefaultTTLSeconds: 3600, DefaultPodPort: 8080, ExpiryPolicy: fgtechv1.ExpiryPolicyDelete})
+		close(reconfigured)
+	}()
+	select {
+	case <-reconfigured:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Reconfigure waited for the running reconciliation")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+}
+
+func TestReconcilePersistsRestart(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now)},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), req.NamespacedName, &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	got.Annotations = map[string]string{fgtechv1.AnnotationRestartedAt: now.Format(time.RFC3339)}
+	if err := cl.Update(context.Background(), &got); err != nil {
+		t.Fatalf("annotate: %v", err)
+	}
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil || !res.Requeue {
+		t.Fatalf("Reconcile = %+v, %v; want a requeue", res, err)
+	}
+	if err := cl.Get(context.Background(), req.NamespacedName, &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.RestartedAt == nil || !got.Status.RestartedAt.Time.Equal(now) {
+		t.Fatalf("status.restartedAt = %v, want %v", got.Status.RestartedAt, now)
+	}
+}
@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/activity"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	defaultPreDeleteTimeout = 5 * time.Minute
+	preDeletePollInterval   = 5 * time.Second
+)
+
+// ensureFinalizer adds the cleanup finalizer so that deletion goes through finalize.
+func (r *FgtechReconciler) ensureFinalizer(ctx context.Context, fg *fgtechv1.Fgtech) error {
+	if controllerutil.ContainsFinalizer(fg, fgtechv1.FinalizerCleanup) {
+		return nil
+	}
+	patch := client.MergeFrom(fg.DeepCopy())
+	controllerutil.AddFinalizer(fg, fgtechv1.FinalizerCleanup)
+	return r.Patch(ctx, fg, patch)
+}
+
+// finalize tears a deleted Fgtech down in order: the route first, then the
+// pre-delete hook, then the Pod and the Service, and finally the finalizer.
+func (r *FgtechReconciler) finalize(ctx context.Context, cfg *reconcileConfig, fg *fgtechv1.Fgtech, log logr.Logger) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(fg, fgtechv1.FinalizerCleanup) {
+		return ctrl.Result{}, nil
+	}
+
+	// Synced inline, not through IngressSync: the route must be gone before
+	// the workload is.
+	if err := cfg.ingressMgr.SyncNamespace(ctx, fg.Namespace, log); err != nil {
+		r.recordEvent(fg, corev1.EventTypeWarning, "CleanupFailed", fmt.Sprintf("route not removed: %v", err))
+		return ctrl.Result{}, err
+	}
+
+	if fg.Spec.PreDelete != nil {
+		done, err := r.runPreDelete(ctx, cfg, fg, log)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: preDeletePollInterval}, nil
+		}
+	}
+
+	if err := deleteWorkload(ctx, r.Client, fg, false); err != nil {
+		r.recordEvent(fg, corev1.EventTypeWarning, "CleanupFailed", fmt.Sprintf("workload not removed: %v", err))
+		return ctrl.Result{}, err
+	}
+
+	patch := client.MergeFrom(fg.DeepCopy())
+	controllerutil.RemoveFinalizer(fg, fgtechv1.FinalizerCleanup)
+	if err := r.Patch(ctx, fg, patch); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	log.Info("fgtech cleaned up")
+	r.recordEvent(fg, corev1.EventTypeNormal, "CleanedUp", "route and workload removed")
+	return ctrl.Result{}, nil
+}
+
+// runPreDelete drives the pre-delete hook and reports whether teardown can go
+// on. A failed or timed out hook does not block the deletion.
+func (r *FgtechReconciler) runPreDelete(ctx context.Context, cfg *reconcileConfig, fg *fgtechv1.Fgtech, log logr.Logger) (bool, error) {
+	hook := fg.Spec.PreDelete
+	deadline := fg.DeletionTimestamp.Add(preDeleteTimeout(hook))
+	remaining := deadline.Sub(r.now())
+	if remaining <= 0 {
+		r.preDeleteCalls.forget(client.ObjectKeyFromObject(fg))
+		log.Info("pre-delete hook timed out")
+		r.recordEvent(fg, corev1.EventTypeWarning, "PreDeleteTimedOut", "pre-delete hook did not finish in time, teardown goes on")
+		return true, nil
+	}
+
+	switch {
+	case len(hook.Command) > 0:
+		return r.runPreDeleteJob(ctx, fg, cfg.defaultSA, remaining, log)
+	case hook.HTTPPath != "":
+		return r.callPreDeleteHTTP(ctx, fg, remaining, log)
+	}
+	return true, nil
+}
+
+func (r *FgtechReconciler) runPreDeleteJob(ctx context.Context, fg *fgtechv1.Fgtech, defaultSA string, remaining time.Duration, log logr.Logger) (bool, error) {
+	var job batchv1.Job
+	err := r.Get(ctx, types.NamespacedName{Namespace: fg.Namespace, Name: pod.PreDeleteJobNameFor(fg)}, &job)
+	if apierrors.IsNotFound(err) {
+		newJob := pod.BuildPreDeleteJob(renderedFgtech(fg), defaultSA, int64(remaining/time.Second))
+		if err := controllerutil.SetControllerReference(fg, newJob, r.Scheme); err != nil {
+			return false, err
+		}
+		if err := r.Create(ctx, newJob); err != nil {
+			return false, err
+		}
+		log.Info("pre-delete job created", "job", newJob.Name)
+		r.recordEvent(fg, corev1.EventTypeNormal, "PreDeleteStarted", fmt.Sprintf("pre-delete job %s started", newJob.Name))
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			r.recordEvent(fg, corev1.EventTypeNormal, "PreDeleteSucceeded", fmt.Sprintf("pre-delete job %s completed", job.Name))
+			return true, nil
+		case batchv1.JobFailed:
+			log.Info("pre-delete job failed", "job", job.Name, "reason", cond.Reason)
+			r.recordEvent(fg, corev1.EventTypeWarning, "PreDeleteFailed", fmt.Sprintf("pre-delete job %s failed: %s", job.Name, cond.Reason))
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// callPreDeleteHTTP POSTs to the instance in the background, so that a slow
+// hook does not hold a reconcile worker, and reports whether the hook is over.
+// Each call is recorded in status.preDelete. Transport errors and 5xx are
+// retried by the next poll until the hook deadline; any other answer ends the
+// hook.
+func (r *FgtechReconciler) callPreDeleteHTTP(ctx context.Context, fg *fgtechv1.Fgtech, remaining time.Duration, log logr.Logger) (bool, error) {
+	key := client.ObjectKeyFromObject(fg)
+	url := r.preDeleteBaseURL(fg) + "/" + strings.TrimPrefix(fg.Spec.PreDelete.HTTPPath, "/")
+	call, started := r.preDeleteCalls.start(key, metav1.NewTime(r.now()), func() preDeleteResult {
+		return postPreDelete(r.preDeleteClient(), url, remaining)
+	})
+	status := fg.Status.DeepCopy()
+	if started {
+		attempts := int32(1)
+		if status.PreDelete != nil {
+			attempts = status.PreDelete.Attempts + 1
+		}
+		status.PreDelete = call.running(url, attempts)
+		return false, r.updatePreDeleteStatus(ctx, fg, status)
+	}
+	if status.PreDelete == nil {
+		// The status written when the call started was lost, or is not in
+		// the cache yet: rebuild it from the tracked call.
+		status.PreDelete = call.running(url, 1)
+	}
+	result, done := call.result()
+	if !done {
+		return false, r.updatePreDeleteStatus(ctx, fg, status)
+	}
+	r.preDeleteCalls.forget(key)
+
+	status.PreDelete.Message = result.message
+	switch {
+	case result.retry:
+		log.Info("pre-delete call failed, retrying", "url", url, "error", result.message)
+		status.PreDelete.Phase = fgtechv1.PreDeleteRetrying
+		return false, r.updatePreDeleteStatus(ctx, fg, status)
+	case result.failed:
+		status.PreDelete.Phase = fgtechv1.PreDeleteFailed
+		r.recordEvent(fg, corev1.EventTypeWarning, "PreDeleteFailed", fmt.Sprintf("pre-delete call %s: %s", url, result.message))
+	default:
+		status.PreDelete.Phase = fgtechv1.PreDeleteSucceeded
+		r.recordEvent(fg, corev1.EventTypeNormal, "PreDeleteSucceeded", fmt.Sprintf("pre-delete call %s: %s", url, result.message))
+	}
+	return true, r.updatePreDeleteStatus(ctx, fg, status)
+}
+
+func (r *FgtechReconciler) updatePreDeleteStatus(ctx context.Context, fg *fgtechv1.Fgtech, status *fgtechv1.FgtechStatus) error {
+	if equality.Semantic.DeepEqual(fg.Status, *status) {
+		return nil
+	}
+	fg.Status = *status
+	return client.IgnoreNotFound(r.Status().Update(ctx, fg))
+}
+
+// postPreDelete makes a single pre-delete call bounded by remaining.
+func postPreDelete(c *http.Client, url string, remaining time.Duration) preDeleteResult {
+	ctx, cancel := context.WithTimeout(context.Background(), remaining)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return preDeleteResult{failed: true, message: fmt.Sprintf("invalid URL: %v", err)}
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return preDeleteResult{retry: true, message: err.Error()}
+	}
+	resp.Body.Close()
+	message := "answered " + resp.Status
+	return preDeleteResult{retry: resp.StatusCode >= 500, failed: resp.StatusCode >= 300, message: message}
+}
+
+// preDeleteResult is the outcome of a pre-delete call.
+type preDeleteResult struct {
+	// retry is set on transport errors and 5xx answers.
+	retry   bool
+	failed  bool
+	message string
+}
+
+// preDeleteCall is a pre-delete call running in the background.
+type preDeleteCall struct {
+	startedAt metav1.Time
+	done      chan struct{}
+	res       preDeleteResult
+}
+
+// running returns the status of the call while it is in flight.
+func (c *preDeleteCall) running(url string, attempts int32) *fgtechv1.PreDeleteStatus {
+	startedAt := c.startedAt
+	return &fgtechv1.PreDeleteStatus{
+		Phase:         fgtechv1.PreDeleteRunning,
+		Attempts:      attempts,
+		LastAttemptAt: &startedAt,
+		Message:       "POST " + url,
+	}
+}
+
+// result returns the outcome of the call once it is over.
+func (c *preDeleteCall) result() (preDeleteResult, bool) {
+	select {
+	case <-c.done:
+		return c.res, true
+	default:
+		return preDeleteResult{}, false
+	}
+}
+
+// preDeleteCalls tracks the pre-delete calls in flight or not yet consumed,
+// by Fgtech. The zero value is ready to use.
+type preDeleteCalls struct {
+	mu    sync.Mutex
+	calls map[types.NamespacedName]*preDeleteCall
+}
+
+// start runs fn in the background unless a call is already tracked for key,
+// and returns the tracked call and whether it was just started at now.
+func (p *preDeleteCalls) start(key types.NamespacedName, now metav1.Time, fn func() preDeleteResult) (*preDeleteCall, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if call, ok := p.calls[key]; ok {
+		return call, false
+	}
+	if p.calls == nil {
+		p.calls = map[types.NamespacedName]*preDeleteCall{}
+	}
+	call := &preDeleteCall{startedAt: now, done: make(chan struct{})}
+	p.calls[key] = call
+	go func() {
+		defer close(call.done)
+		call.res = fn()
+	}()
+	return call, true
+}
+
+// forget drops the call tracked for key; a call still in flight ends on its
+// own deadline.
+func (p *preDeleteCalls) forget(key types.NamespacedName) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.calls, key)
+}
+
+func (r *FgtechReconciler) preDeleteClient() *http.Client {
+	if r.hookClient == nil {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+	return r.hookClient
+}
+
+func (r *FgtechReconciler) preDeleteBaseURL(fg *fgtechv1.Fgtech) string {
+	if r.hookBaseURL == nil {
+		return activity.ServiceURL(fg)
+	}
+	return r.hookBaseURL(fg)
+}
+
+func preDeleteTimeout(hook *fgtechv1.PreDeleteHook) time.Duration {
+	if hook.TimeoutSeconds != nil && *hook.TimeoutSeconds > 0 {
+		return time.Duration(*hook.TimeoutSeconds) * time.Second
+	}
+	return defaultPreDeleteTimeout
+}
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// terminating returns a Fgtech whose deletion was requested at deletedAt.
+func terminating(deletedAt time.Time, hook *fgtechv1.PreDeleteHook) *fgtechv1.Fgtech {
+	return &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(deletedAt.Add(-time.Hour)),
+			DeletionTimestamp: &metav1.Time{Time: deletedAt},
+			Finalizers:        []string{fgtechv1.FinalizerCleanup},
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest", PreDelete: hook},
+	}
+}
+
+func workloadFor(fg *fgtechv1.Fgtech) []client.Object {
+	return []client.Object{
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod.PodNameFor(fg), Namespace: fg.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: pod.ServiceNameFor(fg), Namespace: fg.Namespace}},
+	}
+}
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case ev := <-recorder.Events:
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func hasEvent(events []string, prefix string) bool {
+	for _, ev := range events {
+		if strings.HasPrefix(ev, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReconcileAddsCleanupFinalizer(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now)},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if len(got.Finalizers) != 1 || got.Finalizers[0] != fgtechv1.FinalizerCleanup {
+		t.Fatalf("Finalizers = %v, want [%s]", got.Finalizers, fgtechv1.FinalizerCleanup)
+	}
+}
+
+func TestFinalizeRemovesRouteThenWorkload(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := terminating(now.Add(-time.Minute), nil)
+	other := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", CreationTimestamp: metav1.NewTime(now)},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, append(workloadFor(fg), fg, other)...)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	r.buildManagers()
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != 0 {
+		t.Fatalf("RequeueAfter = %s, want 0", res.RequeueAfter)
+	}
+
+	var ing networkingv1.Ingress
+	if err := cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "fgtech-global-ingress"}, &ing); err != nil {
+		t.Fatalf("get ingress: %v", err)
+	}
+	for _, rule := range ing.Spec.Rules {
+		for _, p := range rule.HTTP.Paths {
+			if p.Path == "/demo" {
+				t.Fatalf("route of the deleted fgtech should be removed")
+			}
+		}
+	}
+	for _, obj := range workloadFor(fg) {
+		if err := cl.Get(context.Background(), client.ObjectKeyFromObject(obj), obj); !apierrors.IsNotFound(err) {
+			t.Fatalf("expected %T to be deleted, got err: %v", obj, err)
+		}
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &fgtechv1.Fgtech{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected fgtech to be gone once the finalizer is removed, got err: %v", err)
+	}
+	if events := drainEvents(recorder); !hasEvent(events, "Normal CleanedUp") {
+		t.Fatalf("expected CleanedUp event, got %v", events)
+	}
+}
+
+func TestFinalizeWaitsForPreDeleteJob(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := terminating(now.Add(-time.Minute), &fgtechv1.PreDeleteHook{Command: []string{"sh", "-c", "backup"}})
+	r, cl := newTestReconciler(t, now, append(workloadFor(fg), fg)...)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	r.buildManagers()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != preDeletePollInterval {
+		t.Fatalf("RequeueAfter = %s, want %s", res.RequeueAfter, preDeletePollInterval)
+	}
+	var job batchv1.Job
+	if err := cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: pod.PreDeleteJobNameFor(fg)}, &job); err != nil {
+		t.Fatalf("expected pre-delete job: %v", err)
+	}
+	if c := job.Spec.Template.Spec.Containers[0]; c.Image != "nginx:latest" || strings.Join(c.Command, " ") != "sh -c backup" {
+		t.Fatalf("unexpected job container %+v", c)
+	}
+	if *job.Spec.ActiveDeadlineSeconds != 240 {
+		t.Fatalf("ActiveDeadlineSeconds = %d, want the 240s left", *job.Spec.ActiveDeadlineSeconds)
+	}
+	if err := cl.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: pod.PodNameFor(fg)}, &corev1.Pod{}); err != nil {
+		t.Fatalf("pod must be kept while the hook runs: %v", err)
+	}
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	if err := cl.Status().Update(context.Background(), &job); err != nil {
+		t.Fatalf("complete job: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &fgtechv1.Fgtech{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected fgtech to be gone, got err: %v", err)
+	}
+	events := drainEvents(recorder)
+	for _, want := range []string{"Normal PreDeleteStarted", "Normal PreDeleteSucceeded", "Normal CleanedUp"} {
+		if !hasEvent(events, want) {
+			t.Fatalf("missing %q event in %v", want, events)
+		}
+	}
+}
+
+func TestFinalizeGivesUpOnPreDeleteTimeout(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	timeout := int64(60)
+	fg := terminating(now.Add(-2*time.Minute), &fgtechv1.PreDeleteHook{Command: []string{"true"}, TimeoutSeconds: &timeout})
+	r, cl := newTestReconciler(t, now, append(workloadFor(fg), fg)...)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	r.buildManagers()
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &fgtechv1.Fgtech{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected fgtech to be gone after the hook timeout, got err: %v", err)
+	}
+	if events := drainEvents(recorder); !hasEvent(events, "Warning PreDeleteTimedOut") {
+		t.Fatalf("expected PreDeleteTimedOut event, got %v", events)
+	}
+}
+
+// reconcilePreDeleteCall reconciles req until the pre-delete call it starts is
+// answered and consumed, and returns the last result.
+func reconcilePreDeleteCall(t *testing.T, r *FgtechReconciler, req ctrl.Request) ctrl.Result {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res, err := r.Reconcile(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		r.preDeleteCalls.mu.Lock()
+		_, tracked := r.preDeleteCalls.calls[req.NamespacedName]
+		r.preDeleteCalls.mu.Unlock()
+		if !tracked {
+			return res
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pre-delete call not answered in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFinalizeCallsPreDeleteHTTP(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/hooks/stop" {
+			t.Errorf("unexpected hook call %s %s", req.Method, req.URL.Path)
+		}
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := terminating(now.Add(-time.Minute), &fgtechv1.PreDeleteHook{HTTPPath: "/hooks/stop"})
+	r, cl := newTestReconciler(t, now, append(workloadFor(fg), fg)...)
+	r.hookBaseURL = func(*fgtechv1.Fgtech) string { return srv.URL }
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	if res := reconcilePreDeleteCall(t, r, req); res.RequeueAfter != preDeletePollInterval {
+		t.Fatalf("RequeueAfter = %s, want a retry after a 503", res.RequeueAfter)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("fgtech must be kept while the hook is retried: %v", err)
+	}
+	if s := got.Status.PreDelete; s == nil || s.Phase != fgtechv1.PreDeleteRetrying || s.Attempts != 1 || s.Message != "answered 503 Service Unavailable" {
+		t.Fatalf("status.preDelete = %+v, want a retrying first attempt", s)
+	}
+
+	status = http.StatusOK
+	reconcilePreDeleteCall(t, r, req)
+	if calls != 2 {
+		t.Fatalf("hook called %d times, want 2", calls)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &fgtechv1.Fgtech{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected fgtech to be gone, got err: %v", err)
+	}
+}
+
+func TestFinalizeDoesNotWaitForPreDeleteHTTP(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := terminating(now.Add(-time.Minute), &fgtechv1.PreDeleteHook{HTTPPath: "/hooks/stop"})
+	r, cl := newTestReconciler(t, now, append(workloadFor(fg), fg)...)
+	r.hookBaseURL = func(*fgtechv1.Fgtech) string { return srv.URL }
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	for i := 0; i < 2; i++ {
+		res, err := r.Reconcile(context.Background(), req)
+		if err != nil || res.RequeueAfter != preDeletePollInterval {
+			t.Fatalf("Reconcile = %+v, %v; want a poll while the hook hangs", res, err)
+		}
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if s := got.Status.PreDelete; s == nil || s.Phase != fgtechv1.PreDeleteRunning || s.Attempts != 1 {
+		t.Fatalf("status.preDelete = %+v, want a single running call", s)
+	}
+
+	close(release)
+	reconcilePreDeleteCall(t, r, req)
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &fgtechv1.Fgtech{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected fgtech to be gone, got err: %v", err)
+	}
+}
+
+func TestFinalizeRebuildsLostPreDeleteStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := terminating(now.Add(-time.Minute), &fgtechv1.PreDeleteHook{HTTPPath: "/hooks/stop"})
+	r, cl := newTestReconciler(t, now, append(workloadFor(fg), fg)...)
+	failed := false
+	r.Client = interceptor.NewClient(cl.(client.WithWatch), interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			if !failed {
+				// The status recording the started call is lost.
+				failed = true
+				return apierrors.NewConflict(fgtechv1.GroupVersion.WithResource("fgteches").GroupResource(), obj.GetName(), nil)
+			}
+			return c.SubResource(subResource).Update(ctx, obj, opts...)
+		},
+	})
+	r.hookBaseURL = func(*fgtechv1.Fgtech) string { return srv.URL }
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	if _, err := r.Reconcile(context.Background(), req); !apierrors.IsConflict(err) {
+		t.Fatalf("Reconcile = %v, want the status conflict", err)
+	}
+	r.preDeleteCalls.mu.Lock()
+	call := r.preDeleteCalls.calls[req.NamespacedName]
+	r.preDeleteCalls.mu.Unlock()
+	if call == nil {
+		t.Fatalf("expected the pre-delete call to be tracked")
+	}
+	<-call.done
+
+	reconcilePreDeleteCall(t, r, req)
+	if err := cl.Get(context.Background(), req.NamespacedName, &fgtechv1.Fgtech{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected fgtech to be gone, got err: %v", err)
+	}
+}
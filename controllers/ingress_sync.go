@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/ingress"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DefaultIngressSyncDelay is the default IngressSyncReconciler.Delay.
+const DefaultIngressSyncDelay = time.Second
+
+var (
+	ingressSyncRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fgtech_ingress_sync_requests_total",
+		Help: "Namespace ingress syncs requested.",
+	})
+	ingressSyncCoalesced = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fgtech_ingress_sync_coalesced_total",
+		Help: "Namespace ingress sync requests merged into an already pending sync.",
+	})
+	ingressSyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fgtech_ingress_syncs_total",
+		Help: "Namespace ingress syncs run, by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(ingressSyncRequests, ingressSyncCoalesced, ingressSyncs)
+}
+
+// IngressSyncer schedules the synchronisation of the ingress of a namespace.
+type IngressSyncer interface {
+	Enqueue(namespace string)
+}
+
+// IngressSyncReconciler synchronises the ingress of a namespace; its requests
+// are keyed by namespace name. A namespace stays pending for Delay after the
+// first request, and the requests received meanwhile are merged into that
+// single sync.
+type IngressSyncReconciler struct {
+	client.Client
+	Log              logr.Logger
+	IngressHost      string
+	IngressTLSSecret string
+	IngressClassName string
+	ActivatorHost    string
+	// Recorder, when set, records the route changes on the Fgtech resources.
+	Recorder record.EventRecorder
+	// NamespacedRBAC mirrors FgtechReconciler.NamespacedRBAC: classes are ignored.
+	NamespacedRBAC bool
+	// Delay is how long a namespace stays pending, gathering the requests
+	// that follow the first one; zero syncs right away.
+	Delay time.Duration
+	// MaxConcurrentReconciles defaults to 1; a namespace is never synced by
+	// two workers at once.
+	MaxConcurrentReconciles int
+	// RateLimit paces the retries of the failed syncs.
+	RateLimit RateLimit
+	// Shard, when set, drops the namespaces of the other shards.
+	Shard Sharder
+
+	mu         sync.Mutex
+	ingressMgr *ingress.Manager
+
+	queueMu sync.Mutex
+	queue   workqueue.RateLimitingInterface
+	pending map[string]bool
+}
+
+// Enqueue implements IngressSyncer. Requests made before the controller
+// starts are kept until it does.
+func (r *IngressSyncReconciler) Enqueue(namespace string) {
+	if !owns(r.Shard, namespace) {
+		return
+	}
+	ingressSyncRequests.Inc()
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+	if r.pending[namespace] {
+		ingressSyncCoalesced.Inc()
+		return
+	}
+	if r.pending == nil {
+		r.pending = make(map[string]bool)
+	}
+	r.pending[namespace] = true
+	if r.queue != nil {
+		r.queue.AddAfter(namespaceRequest(namespace), r.Delay)
+	}
+}
+
+func (r *IngressSyncReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	// Requests arriving from now on need another sync.
+	r.queueMu.Lock()
+	delete(r.pending, req.Name)
+	r.queueMu.Unlock()
+	if !owns(r.Shard, req.Name) {
+		// The namespace moved to another shard while pending.
+		return ctrl.Result{}, nil
+	}
+
+	log := r.Log.WithValues("namespace", req.Name)
+	var ns corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: req.Name}, &ns); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	} else if err != nil || !ns.DeletionTimestamp.IsZero() {
+		// Its Ingresses go with it.
+		log.V(1).Info("namespace deleted, skipping ingress sync")
+		metrics.ForgetNamespace(req.Name)
+		return ctrl.Result{}, nil
+	}
+	if err := r.ingressManager().SyncNamespace(ctx, req.Name, log); err != nil {
+		ingressSyncs.WithLabelValues("error").Inc()
+		return ctrl.Result{}, err
+	}
+	ingressSyncs.WithLabelValues("success").Inc()
+	return ctrl.Result{}, nil
+}
+
+// Reconfigure implements Reconfigurable; the ingress manager is rebuilt on
+// next use.
+func (r *IngressSyncReconciler) Reconfigure(cfg OperatorConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.IngressHost = cfg.IngressHost
+	r.IngressTLSSecret = cfg.IngressTLSSecret
+	r.IngressClassName = cfg.IngressClassName
+	r.ActivatorHost = cfg.ActivatorHost
+	r.ingressMgr = nil
+}
+
+func (r *IngressSyncReconciler) ingressManager() *ingress.Manager {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ingressMgr == nil {
+		var reader client.Reader = r.Client
+		if r.NamespacedRBAC {
+			reader = nil
+		}
+		classes := class.NewResolver(reader, class.Defaults{IngressClassName: r.IngressClassName})
+		r.ingressMgr = ingress.NewManager(r.Client, r.IngressHost, r.IngressTLSSecret, classes, ingressOptions(r.ActivatorHost, r.Recorder)...)
+	}
+	return r.ingressMgr
+}
+
+// SetupWithManager registers the controller. It runs on the leader only,
+// like the Fgtech controller feeding it, unless leader election is off.
+func (r *IngressSyncReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("ingresssync").
+		WatchesRawSource(ingressSyncSource{r}).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			NeedLeaderElection:      ptr.To(true),
+			RateLimiter:             r.RateLimit.limiter(),
+		}).
+		Complete(r)
+}
+
+// ingressSyncSource hands the controller queue to Enqueue.
+type ingressSyncSource struct {
+	r *IngressSyncReconciler
+}
+
+func (s ingressSyncSource) Start(_ context.Context, queue workqueue.RateLimitingInterface) error {
+	s.r.queueMu.Lock()
+	defer s.r.queueMu.Unlock()
+	s.r.queue = queue
+	for namespace := range s.r.pending {
+		queue.AddAfter(namespaceRequest(namespace), s.r.Delay)
+	}
+	return nil
+}
+
+func namespaceRequest(namespace string) reconcile.Request {
+	return reconcile.Request{NamespacedName: types.NamespacedName{Name: namespace}}
+}
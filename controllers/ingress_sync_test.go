@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type recordingSyncer struct {
+	namespaces []string
+}
+
+func (s *recordingSyncer) Enqueue(namespace string) {
+	s.namespaces = append(s.namespaces, namespace)
+}
+
+func TestIngressSyncCoalescesRequests(t *testing.T) {
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "team-a"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx:1.25", Version: "1.0.0"},
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	cl := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(ns, fg).Build()
+	r := &IngressSyncReconciler{
+		Client:           cl,
+		Log:              logr.Discard(),
+		IngressHost:      "apps.example.com",
+		IngressTLSSecret: "fgtech-tls",
+		IngressClassName: "nginx",
+	}
+	coalesced := testutil.ToFloat64(ingressSyncCoalesced)
+
+	// A burst before the controller starts.
+	for i := 0; i < 200; i++ {
+		r.Enqueue("team-a")
+	}
+	r.Enqueue("team-b")
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+	if err := (ingressSyncSource{r}).Start(context.Background(), queue); err != nil {
+		t.Fatalf("start source: %v", err)
+	}
+	r.Enqueue("team-a")
+	if queue.Len() != 2 {
+		t.Fatalf("queue length = %d, want one entry per namespace", queue.Len())
+	}
+	if got := testutil.ToFloat64(ingressSyncCoalesced) - coalesced; got != 200 {
+		t.Fatalf("coalesced = %v, want 200", got)
+	}
+
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "team-a"}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(ctx, types.NamespacedName{Name: "fgtech-global-ingress", Namespace: "team-a"}, &networkingv1.Ingress{}); err != nil {
+		t.Fatalf("ingress not synced: %v", err)
+	}
+
+	// Once the sync started, a new request schedules another one.
+	r.Enqueue("team-a")
+	if !r.pending["team-a"] || testutil.ToFloat64(ingressSyncCoalesced)-coalesced != 200 {
+		t.Fatalf("expected a new pending sync for team-a")
+	}
+}
+
+func TestIngressSyncForgetsDeletedNamespace(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newScheme(t)).Build()
+	r := &IngressSyncReconciler{
+		Client:           cl,
+		Log:              logr.Discard(),
+		IngressHost:      "apps.example.com",
+		IngressClassName: "nginx",
+	}
+	metrics.IngressRoutes.WithLabelValues("team-gone", "fgtech-global-ingress").Set(3)
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "team-gone"}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if metrics.IngressRoutes.DeleteLabelValues("team-gone", "fgtech-global-ingress") {
+		t.Fatal("expected the routes of the deleted namespace to be forgotten")
+	}
+	if err := cl.Get(context.Background(), types.NamespacedName{Name: "fgtech-global-ingress", Namespace: "team-gone"}, &networkingv1.Ingress{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected no ingress in a deleted namespace, got %v", err)
+	}
+}
+
+func TestIngressSyncDelaysRequests(t *testing.T) {
+	r := &IngressSyncReconciler{Log: logr.Discard(), Delay: time.Hour}
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+	if err := (ingressSyncSource{r}).Start(context.Background(), queue); err != nil {
+		t.Fatalf("start source: %v", err)
+	}
+	r.Enqueue("team-a")
+	if queue.Len() != 0 {
+		t.Fatalf("expected the sync to wait for the delay")
+	}
+}
+
+func TestReconcileEnqueuesIngressSync(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now)},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	syncer := &recordingSyncer{}
+	r.IngressSync = syncer
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(syncer.namespaces) != 1 || syncer.namespaces[0] != "default" {
+		t.Fatalf("enqueued namespaces = %v, want [default]", syncer.namespaces)
+	}
+	err := cl.Get(context.Background(), types.NamespacedName{Name: "fgtech-global-ingress", Namespace: "default"}, &networkingv1.Ingress{})
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the reconciler to leave the ingress to the sync controller, got err: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/activity"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// idlePollInterval bounds how long an idle-mode instance with a heartbeat
+// endpoint goes without being probed.
+const idlePollInterval = time.Minute
+
+// refreshExpiry consumes the extend annotation, records the last activity in
+// idle mode and stores the resulting expiry in status.expiresAt.
+func (r *FgtechReconciler) refreshExpiry(ctx context.Context, cfg *reconcileConfig, fg *fgtechv1.Fgtech, log logr.Logger) (time.Time, bool, error) {
+	extend, extendRequested := fg.Annotations[fgtechv1.AnnotationExtend]
+	if extendRequested {
+		// The annotation is removed before the extension is granted: a failure
+		// in between loses the request instead of granting it twice on retry.
+		patch := client.MergeFrom(fg.DeepCopy())
+		delete(fg.Annotations, fgtechv1.AnnotationExtend)
+		if err := r.Patch(ctx, fg, patch); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	status := fg.Status.DeepCopy()
+	if extendRequested {
+		d, err := time.ParseDuration(extend)
+		if err != nil || d < time.Second {
+			log.Info("ignoring invalid extend annotation", "value", extend)
+			r.recordEvent(fg, corev1.EventTypeWarning, "InvalidExtension",
+				fmt.Sprintf("%s=%q ignored: not a duration of at least 1s", fgtechv1.AnnotationExtend, extend))
+		} else {
+			status.ExtendedSeconds += int64(d / time.Second)
+			log.Info("fgtech extended", "by", d.String())
+		}
+	}
+
+	if isIdleMode(fg) {
+		last, ok, err := r.activityProbe().LastActivity(ctx, fg)
+		if err != nil {
+			log.Error(err, "activity probe failed")
+		} else if ok {
+			last = last.Truncate(time.Second)
+			if status.LastActivityAt == nil || last.After(status.LastActivityAt.Time) {
+				status.LastActivityAt = &metav1.Time{Time: last}
+			}
+		}
+	}
+
+	maxLifetime, err := r.maxLifetimeFor(ctx, fg.Namespace, cfg.maxLifetime, log)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	settings, err := cfg.classes.Resolve(ctx, fg)
+	if err != nil {
+		if errors.Is(err, class.ErrNotFound) {
+			r.recordEvent(fg, corev1.EventTypeWarning, "ClassNotFound", err.Error())
+		}
+		return time.Time{}, false, err
+	}
+	candidate := fg.DeepCopy()
+	candidate.Status = *status
+	expiry, hasTTL := computeExpiry(candidate, settings, maxLifetime)
+	status.ExpiresAt = nil
+	if hasTTL {
+		status.ExpiresAt = &metav1.Time{Time: expiry}
+	}
+
+	if !equality.Semantic.DeepEqual(fg.Status, *status) {
+		fg.Status = *status
+		if err := r.Status().Update(ctx, fg); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	return expiry, hasTTL, nil
+}
+
+// computeExpiry derives the expiry from the lifetime start, the TTL resolved
+// from the class (or the idle timeout measured from the last activity) and the
+// granted extensions. The result never exceeds start + maxLifetime when a bound is set.
+func computeExpiry(fg *fgtechv1.Fgtech, settings class.Settings, maxLifetime time.Duration) (time.Time, bool) {
+	start := pod.LifetimeStart(fg)
+	extension := time.Duration(fg.Status.ExtendedSeconds) * time.Second
+
+	var expiry time.Time
+	if isIdleMode(fg) {
+		last := start
+		if fg.Status.LastActivityAt != nil && fg.Status.LastActivityAt.After(last) {
+			last = fg.Status.LastActivityAt.Time
+		}
+		expiry = last.Add(time.Duration(fg.Spec.Idle.TimeoutSeconds)*time.Second + extension)
+	} else {
+		ttl := settings.TTLSeconds(fg)
+		if ttl <= 0 {
+			return time.Time{}, false
+		}
+		expiry = start.Add(time.Duration(ttl)*time.Second + extension)
+	}
+
+	if maxLifetime > 0 {
+		if limit := start.Add(maxLifetime); expiry.After(limit) {
+			expiry = limit
+		}
+	}
+	return expiry, true
+}
+
+// maxLifetimeFor returns the lifetime bound of a namespace, read from its
+// fgtech.io/max-lifetime annotation and falling back to fallback.
+// Zero means unbounded.
+func (r *FgtechReconciler) maxLifetimeFor(ctx context.Context, namespace string, fallback time.Duration, log logr.Logger) (time.Duration, error) {
+	var ns corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fallback, nil
+		}
+		return 0, err
+	}
+	v := ns.Annotations[fgtechv1.AnnotationMaxLifetime]
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Info("ignoring invalid namespace max lifetime", "namespace", namespace, "value", v)
+		return fallback, nil
+	}
+	return d, nil
+}
+
+func (r *FgtechReconciler) activityProbe() activity.Probe {
+	if r.ActivityProbe == nil {
+		return &activity.DefaultProbe{}
+	}
+	return r.ActivityProbe
+}
+
+func isIdleMode(fg *fgtechv1.Fgtech) bool {
+	return fg.Spec.Idle != nil && fg.Spec.Idle.TimeoutSeconds > 0
+}
+
+func usesHeartbeat(fg *fgtechv1.Fgtech) bool {
+	return isIdleMode(fg) && fg.Spec.Idle.HeartbeatPath != ""
+}
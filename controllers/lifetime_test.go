@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestComputeExpiry(t *testing.T) {
+	created := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		spec        fgtechv1.FgtechSpec
+		status      fgtechv1.FgtechStatus
+		maxLifetime time.Duration
+		maxTTL      int64
+		want        time.Time
+		wantTTL     bool
+	}{
+		{name: "default ttl", want: created.Add(time.Hour), wantTTL: true},
+		{name: "spec ttl", spec: fgtechv1.FgtechSpec{TTLSeconds: int64Ptr(600)}, want: created.Add(10 * time.Minute), wantTTL: true},
+		{name: "extended", status: fgtechv1.FgtechStatus{ExtendedSeconds: 1800}, want: created.Add(90 * time.Minute), wantTTL: true},
+		{name: "spec ttl capped by class", spec: fgtechv1.FgtechSpec{TTLSeconds: int64Ptr(86400)}, maxTTL: 7200, want: created.Add(2 * time.Hour), wantTTL: true},
+		{name: "capped by max lifetime", status: fgtechv1.FgtechStatus{ExtendedSeconds: 7200}, maxLifetime: 2 * time.Hour, want: created.Add(2 * time.Hour), wantTTL: true},
+		{
+			name:    "idle without activity",
+			spec:    fgtechv1.FgtechSpec{Idle: &fgtechv1.IdleSpec{TimeoutSeconds: 900}},
+			want:    created.Add(15 * time.Minute),
+			wantTTL: true,
+		},
+		{
+			name:    "idle after activity",
+			spec:    fgtechv1.FgtechSpec{Idle: &fgtechv1.IdleSpec{TimeoutSeconds: 900}},
+			status:  fgtechv1.FgtechStatus{LastActivityAt: &metav1.Time{Time: created.Add(3 * time.Hour)}},
+			want:    created.Add(3*time.Hour + 15*time.Minute),
+			wantTTL: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fg := &fgtechv1.Fgtech{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+				Spec:       tt.spec,
+				Status:     tt.status,
+			}
+			got, ok := computeExpiry(fg, class.Settings{DefaultTTLSeconds: 3600, MaxTTLSeconds: tt.maxTTL}, tt.maxLifetime)
+			if ok != tt.wantTTL || !got.Equal(tt.want) {
+				t.Fatalf("computeExpiry = %s, %v; want %s, %v", got, ok, tt.want, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestReconcileAppliesExtendAnnotationWithinMaxLifetime(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "default",
+		Annotations: map[string]string{fgtechv1.AnnotationMaxLifetime: "3h"},
+	}}
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-30 * time.Minute)),
+			Annotations:       map[string]string{fgtechv1.AnnotationExtend: "4h"},
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, ns, fg)
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if _, ok := got.Annotations[fgtechv1.AnnotationExtend]; ok {
+		t.Fatalf("expected extend annotation to be consumed")
+	}
+	if got.Status.ExtendedSeconds != 4*3600 {
+		t.Fatalf("ExtendedSeconds = %d, want %d", got.Status.ExtendedSeconds, 4*3600)
+	}
+	wantExpiry := now.Add(150 * time.Minute)
+	if got.Status.ExpiresAt == nil || !got.Status.ExpiresAt.Time.Equal(wantExpiry) {
+		t.Fatalf("ExpiresAt = %v, want %s", got.Status.ExpiresAt, wantExpiry)
+	}
+	if res.RequeueAfter != 150*time.Minute {
+		t.Fatalf("RequeueAfter = %s, want 2h30m", res.RequeueAfter)
+	}
+}
+
+func TestReconcileIdleModeTracksLastActivity(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+			Annotations:       map[string]string{fgtechv1.AnnotationLastActivity: now.Add(-5 * time.Minute).Format(time.RFC3339)},
+		},
+		Spec: fgtechv1.FgtechSpec{
+			Version: "1.0.0",
+			Image:   "nginx:latest",
+			Idle:    &fgtechv1.IdleSpec{TimeoutSeconds: 600},
+		},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != 5*time.Minute {
+		t.Fatalf("RequeueAfter = %s, want 5m", res.RequeueAfter)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.LastActivityAt == nil || !got.Status.LastActivityAt.Time.Equal(now.Add(-5*time.Minute)) {
+		t.Fatalf("LastActivityAt = %v, want %s", got.Status.LastActivityAt, now.Add(-5*time.Minute))
+	}
+}
+
+func TestReconcileExtendAnnotationAppliedOnce(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now),
+			Annotations:       map[string]string{fgtechv1.AnnotationExtend: "1h"},
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	failPatch := true
+	r.Client = interceptor.NewClient(cl.(client.WithWatch), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			// Only the patch consuming the annotation fails.
+			if _, ok := obj.GetAnnotations()[fgtechv1.AnnotationExtend]; failPatch && !ok {
+				return errors.New("apiserver unavailable")
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	})
+	r.buildManagers()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}
+
+	if _, err := r.Reconcile(context.Background(), req); err == nil {
+		t.Fatalf("expected the failed patch to be reported")
+	}
+	failPatch = false
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), req.NamespacedName, &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.ExtendedSeconds != 3600 {
+		t.Fatalf("ExtendedSeconds = %d, want 3600", got.Status.ExtendedSeconds)
+	}
+}
+
+func TestReconcileWarnsOnInvalidExtension(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now),
+			Annotations:       map[string]string{fgtechv1.AnnotationExtend: "two hours"},
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	r.buildManagers()
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if _, ok := got.Annotations[fgtechv1.AnnotationExtend]; ok || got.Status.ExtendedSeconds != 0 {
+		t.Fatalf("invalid extension not discarded: annotations %v, extended %d", got.Annotations, got.Status.ExtendedSeconds)
+	}
+	want := `Warning InvalidExtension fgtech.io/extend="two hours" ignored: not a duration of at least 1s`
+	for len(recorder.Events) > 0 {
+		if <-recorder.Events == want {
+			return
+		}
+	}
+	t.Fatalf("missing event %q", want)
+}
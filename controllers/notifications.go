@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/notify"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// checkExpiryWarnings raises the ExpiringSoon condition, event and notification
+// when the remaining lifetime crosses one of warnings. It returns the
+// delay until the next threshold is crossed, or zero when none is left.
+func (r *FgtechReconciler) checkExpiryWarnings(ctx context.Context, fg *fgtechv1.Fgtech, expiry time.Time, warnings []time.Duration, log logr.Logger) (time.Duration, error) {
+	if len(warnings) == 0 {
+		return 0, nil
+	}
+
+	now := r.now()
+	remaining := expiry.Sub(now)
+	crossed, untilNext := crossedWarning(warnings, remaining)
+	crossedSeconds := int64(crossed / time.Second)
+
+	status := fg.Status.DeepCopy()
+	switch {
+	case crossed > 0 && (status.ExpiryWarningSeconds == 0 || crossedSeconds < status.ExpiryWarningSeconds):
+		msg := fmt.Sprintf("expires at %s, in less than %s", expiry.UTC().Format(time.RFC3339), crossed)
+		status.ExpiryWarningSeconds = crossedSeconds
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               fgtechv1.ConditionExpiringSoon,
+			Status:             metav1.ConditionTrue,
+			Reason:             "ThresholdReached",
+			Message:            msg,
+			ObservedGeneration: fg.Generation,
+			LastTransitionTime: metav1.NewTime(now),
+		})
+		r.recordEvent(fg, corev1.EventTypeWarning, "ExpiringSoon", msg)
+		r.publish(notify.TypeExpiringSoon, fg, map[string]string{
+			"expiresAt": expiry.UTC().Format(time.RFC3339),
+			"threshold": crossed.String(),
+		})
+		log.Info("fgtech expiring soon", "expiry", expiry, "threshold", crossed)
+	case crossed == 0 && status.ExpiryWarningSeconds != 0:
+		status.ExpiryWarningSeconds = 0
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               fgtechv1.ConditionExpiringSoon,
+			Status:             metav1.ConditionFalse,
+			Reason:             "ExpiryPostponed",
+			Message:            fmt.Sprintf("expires at %s", expiry.UTC().Format(time.RFC3339)),
+			ObservedGeneration: fg.Generation,
+			LastTransitionTime: metav1.NewTime(now),
+		})
+	}
+
+	if !equality.Semantic.DeepEqual(fg.Status, *status) {
+		fg.Status = *status
+		if err := r.Status().Update(ctx, fg); err != nil {
+			return 0, err
+		}
+	}
+	return untilNext, nil
+}
+
+// crossedWarning returns the tightest threshold already crossed for the given
+// remaining lifetime (zero if none) and the delay until the next one.
+func crossedWarning(thresholds []time.Duration, remaining time.Duration) (time.Duration, time.Duration) {
+	sorted := append([]time.Duration(nil), thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var crossed, untilNext time.Duration
+	for _, t := range sorted {
+		if t <= 0 {
+			continue
+		}
+		if remaining <= t {
+			if crossed == 0 {
+				crossed = t
+			}
+			continue
+		}
+		untilNext = remaining - t
+	}
+	return crossed, untilNext
+}
+
+// predatesObservation reports whether fg was handled by an operator release
+// that did not record status.observedGeneration: it has neither the observed
+// generation nor the cleanup finalizer, which a new Fgtech gets on its first
+// reconcile, and either carries a status or was created before this operator
+// started. It must be called before ensureFinalizer.
+func (r *FgtechReconciler) predatesObservation(fg *fgtechv1.Fgtech) bool {
+	if fg.Status.ObservedGeneration != 0 || controllerutil.ContainsFinalizer(fg, fgtechv1.FinalizerCleanup) {
+		return false
+	}
+	if !equality.Semantic.DeepEqual(fg.Status, fgtechv1.FgtechStatus{}) {
+		return true
+	}
+	return !r.startedAt.IsZero() && fg.CreationTimestamp.Time.Before(r.startedAt)
+}
+
+// markObserved records the reconciled generation and the Running phase, and
+// publishes the created or updated notification the first time a generation is
+// seen. With seedOnly, set for the Fgtech resources that predate the observed
+// generation, the state is recorded without notification.
+func (r *FgtechReconciler) markObserved(ctx context.Context, fg *fgtechv1.Fgtech, seedOnly bool) error {
+	if fg.Status.Phase == "" {
+		fg.Status.Phase = fgtechv1.PhaseRunning
+	} else if fg.Status.ObservedGeneration != 0 && fg.Status.ObservedGeneration == fg.Generation {
+		return nil
+	}
+	firstSeen := fg.Status.ObservedGeneration == 0
+	changed := fg.Status.ObservedGeneration != fg.Generation
+	fg.Status.ObservedGeneration = fg.Generation
+	if err := r.Status().Update(ctx, fg); err != nil {
+		return err
+	}
+	if seedOnly || (!firstSeen && !changed) {
+		return nil
+	}
+	eventType := notify.TypeUpdated
+	if firstSeen {
+		eventType = notify.TypeCreated
+	}
+	r.publish(eventType, fg, map[string]string{
+		"version": fg.Spec.Version,
+		"image":   fg.Spec.Image,
+	})
+	return nil
+}
+
+func (r *FgtechReconciler) recordEvent(fg *fgtechv1.Fgtech, eventType, reason, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Event(fg, eventType, reason, message)
+}
+
+func (r *FgtechReconciler) publish(eventType string, fg *fgtechv1.Fgtech, data map[string]string) {
+	if r.Notifier == nil {
+		return
+	}
+	r.Notifier.Publish(notify.Event{Type: eventType, Namespace: fg.Namespace, Name: fg.Name, Data: data})
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/notify"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (p *recordingPublisher) Publish(ev notify.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, ev)
+}
+
+func (p *recordingPublisher) types() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]string, 0, len(p.events))
+	for _, ev := range p.events {
+		out = append(out, ev.Type)
+	}
+	return out
+}
+
+func TestCrossedWarning(t *testing.T) {
+	thresholds := []time.Duration{10 * time.Minute, time.Hour}
+	tests := []struct {
+		remaining     time.Duration
+		wantCrossed   time.Duration
+		wantUntilNext time.Duration
+	}{
+		{remaining: 3 * time.Hour, wantCrossed: 0, wantUntilNext: 2 * time.Hour},
+		{remaining: 45 * time.Minute, wantCrossed: time.Hour, wantUntilNext: 35 * time.Minute},
+		{remaining: 5 * time.Minute, wantCrossed: 10 * time.Minute, wantUntilNext: 0},
+	}
+	for _, tt := range tests {
+		crossed, untilNext := crossedWarning(thresholds, tt.remaining)
+		if crossed != tt.wantCrossed || untilNext != tt.wantUntilNext {
+			t.Fatalf("crossedWarning(%s) = %s, %s; want %s, %s", tt.remaining, crossed, untilNext, tt.wantCrossed, tt.wantUntilNext)
+		}
+	}
+}
+
+func TestReconcileWarnsBeforeExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			Generation:        1,
+			CreationTimestamp: metav1.NewTime(now.Add(-15 * time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	r.startedAt = now.Add(-time.Hour)
+	recorder := record.NewFakeRecorder(10)
+	publisher := &recordingPublisher{}
+	r.Recorder = recorder
+	r.Notifier = publisher
+	r.ExpiryWarnings = []time.Duration{time.Hour, 10 * time.Minute}
+	r.buildManagers()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != 35*time.Minute {
+		t.Fatalf("RequeueAfter = %s, want 35m (next warning)", res.RequeueAfter)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, fgtechv1.ConditionExpiringSoon)
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Fatalf("expected ExpiringSoon=True, got %v", cond)
+	}
+	if got.Status.ExpiryWarningSeconds != 3600 {
+		t.Fatalf("ExpiryWarningSeconds = %d, want 3600", got.Status.ExpiryWarningSeconds)
+	}
+	select {
+	case ev := <-recorder.Events:
+		if !strings.HasPrefix(ev, "Warning ExpiringSoon") {
+			t.Fatalf("unexpected event %q", ev)
+		}
+	default:
+		t.Fatalf("expected an ExpiringSoon event")
+	}
+
+	// A second pass inside the same threshold must not warn again.
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if got := publisher.types(); len(got) != 2 || got[0] != notify.TypeExpiringSoon || got[1] != notify.TypeCreated {
+		t.Fatalf("published %v, want [expiringsoon created]", got)
+	}
+}
+
+func TestReconcileSeedsObservedStateOfExistingFgtech(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// Handled by a release without observedGeneration: only expiresAt is set.
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			Generation:        3,
+			CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute)),
+		},
+		Spec:   fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		Status: fgtechv1.FgtechStatus{ExpiresAt: &metav1.Time{Time: now.Add(50 * time.Minute)}},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	publisher := &recordingPublisher{}
+	r.Notifier = publisher
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.ObservedGeneration != 3 {
+		t.Fatalf("ObservedGeneration = %d, want 3", got.Status.ObservedGeneration)
+	}
+	if sent := publisher.types(); len(sent) != 0 {
+		t.Fatalf("notifications published on upgrade: %v", sent)
+	}
+}
+
+func TestReconcileSeedsObservedStateOfFgtechWithoutStatus(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// Created before the operator started and never given a status.
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			Generation:        2,
+			CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	r.startedAt = now.Add(-time.Minute)
+	publisher := &recordingPublisher{}
+	r.Notifier = publisher
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.ObservedGeneration != 2 {
+		t.Fatalf("ObservedGeneration = %d, want 2", got.Status.ObservedGeneration)
+	}
+	if sent := publisher.types(); len(sent) != 0 {
+		t.Fatalf("notifications published on upgrade: %v", sent)
+	}
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/ingress"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// OperatorConfig holds the operator settings a FgtechOperatorConfig can change
+// without a restart.
+type OperatorConfig struct {
+	IngressHost       string
+	IngressTLSSecret  string
+	IngressClassName  string
+	DefaultTTLSeconds int64
+	DefaultSA         string
+	DefaultPodPort    int32
+	TTLSweepInterval  time.Duration
+	MaxLifetime       time.Duration
+	ExpiryWarnings    []time.Duration
+	ExpiryPolicy      string
+	ActivatorHost     string
+}
+
+// Merge returns c overridden by the fields set in spec.
+func (c OperatorConfig) Merge(spec fgtechv1.FgtechOperatorConfigSpec) OperatorConfig {
+	out := c
+	if spec.IngressFQDN != "" {
+		out.IngressHost = spec.IngressFQDN
+	}
+	if spec.IngressTLSSecret != "" {
+		out.IngressTLSSecret = spec.IngressTLSSecret
+	}
+	if spec.IngressClassName != "" {
+		out.IngressClassName = spec.IngressClassName
+	}
+	if spec.DefaultTTLSeconds != nil {
+		out.DefaultTTLSeconds = *spec.DefaultTTLSeconds
+	}
+	if spec.PodServiceAccount != "" {
+		out.DefaultSA = spec.PodServiceAccount
+	}
+	if spec.PodPort != nil {
+		out.DefaultPodPort = *spec.PodPort
+	}
+	if spec.TTLSweepInterval != nil {
+		out.TTLSweepInterval = spec.TTLSweepInterval.Duration
+	}
+	if spec.MaxLifetime != nil {
+		out.MaxLifetime = spec.MaxLifetime.Duration
+	}
+	if spec.ExpiryWarnings != nil {
+		out.ExpiryWarnings = make([]time.Duration, 0, len(spec.ExpiryWarnings))
+		for _, d := range spec.ExpiryWarnings {
+			out.ExpiryWarnings = append(out.ExpiryWarnings, d.Duration)
+		}
+	}
+	if spec.ExpiryPolicy != "" {
+		out.ExpiryPolicy = spec.ExpiryPolicy
+	}
+	if spec.ActivatorService != "" {
+		out.ActivatorHost = spec.ActivatorService
+	}
+	return out
+}
+
+// Validate reports every setting the operator cannot run with.
+func (c OperatorConfig) Validate() error {
+	var errs []error
+	if c.IngressHost == "" {
+		errs = append(errs, errors.New("ingress FQDN missing (FGTECH_INGRESS_FQDN)"))
+	}
+	if c.IngressClassName == "" {
+		errs = append(errs, errors.New("ingress class name missing (FGTECH_INGRESS_CLASSNAME)"))
+	}
+	if c.IngressTLSSecret == "" {
+		errs = append(errs, errors.New("ingress TLS secret missing"))
+	}
+	if c.DefaultTTLSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("invalid default TTL: %d", c.DefaultTTLSeconds))
+	}
+	if c.DefaultSA == "" {
+		errs = append(errs, errors.New("pod service account missing"))
+	}
+	if c.DefaultPodPort <= 0 || c.DefaultPodPort > 65535 {
+		errs = append(errs, fmt.Errorf("invalid pod port: %d", c.DefaultPodPort))
+	}
+	if c.TTLSweepInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid TTL sweep interval: %s", c.TTLSweepInterval))
+	}
+	if c.MaxLifetime < 0 {
+		errs = append(errs, fmt.Errorf("invalid max lifetime: %s", c.MaxLifetime))
+	}
+	for _, d := range c.ExpiryWarnings {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("invalid expiry warning: %s", d))
+		}
+	}
+	switch c.ExpiryPolicy {
+	case fgtechv1.ExpiryPolicyDelete, fgtechv1.ExpiryPolicyHibernate, fgtechv1.ExpiryPolicyArchive:
+	default:
+		errs = append(errs, fmt.Errorf("invalid expiry policy: %q", c.ExpiryPolicy))
+	}
+	return errors.Join(errs...)
+}
+
+func (c OperatorConfig) classDefaults() class.Defaults {
+	return class.Defaults{
+		TTLSeconds:       c.DefaultTTLSeconds,
+		ServiceAccount:   c.DefaultSA,
+		Port:             c.DefaultPodPort,
+		IngressClassName: c.IngressClassName,
+	}
+}
+
+// Reconfigurable is implemented by the components following the operator
+// configuration live.
+type Reconfigurable interface {
+	Reconfigure(cfg OperatorConfig)
+}
+
+// LoadOperatorConfig merges the FgtechOperatorConfig, when it exists, over
+// fallback. It returns the resource as well, nil when absent.
+func LoadOperatorConfig(ctx context.Context, c client.Reader, fallback OperatorConfig) (OperatorConfig, *fgtechv1.FgtechOperatorConfig, error) {
+	var oc fgtechv1.FgtechOperatorConfig
+	if err := c.Get(ctx, types.NamespacedName{Name: fgtechv1.OperatorConfigName}, &oc); err != nil {
+		if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return fallback, nil, nil
+		}
+		return fallback, nil, err
+	}
+	return fallback.Merge(oc.Spec), &oc, nil
+}
+
+// OperatorConfigReconciler watches the FgtechOperatorConfig singleton and
+// pushes the effective configuration to its targets. An invalid resource is
+// reported in its status and leaves the running configuration untouched.
+// +kubebuilder:rbac:groups=fgtech.fgtech.io,resources=fgtechoperatorconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=fgtech.fgtech.io,resources=fgtechoperatorconfigs/status,verbs=get;update;patch
+type OperatorConfigReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	// Fallback is the configuration read from the environment.
+	Fallback OperatorConfig
+	// Current is the configuration the targets run with; it is updated on
+	// every change.
+	Current OperatorConfig
+	Targets []Reconfigurable
+	// IngressSync, when set, receives the namespaces to resync; without it
+	// they are synced inline.
+	IngressSync IngressSyncer
+}
+
+func (r *OperatorConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("config", req.Name)
+
+	cfg, oc, err := LoadOperatorConfig(ctx, r.Client, r.Fallback)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Info("operator configuration rejected", "error", err.Error())
+		if oc == nil {
+			// The environment alone is invalid: keep what runs.
+			return ctrl.Result{}, nil
+		}
+		if !meta.IsStatusConditionFalse(oc.Status.Conditions, fgtechv1.ConditionConfigValid) && r.Recorder != nil {
+			r.Recorder.Event(oc, corev1.EventTypeWarning, "InvalidConfig", err.Error())
+		}
+		return ctrl.Result{}, r.setValid(ctx, oc, metav1.ConditionFalse, "InvalidConfig", err.Error())
+	}
+
+	if !reflect.DeepEqual(cfg, r.Current) {
+		prev := r.Current
+		for _, t := range r.Targets {
+			t.Reconfigure(cfg)
+		}
+		r.Current = cfg
+		log.Info("operator configuration applied")
+		if oc != nil && r.Recorder != nil {
+			r.Recorder.Event(oc, corev1.EventTypeNormal, "Applied", "operator configuration applied")
+		}
+		if err := r.resyncIngresses(ctx, prev, cfg, log); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if oc == nil {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, r.setValid(ctx, oc, metav1.ConditionTrue, "Applied", "configuration in effect")
+}
+
+func (r *OperatorConfigReconciler) setValid(ctx context.Context, oc *fgtechv1.FgtechOperatorConfig, status metav1.ConditionStatus, reason, message string) error {
+	prev := oc.Status.DeepCopy()
+	oc.Status.ObservedGeneration = oc.Generation
+	meta.SetStatusCondition(&oc.Status.Conditions, metav1.Condition{
+		Type:               fgtechv1.ConditionConfigValid,
+		Status:             status,
+		ObservedGeneration: oc.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	if equality.Semantic.DeepEqual(*prev, oc.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, oc)
+}
+
+// resyncIngresses syncs the namespaces whose effective ingress configuration
+// changed: all of them when the host, TLS secret or activator did, otherwise
+// those holding a Fgtech whose resolved ingress class did.
+func (r *OperatorConfigReconciler) resyncIngresses(ctx context.Context, prev, cfg OperatorConfig, log logr.Logger) error {
+	all := prev.IngressHost != cfg.IngressHost || prev.IngressTLSSecret != cfg.IngressTLSSecret || prev.ActivatorHost != cfg.ActivatorHost
+	if !all && prev.IngressClassName == cfg.IngressClassName {
+		return nil
+	}
+
+	var list fgtechv1.FgtechList
+	if err := r.List(ctx, &list); err != nil {
+		return err
+	}
+	before := class.NewResolver(r.Client, prev.classDefaults())
+	after := class.NewResolver(r.Client, cfg.classDefaults())
+	namespaces := make(map[string]struct{})
+	for i := range list.Items {
+		item := &list.Items[i]
+		if _, ok := namespaces[item.Namespace]; ok {
+			continue
+		}
+		if all {
+			namespaces[item.Namespace] = struct{}{}
+			continue
+		}
+		old, err := before.Resolve(ctx, item)
+		if err != nil {
+			continue
+		}
+		cur, err := after.Resolve(ctx, item)
+		if err != nil {
+			continue
+		}
+		if old.IngressClassName != cur.IngressClassName {
+			namespaces[item.Namespace] = struct{}{}
+		}
+	}
+
+	if r.IngressSync != nil {
+		for ns := range namespaces {
+			log.Info("resyncing ingress after configuration change", "namespace", ns)
+			r.IngressSync.Enqueue(ns)
+		}
+		return nil
+	}
+	mgr := ingress.NewManager(r.Client, cfg.IngressHost, cfg.IngressTLSSecret, after, ingressOptions(cfg.ActivatorHost, r.Recorder)...)
+	var errs []error
+	for ns := range namespaces {
+		log.Info("resyncing ingress after configuration change", "namespace", ns)
+		if err := mgr.SyncNamespace(ctx, ns, log); err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: %w", ns, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *OperatorConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&fgtechv1.FgtechOperatorConfig{}).
+		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == fgtechv1.OperatorConfigName
+		})).
+		Complete(r)
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/go-logr/logr"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestOperatorConfigMerge(t *testing.T) {
+	base := OperatorConfig{
+		IngressHost:       "apps.example.com",
+		IngressTLSSecret:  "fgtech-tls",
+		IngressClassName:  "nginx",
+		DefaultTTLSeconds: 3600,
+		DefaultSA:         "default",
+		DefaultPodPort:    8080,
+		TTLSweepInterval:  DefaultTTLSweepInterval,
+		ExpiryWarnings:    []time.Duration{time.Hour},
+		ExpiryPolicy:      fgtechv1.ExpiryPolicyDelete,
+	}
+	ttl := int64(600)
+	tests := []struct {
+		name    string
+		spec    fgtechv1.FgtechOperatorConfigSpec
+		check   func(OperatorConfig) bool
+		invalid bool
+	}{
+		{
+			name:  "empty spec keeps the environment",
+			spec:  fgtechv1.FgtechOperatorConfigSpec{},
+			check: func(c OperatorConfig) bool { return c.IngressHost == "apps.example.com" && len(c.ExpiryWarnings) == 1 },
+		},
+		{
+			name: "overrides",
+			spec: fgtechv1.FgtechOperatorConfigSpec{IngressFQDN: "apps.new.example.com", DefaultTTLSeconds: &ttl, ExpiryWarnings: []metav1.Duration{}},
+			check: func(c OperatorConfig) bool {
+				return c.IngressHost == "apps.new.example.com" && c.DefaultTTLSeconds == 600 && len(c.ExpiryWarnings) == 0 && c.IngressClassName == "nginx"
+			},
+		},
+		{
+			name:    "invalid policy",
+			spec:    fgtechv1.FgtechOperatorConfigSpec{ExpiryPolicy: "shred"},
+			invalid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := base.Merge(tt.spec)
+			err := got.Validate()
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("expected a validation error for %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !tt.check(got) {
+				t.Fatalf("unexpected merged config %+v", got)
+			}
+		})
+	}
+}
+
+func TestOperatorConfigReconcileAppliesLive(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "team-a",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:1.25"},
+	}
+	oc := &fgtechv1.FgtechOperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: fgtechv1.OperatorConfigName, Generation: 1},
+		Spec:       fgtechv1.FgtechOperatorConfigSpec{IngressFQDN: "apps.new.example.com"},
+	}
+	r, cl := newTestReconciler(t, now, fg, oc)
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	fallback := OperatorConfig{
+		IngressHost:       r.IngressHost,
+		IngressTLSSecret:  r.IngressTLSSecret,
+		IngressClassName:  r.IngressClassName,
+		DefaultTTLSeconds: r.DefaultTTLSeconds,
+		DefaultSA:         r.DefaultSA,
+		DefaultPodPort:    r.DefaultPodPort,
+		TTLSweepInterval:  DefaultTTLSweepInterval,
+		ExpiryPolicy:      fgtechv1.ExpiryPolicyDelete,
+	}
+	watcher := &ttlWatcher{client: cl, log: logr.Discard(), interval: DefaultTTLSweepInterval}
+	cr := &OperatorConfigReconciler{
+		Client:   cl,
+		Log:      logr.Discard(),
+		Fallback: fallback,
+		Current:  fallback,
+		Targets:  []Reconfigurable{r, watcher},
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: fgtechv1.OperatorConfigName}}
+	ingressHost := func() string {
+		t.Helper()
+		var ing networkingv1.Ingress
+		if err := cl.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: "fgtech-global-ingress"}, &ing); err != nil {
+			t.Fatalf("get ingress: %v", err)
+		}
+		return ing.Spec.Rules[0].Host
+	}
+	validCondition := func() *metav1.Condition {
+		t.Helper()
+		if err := cl.Get(ctx, req.NamespacedName, oc); err != nil {
+			t.Fatalf("get config: %v", err)
+		}
+		return meta.FindStatusCondition(oc.Status.Conditions, fgtechv1.ConditionConfigValid)
+	}
+
+	if _, err := cr.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile config: %v", err)
+	}
+	if r.IngressHost != "apps.new.example.com" || watcher.ingressHost != "apps.new.example.com" {
+		t.Fatalf("targets not reconfigured: reconciler %s, watcher %s", r.IngressHost, watcher.ingressHost)
+	}
+	if host := ingressHost(); host != "apps.new.example.com" {
+		t.Fatalf("ingress host = %s, want the namespace resynced", host)
+	}
+	if cond := validCondition(); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Fatalf("unexpected Valid condition %+v", cond)
+	}
+
+	// An invalid spec is reported and leaves the running configuration alone.
+	port := int32(0)
+	oc.Spec.PodPort = &port
+	oc.Spec.IngressFQDN = "apps.other.example.com"
+	if err := cl.Update(ctx, oc); err != nil {
+		t.Fatalf("update config: %v", err)
+	}
+	if _, err := cr.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile config: %v", err)
+	}
+	if cond := validCondition(); cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "InvalidConfig" {
+		t.Fatalf("unexpected Valid condition %+v", cond)
+	}
+	if r.IngressHost != "apps.new.example.com" || r.DefaultPodPort != 8080 {
+		t.Fatalf("invalid config applied: host %s port %d", r.IngressHost, r.DefaultPodPort)
+	}
+
+	// Without the resource the environment applies again.
+	if err := cl.Delete(ctx, oc); err != nil {
+		t.Fatalf("delete config: %v", err)
+	}
+	if _, err := cr.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile config: %v", err)
+	}
+	if r.IngressHost != "apps.example.com" || ingressHost() != "apps.example.com" {
+		t.Fatalf("fallback not restored: reconciler %s, ingress %s", r.IngressHost, ingressHost())
+	}
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncPaused keeps the Paused condition in line with AnnotationPaused and
+// reports whether the Fgtech is paused. A paused Fgtech only gets its
+// condition written: no workload, expiry, route or finalizer handling, its
+// deletion aside, which Reconcile finalizes before looking at the pause. The
+// condition turns False on resume and is not added to Fgtech resources that
+// were never paused.
+func (r *FgtechReconciler) syncPaused(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) (bool, error) {
+	paused := fg.IsPaused()
+	prev := meta.FindStatusCondition(fg.Status.Conditions, fgtechv1.ConditionPaused)
+	status := fg.Status.DeepCopy()
+	switch {
+	case paused && (prev == nil || prev.Status != metav1.ConditionTrue):
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               fgtechv1.ConditionPaused,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Annotated",
+			Message:            fgtechv1.AnnotationPaused + " is set, the operator leaves the instance alone",
+			ObservedGeneration: fg.Generation,
+			LastTransitionTime: metav1.NewTime(r.now()),
+		})
+		log.Info("fgtech paused")
+		r.recordEvent(fg, corev1.EventTypeNormal, "Paused", "reconciliation and expiry suspended by "+fgtechv1.AnnotationPaused)
+	case !paused && prev != nil && prev.Status == metav1.ConditionTrue:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               fgtechv1.ConditionPaused,
+			Status:             metav1.ConditionFalse,
+			Reason:             "Resumed",
+			Message:            fgtechv1.AnnotationPaused + " removed",
+			ObservedGeneration: fg.Generation,
+			LastTransitionTime: metav1.NewTime(r.now()),
+		})
+		log.Info("fgtech resumed")
+		r.recordEvent(fg, corev1.EventTypeNormal, "Resumed", "reconciliation and expiry resumed")
+	}
+
+	if !equality.Semantic.DeepEqual(fg.Status, *status) {
+		fg.Status = *status
+		if err := r.Status().Update(ctx, fg); err != nil {
+			return paused, err
+		}
+	}
+	return paused, nil
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileLeavesPausedFgtechAlone(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "demo",
+			Namespace: "default",
+			// Expired two hours ago.
+			CreationTimestamp: metav1.NewTime(now.Add(-3 * time.Hour)),
+			Annotations:       map[string]string{fgtechv1.AnnotationPaused: "true"},
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	r.buildManagers()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}
+	podKey := types.NamespacedName{Namespace: "default", Name: pod.PodNameFor(fg)}
+
+	for i := 0; i < 2; i++ {
+		if res, err := r.Reconcile(context.Background(), req); err != nil || res != (ctrl.Result{}) {
+			t.Fatalf("Reconcile = %+v, %v", res, err)
+		}
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), req.NamespacedName, &got); err != nil {
+		t.Fatalf("expected the expired paused fgtech to remain: %v", err)
+	}
+	if cond := meta.FindStatusCondition(got.Status.Conditions, fgtechv1.ConditionPaused); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Fatalf("expected Paused=True, got %v", cond)
+	}
+	if len(got.Finalizers) != 0 || got.Status.ExpiresAt != nil {
+		t.Fatalf("paused fgtech touched: finalizers %v, expiresAt %v", got.Finalizers, got.Status.ExpiresAt)
+	}
+	if err := cl.Get(context.Background(), podKey, &corev1.Pod{}); err == nil {
+		t.Fatalf("expected no pod for a paused fgtech")
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected a single Paused event, got %d", len(recorder.Events))
+	}
+	if ev := <-recorder.Events; ev != "Normal Paused reconciliation and expiry suspended by fgtech.io/paused" {
+		t.Fatalf("unexpected event %q", ev)
+	}
+
+	// Resumed with a fresh TTL, the instance runs again.
+	got.Annotations = nil
+	got.CreationTimestamp = metav1.NewTime(now)
+	if err := cl.Update(context.Background(), &got); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(context.Background(), req.NamespacedName, &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if cond := meta.FindStatusCondition(got.Status.Conditions, fgtechv1.ConditionPaused); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Fatalf("expected Paused=False, got %v", cond)
+	}
+	if err := cl.Get(context.Background(), podKey, &corev1.Pod{}); err != nil {
+		t.Fatalf("expected a pod once resumed: %v", err)
+	}
+}
+
+func TestReconcileFinalizesDeletedPausedFgtech(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := terminating(now, nil)
+	fg.Annotations = map[string]string{fgtechv1.AnnotationPaused: "true"}
+	r, cl := newTestReconciler(t, now, append(workloadFor(fg), fg)...)
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(fg)}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(context.Background(), req.NamespacedName, &fgtechv1.Fgtech{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the paused fgtech to be finalized, got %v", err)
+	}
+}
+
+func TestTTLWatcherSkipsPausedFgtech(t *testing.T) {
+	now := time.Now()
+	fg := &fgtechv1.Fgtech{ObjectMeta: metav1.ObjectMeta{
+		Name:              "demo",
+		Namespace:         "default",
+		CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+		Annotations:       map[string]string{fgtechv1.AnnotationPaused: "true"},
+	}}
+	cl := fake.NewClientBuilder().WithScheme(newScheme(t)).WithRuntimeObjects(fg).Build()
+	w := NewTTLWatcher(cl, logr.Discard(), TTLWatcherOptions{
+		DefaultTTLSeconds: 3600,
+		IngressHost:       "example.com",
+		IngressTLSSecret:  "fgtech-tls",
+	}).(*ttlWatcher)
+
+	if err := w.sweep(context.Background(), now); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &fgtechv1.Fgtech{}); err != nil {
+		t.Fatalf("expected the paused fgtech to remain, got err: %v", err)
+	}
+}
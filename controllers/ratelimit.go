@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Defaults of RateLimit, the ones of workqueue.DefaultControllerRateLimiter.
+const (
+	DefaultRateLimitBaseDelay = 5 * time.Millisecond
+	DefaultRateLimitMaxDelay  = 1000 * time.Second
+	DefaultRateLimitQPS       = 10
+	DefaultRateLimitBurst     = 100
+)
+
+// RateLimit paces the retries of a controller, the requests added back with
+// AddRateLimited after an error or a Requeue result: a failed request is
+// retried after BaseDelay, doubled on each failure up to MaxDelay, and those
+// retries are held to QPS with bursts of Burst. Requests added by events or
+// by RequeueAfter are not limited. Zero fields take the defaults.
+type RateLimit struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	QPS       float64
+	Burst     int
+}
+
+// limiter returns the rate limiter of the controller options.
+func (l RateLimit) limiter() workqueue.RateLimiter {
+	if l.BaseDelay <= 0 {
+		l.BaseDelay = DefaultRateLimitBaseDelay
+	}
+	if l.MaxDelay <= 0 {
+		l.MaxDelay = DefaultRateLimitMaxDelay
+	}
+	if l.QPS <= 0 {
+		l.QPS = DefaultRateLimitQPS
+	}
+	if l.Burst <= 0 {
+		l.Burst = DefaultRateLimitBurst
+	}
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(l.BaseDelay, l.MaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(l.QPS), l.Burst)},
+	)
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/schedule"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// applySchedule scales the workload down outside its schedule windows and
+// records the next transition in status. It returns whether the workload should
+// run and the delay until the next transition, zero when there is none.
+func (r *FgtechReconciler) applySchedule(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) (bool, time.Duration, error) {
+	spec, err := r.scheduleFor(ctx, fg, log)
+	if err != nil {
+		return true, 0, err
+	}
+
+	now := r.now()
+	up := true
+	var next time.Time
+	if spec != nil {
+		sched, err := schedule.Parse(spec)
+		if err != nil {
+			log.Info("ignoring invalid schedule", "error", err.Error())
+			r.recordEvent(fg, corev1.EventTypeWarning, "InvalidSchedule", err.Error())
+		} else {
+			up, next = sched.State(now)
+		}
+	}
+
+	status := fg.Status.DeepCopy()
+	status.NextScheduleTransition = nil
+	if !next.IsZero() {
+		status.NextScheduleTransition = &metav1.Time{Time: next.Truncate(time.Second)}
+	}
+	switch {
+	case !up && status.Phase != fgtechv1.PhaseScaledDown:
+		status.Phase = fgtechv1.PhaseScaledDown
+		r.recordEvent(fg, corev1.EventTypeNormal, "ScaledDown", "outside schedule windows")
+		log.Info("fgtech scaled down by schedule", "next", next)
+	case up && status.Phase == fgtechv1.PhaseScaledDown:
+		status.Phase = fgtechv1.PhaseRunning
+		r.recordEvent(fg, corev1.EventTypeNormal, "ScaledUp", "inside schedule windows")
+		log.Info("fgtech scaled up by schedule", "next", next)
+	}
+
+	if !up {
+		if err := deleteWorkload(ctx, r.Client, fg, true); err != nil {
+			return false, 0, err
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(fg.Status, *status) {
+		fg.Status = *status
+		if err := r.Status().Update(ctx, fg); err != nil {
+			return up, 0, err
+		}
+	}
+
+	if next.IsZero() {
+		return up, 0, nil
+	}
+	return up, next.Sub(now), nil
+}
+
+// scheduleFor returns spec.schedule, or the namespace default stored in the
+// fgtech.io/schedule annotation. It returns nil when no schedule applies.
+func (r *FgtechReconciler) scheduleFor(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) (*fgtechv1.ScheduleSpec, error) {
+	if fg.Spec.Schedule != nil {
+		return fg.Spec.Schedule, nil
+	}
+	var ns corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: fg.Namespace}, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	v := ns.Annotations[fgtechv1.AnnotationSchedule]
+	if v == "" {
+		return nil, nil
+	}
+	spec, err := schedule.ParseAnnotation(v)
+	if err != nil {
+		log.Info("ignoring invalid namespace schedule", "namespace", fg.Namespace, "error", err.Error())
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// soonest returns the smallest positive duration, or zero when there is none.
+func soonest(durations ...time.Duration) time.Duration {
+	var min time.Duration
+	for _, d := range durations {
+		if d > 0 && (min == 0 || d < min) {
+			min = d
+		}
+	}
+	return min
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileScalesDownOutsideNamespaceSchedule(t *testing.T) {
+	// Saturday 2024-06-01, 12:00 UTC: outside the weekday window.
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "default",
+		Annotations: map[string]string{fgtechv1.AnnotationSchedule: `{"windows":[{"up":"0 8 * * 1-5","down":"0 19 * * 1-5"}]}`},
+	}}
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest", TTLSeconds: int64Ptr(7 * 24 * 3600)},
+	}
+	podObj := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod.PodNameFor(fg), Namespace: fg.Namespace}}
+	r, cl := newTestReconciler(t, now, ns, fg, podObj)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	wantNext := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+	if res.RequeueAfter != wantNext.Sub(now) {
+		t.Fatalf("RequeueAfter = %s, want %s", res.RequeueAfter, wantNext.Sub(now))
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.Phase != fgtechv1.PhaseScaledDown {
+		t.Fatalf("Phase = %q, want %q", got.Status.Phase, fgtechv1.PhaseScaledDown)
+	}
+	if got.Status.NextScheduleTransition == nil || !got.Status.NextScheduleTransition.Time.Equal(wantNext) {
+		t.Fatalf("NextScheduleTransition = %v, want %s", got.Status.NextScheduleTransition, wantNext)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(podObj), &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected pod to be deleted, got err: %v", err)
+	}
+}
+
+func TestReconcileScalesUpInsideSpecSchedule(t *testing.T) {
+	// Monday 2024-06-03, 09:00 UTC: inside the window.
+	now := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{
+			Version:    "1.0.0",
+			Image:      "nginx:latest",
+			TTLSeconds: int64Ptr(7 * 24 * 3600),
+			Schedule: &fgtechv1.ScheduleSpec{
+				Windows: []fgtechv1.ScheduleWindow{{Up: "0 8 * * 1-5", Down: "0 19 * * 1-5"}},
+			},
+		},
+		Status: fgtechv1.FgtechStatus{Phase: fgtechv1.PhaseScaledDown},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter != 10*time.Hour {
+		t.Fatalf("RequeueAfter = %s, want 10h", res.RequeueAfter)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Status.Phase != fgtechv1.PhaseRunning {
+		t.Fatalf("Phase = %q, want %q", got.Status.Phase, fgtechv1.PhaseRunning)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: pod.PodNameFor(fg)}, &corev1.Pod{}); err != nil {
+		t.Fatalf("expected pod to be created: %v", err)
+	}
+}
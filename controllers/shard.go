@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Sharder restricts a replica to the namespaces of its shard; see
+// shard.Membership.
+type Sharder interface {
+	// Owns reports whether the replica handles namespace.
+	Owns(namespace string) bool
+	// OnChange registers fn, called whenever namespaces move between replicas.
+	OnChange(fn func())
+}
+
+// owns reports whether namespace is handled here; everything is without
+// sharding.
+func owns(s Sharder, namespace string) bool {
+	return s == nil || s.Owns(namespace)
+}
+
+// shardPredicate drops the events of the namespaces of other shards. It runs
+// before the predicates with side effects, so that a single replica audits
+// and notifies each change.
+func shardPredicate(s Sharder) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return owns(s, obj.GetNamespace())
+	})
+}
+
+// shardResyncSource enqueues every Fgtech of the shard when the shard
+// changes: the namespaces taken over from a departed replica are reconciled
+// without waiting for their next event.
+type shardResyncSource struct {
+	shard  Sharder
+	reader client.Reader
+	log    logr.Logger
+}
+
+func (s shardResyncSource) Start(ctx context.Context, queue workqueue.RateLimitingInterface) error {
+	s.shard.OnChange(func() {
+		var list fgtechv1.FgtechList
+		if err := s.reader.List(ctx, &list); err != nil {
+			s.log.Error(err, "unable to list fgteches after shard change")
+			return
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			if s.shard.Owns(item.Namespace) {
+				queue.Add(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(item)})
+			}
+		}
+	})
+	return nil
+}
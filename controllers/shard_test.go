@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// staticShard owns a fixed set of namespaces.
+type staticShard struct {
+	namespaces map[string]bool
+	listeners  []func()
+}
+
+func (s *staticShard) Owns(namespace string) bool { return namespace == "" || s.namespaces[namespace] }
+
+func (s *staticShard) OnChange(fn func()) { s.listeners = append(s.listeners, fn) }
+
+func TestReconcileSkipsOtherShards(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "team-b", CreationTimestamp: metav1.NewTime(now)},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	r, cl := newTestReconciler(t, now, fg)
+	r.Shard = &staticShard{namespaces: map[string]bool{"team-a": true}}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "team-b"}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(context.Background(), types.NamespacedName{Namespace: "team-b", Name: pod.PodNameFor(fg)}, &corev1.Pod{}); err == nil {
+		t.Fatalf("expected no pod for a namespace of another shard")
+	}
+}
+
+func TestTTLWatcherSweepsOwnShardOnly(t *testing.T) {
+	now := time.Now()
+	expired := func(namespace string) *fgtechv1.Fgtech {
+		return &fgtechv1.Fgtech{ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         namespace,
+			CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+		}}
+	}
+	mine, theirs := expired("team-a"), expired("team-b")
+	cl := fake.NewClientBuilder().WithScheme(newScheme(t)).WithRuntimeObjects(mine, theirs).Build()
+	w := NewTTLWatcher(cl, logr.Discard(), TTLWatcherOptions{
+		DefaultTTLSeconds: 3600,
+		IngressHost:       "example.com",
+		IngressTLSSecret:  "fgtech-tls",
+		Shard:             &staticShard{namespaces: map[string]bool{"team-a": true}},
+	}).(*ttlWatcher)
+
+	if err := w.sweep(context.Background(), now); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(mine), &fgtechv1.Fgtech{}); err == nil {
+		t.Fatalf("expected the fgtech of the own shard to be removed")
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(theirs), &fgtechv1.Fgtech{}); err != nil {
+		t.Fatalf("expected the fgtech of another shard to remain, got err: %v", err)
+	}
+}
+
+func TestShardResyncEnqueuesOwnedFgtechs(t *testing.T) {
+	objs := []client.Object{
+		&fgtechv1.Fgtech{ObjectMeta: metav1.ObjectMeta{Name: "one", Namespace: "team-a"}},
+		&fgtechv1.Fgtech{ObjectMeta: metav1.ObjectMeta{Name: "two", Namespace: "team-b"}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(objs...).Build()
+	s := &staticShard{namespaces: map[string]bool{"team-a": true}}
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	if err := (shardResyncSource{shard: s, reader: cl, log: logr.Discard()}).Start(context.Background(), queue); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	// The namespaces of a departed replica move here.
+	s.namespaces["team-b"] = true
+	for _, fn := range s.listeners {
+		fn()
+	}
+	if queue.Len() != 2 {
+		t.Fatalf("queue holds %d requests, want 2", queue.Len())
+	}
+}
+
+func TestIngressSyncDropsOtherShards(t *testing.T) {
+	ingressSync := &IngressSyncReconciler{Shard: &staticShard{namespaces: map[string]bool{"team-a": true}}}
+	ingressSync.Enqueue("team-b")
+	if len(ingressSync.pending) != 0 {
+		t.Fatalf("ingress sync of another shard queued: %v", ingressSync.pending)
+	}
+}
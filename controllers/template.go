@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/template"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// renderTemplate renders spec.templateRef, records the outcome in status and
+// returns a copy of fg carrying the effective spec. A failed rendering is
+// reported through the TemplateRendered condition while the last successful
+// one, kept in status.template, keeps serving. It returns nil when there is
+// nothing to run yet.
+func (r *FgtechReconciler) renderTemplate(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) (*fgtechv1.Fgtech, error) {
+	status := fg.Status.DeepCopy()
+	ref := fg.Spec.TemplateRef
+	if ref == nil {
+		status.Template = nil
+		meta.RemoveStatusCondition(&status.Conditions, fgtechv1.ConditionTemplateRendered)
+	} else {
+		cond, err := r.render(ctx, fg, status)
+		if err != nil {
+			return nil, err
+		}
+		prev := meta.FindStatusCondition(fg.Status.Conditions, fgtechv1.ConditionTemplateRendered)
+		if cond.Status == metav1.ConditionFalse && (prev == nil || prev.Reason != cond.Reason || prev.Message != cond.Message) {
+			log.Info("template rendering failed", "template", ref.Name, "reason", cond.Reason, "message", cond.Message)
+			r.recordEvent(fg, corev1.EventTypeWarning, cond.Reason, cond.Message)
+		}
+		meta.SetStatusCondition(&status.Conditions, cond)
+	}
+
+	if !equality.Semantic.DeepEqual(fg.Status, *status) {
+		fg.Status = *status
+		if err := r.Status().Update(ctx, fg); err != nil {
+			return nil, err
+		}
+	}
+
+	if ref != nil && (fg.Status.Template == nil || fg.Status.Template.Name != ref.Name) {
+		return nil, nil
+	}
+	return renderedFgtech(fg), nil
+}
+
+// render fetches and renders the referenced template into status.template and
+// returns the resulting TemplateRendered condition.
+func (r *FgtechReconciler) render(ctx context.Context, fg *fgtechv1.Fgtech, status *fgtechv1.FgtechStatus) (metav1.Condition, error) {
+	ref := fg.Spec.TemplateRef
+	cond := metav1.Condition{
+		Type:               fgtechv1.ConditionTemplateRendered,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: fg.Generation,
+		LastTransitionTime: metav1.NewTime(r.now().Truncate(time.Second)),
+	}
+
+	var tmpl fgtechv1.FgtechTemplate
+	if err := r.Get(ctx, types.NamespacedName{Namespace: fg.Namespace, Name: ref.Name}, &tmpl); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return cond, err
+		}
+		cond.Reason = "TemplateNotFound"
+		cond.Message = fmt.Sprintf("template %s not found", ref.Name)
+		return cond, nil
+	}
+
+	rendered, values, err := template.Render(&tmpl, ref.Parameters)
+	if err != nil {
+		var perr *template.ParameterError
+		cond.Reason = "InvalidTemplate"
+		if errors.As(err, &perr) {
+			cond.Reason = "InvalidParameters"
+		}
+		cond.Message = fmt.Sprintf("template %s: %s", ref.Name, err.Error())
+		return cond, nil
+	}
+	if fg.Spec.Image == "" && rendered.Image == "" {
+		cond.Reason = "InvalidTemplate"
+		cond.Message = fmt.Sprintf("template %s sets no image and the fgtech neither", ref.Name)
+		return cond, nil
+	}
+
+	status.Template = &fgtechv1.TemplateStatus{
+		Name:               ref.Name,
+		ObservedGeneration: tmpl.Generation,
+		Parameters:         values,
+		Rendered:           *rendered,
+	}
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = "Rendered"
+	cond.Message = fmt.Sprintf("template %s generation %d rendered", ref.Name, tmpl.Generation)
+	return cond, nil
+}
+
+// renderedFgtech returns fg with its spec completed by the rendering recorded
+// in status, or fg itself when it uses no template.
+func renderedFgtech(fg *fgtechv1.Fgtech) *fgtechv1.Fgtech {
+	if fg.Spec.TemplateRef == nil || fg.Status.Template == nil {
+		return fg
+	}
+	out := fg.DeepCopy()
+	out.Spec = template.Apply(fg.Spec, &fg.Status.Template.Rendered)
+	return out
+}
+
+// fgtechesForTemplate enqueues the Fgtech resources rendering a template.
+func (r *FgtechReconciler) fgtechesForTemplate(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list fgtechv1.FgtechList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list fgteches for template", "template", obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, item := range list.Items {
+		if item.Spec.TemplateRef != nil && item.Spec.TemplateRef.Name == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
+	}
+	return requests
+}
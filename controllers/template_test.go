@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileRendersTemplate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tmpl := &fgtechv1.FgtechTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "notebook", Namespace: "default", Generation: 1},
+		Spec: fgtechv1.FgtechTemplateSpec{
+			Parameters: []fgtechv1.TemplateParameter{{Name: "tag"}},
+			Template: fgtechv1.WorkloadTemplate{
+				Image:   "ghcr.io/fgtech/notebook:${tag}",
+				Command: []string{"jupyter", "lab"},
+				Env:     []corev1.EnvVar{{Name: "NOTEBOOK_TAG", Value: "${tag}"}},
+			},
+		},
+	}
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+		},
+		Spec: fgtechv1.FgtechSpec{
+			Version:     "1.0.0",
+			TemplateRef: &fgtechv1.TemplateRef{Name: "notebook", Parameters: map[string]string{"tag": "4.1"}},
+		},
+	}
+	r, cl := newTestReconciler(t, now, tmpl, fg)
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo", Namespace: "default"}}
+	podKey := types.NamespacedName{Namespace: "default", Name: pod.PodNameFor(fg)}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	var p corev1.Pod
+	if err := cl.Get(ctx, podKey, &p); err != nil {
+		t.Fatalf("get pod: %v", err)
+	}
+	c := p.Spec.Containers[0]
+	if c.Image != "ghcr.io/fgtech/notebook:4.1" || len(c.Command) != 2 || c.Command[0] != "jupyter" {
+		t.Fatalf("pod not built from the template: image %s command %v", c.Image, c.Command)
+	}
+	if !hasEnv(c.Env, "NOTEBOOK_TAG", "4.1") {
+		t.Fatalf("expected rendered env, got %v", c.Env)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Spec.Image != "" {
+		t.Fatalf("rendered spec must not be persisted, got image %s", got.Spec.Image)
+	}
+	if got.Status.Template == nil || got.Status.Template.Rendered.Image != "ghcr.io/fgtech/notebook:4.1" {
+		t.Fatalf("unexpected template status %+v", got.Status.Template)
+	}
+	if !meta.IsStatusConditionTrue(got.Status.Conditions, fgtechv1.ConditionTemplateRendered) {
+		t.Fatalf("expected TemplateRendered to be True: %+v", got.Status.Conditions)
+	}
+
+	// Invalid parameters keep the last rendering in place.
+	got.Spec.TemplateRef.Parameters = map[string]string{"version": "5"}
+	if err := cl.Update(ctx, &got); err != nil {
+		t.Fatalf("update fgtech: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, fgtechv1.ConditionTemplateRendered)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "InvalidParameters" {
+		t.Fatalf("unexpected TemplateRendered condition %+v", cond)
+	}
+	if err := cl.Get(ctx, podKey, &p); err != nil || p.Spec.Containers[0].Image != "ghcr.io/fgtech/notebook:4.1" {
+		t.Fatalf("expected the pod to keep the last rendering, err %v", err)
+	}
+
+	// A template change re-renders and replaces the pod.
+	got.Spec.TemplateRef.Parameters = map[string]string{"tag": "4.1"}
+	if err := cl.Update(ctx, &got); err != nil {
+		t.Fatalf("update fgtech: %v", err)
+	}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(tmpl), tmpl); err != nil {
+		t.Fatalf("get template: %v", err)
+	}
+	tmpl.Spec.Template.Image = "ghcr.io/fgtech/lab:${tag}"
+	if err := cl.Update(ctx, tmpl); err != nil {
+		t.Fatalf("update template: %v", err)
+	}
+	if requests := r.fgtechesForTemplate(ctx, tmpl); len(requests) != 1 || requests[0].Name != "demo" {
+		t.Fatalf("fgtechesForTemplate = %v, want demo", requests)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(ctx, podKey, &p); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the outdated pod to be deleted, got err %v", err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := cl.Get(ctx, podKey, &p); err != nil || p.Spec.Containers[0].Image != "ghcr.io/fgtech/lab:4.1" {
+		t.Fatalf("expected the pod to follow the template, err %v", err)
+	}
+}
+
+func hasEnv(env []corev1.EnvVar, name, value string) bool {
+	for _, e := range env {
+		if e.Name == name && e.Value == value {
+			return true
+		}
+	}
+	return false
+}
@@ -2,85 +2,279 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/archive"
+	"github.com/fgtech/ia/cursor/pkg/class"
 	"github.com/fgtech/ia/cursor/pkg/ingress"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/fgtech/ia/cursor/pkg/notify"
 	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/fgtech/ia/cursor/pkg/tracing"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
-const ttlWatcherInterval = time.Minute
+// DefaultTTLSweepInterval is the safety-net sweep period used when none is configured.
+// Expiry itself is driven by the reconciler through RequeueAfter.
+const DefaultTTLSweepInterval = 10 * time.Minute
 
-// ttlWatcher periodically cleans up expired Fgtech resources.
+// TTLWatcherLivenessIntervals is the number of sweep intervals without a
+// completed sweep after which the watcher is reported as wedged.
+const TTLWatcherLivenessIntervals = 3
+
+// ttlWatcher periodically cleans up expired Fgtech resources that the
+// reconciler may have missed (operator downtime, lost requeues).
 type ttlWatcher struct {
 	client            client.Client
 	log               logr.Logger
+	mu                sync.Mutex
+	reset             chan struct{}
+	clock             clock.WithTicker
+	interval          time.Duration
 	defaultTTLSeconds int64
 	ingressHost       string
 	ingressTLSSecret  string
 	ingressClassName  string
+	expiryPolicy      string
+	activatorHost     string
+	notifier          notify.Publisher
+	recorder          record.EventRecorder
+	archiver          *archive.Archiver
+	classes           *class.Resolver
+	namespaces        []string
+	namespacedRBAC    bool
+	ingressSync       IngressSyncer
+	shard             Sharder
+
+	// The liveness state has its own lock: a wedged sweep holds mu.
+	liveMu       sync.Mutex
+	running      bool
+	lastProgress time.Time
+	liveInterval time.Duration
+}
+
+// TTLWatcherOptions configures the safety-net TTL sweep.
+type TTLWatcherOptions struct {
+	// Interval between sweeps; non-positive values fall back to DefaultTTLSweepInterval.
+	Interval          time.Duration
+	DefaultTTLSeconds int64
+	IngressHost       string
+	IngressTLSSecret  string
+	IngressClassName  string
+	// ActivatorHost mirrors FgtechReconciler.ActivatorHost for ingress resyncs.
+	ActivatorHost string
+	// DefaultExpiryPolicy applies when neither the Fgtech nor its namespace sets one.
+	DefaultExpiryPolicy string
+	// Notifier receives an expired event for every Fgtech removed by the sweep.
+	Notifier notify.Publisher
+	// Recorder, when set, records Expired and ExpiryFailed events on the
+	// Fgtech resources expired by the sweep, and their route changes.
+	Recorder record.EventRecorder
+	// Archiver snapshots Fgtech resources before the delete policy removes them.
+	Archiver *archive.Archiver
+	// Namespaces restricts the sweep to these namespaces; empty sweeps all of them.
+	Namespaces []string
+	// NamespacedRBAC mirrors FgtechReconciler.NamespacedRBAC: classes are ignored.
+	NamespacedRBAC bool
+	// IngressSync mirrors FgtechReconciler.IngressSync.
+	IngressSync IngressSyncer
+	// Shard, when set, limits the sweep to the namespaces of this replica.
+	Shard Sharder
+}
+
+// TTLWatcher is the safety-net sweep; it follows operator configuration changes.
+type TTLWatcher interface {
+	manager.Runnable
+	manager.LeaderElectionRunnable
+	Reconfigurable
+	// LivenessCheck is a healthz.Checker failing when no sweep has completed
+	// within TTLWatcherLivenessIntervals intervals.
+	LivenessCheck(req *http.Request) error
 }
 
 // NewTTLWatcher registers a periodic cleanup task that removes expired resources.
-func NewTTLWatcher(c client.Client, log logr.Logger, defaultTTLSeconds int64, ingressHost, ingressTLSSecret, ingressClassName string) manager.Runnable {
+func NewTTLWatcher(c client.Client, log logr.Logger, opts TTLWatcherOptions) TTLWatcher {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultTTLSweepInterval
+	}
 	return &ttlWatcher{
 		client:            c,
 		log:               log,
-		defaultTTLSeconds: defaultTTLSeconds,
-		ingressHost:       ingressHost,
-		ingressTLSSecret:  ingressTLSSecret,
-		ingressClassName:  ingressClassName,
+		reset:             make(chan struct{}, 1),
+		clock:             clock.RealClock{},
+		interval:          interval,
+		defaultTTLSeconds: opts.DefaultTTLSeconds,
+		ingressHost:       opts.IngressHost,
+		ingressTLSSecret:  opts.IngressTLSSecret,
+		ingressClassName:  opts.IngressClassName,
+		expiryPolicy:      opts.DefaultExpiryPolicy,
+		activatorHost:     opts.ActivatorHost,
+		notifier:          opts.Notifier,
+		recorder:          opts.Recorder,
+		archiver:          opts.Archiver,
+		namespaces:        opts.Namespaces,
+		namespacedRBAC:    opts.NamespacedRBAC,
+		ingressSync:       opts.IngressSync,
+		shard:             opts.Shard,
 	}
 }
 
 // Start implements manager.Runnable.
 func (w *ttlWatcher) Start(ctx context.Context) error {
-	ticker := time.NewTicker(ttlWatcherInterval)
-	defer ticker.Stop()
+	interval := w.currentInterval()
+	ticker := w.clock.NewTicker(interval)
+	w.progress(true, interval)
+	defer func() {
+		ticker.Stop()
+		w.progress(false, interval)
+	}()
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-ticker.C:
-			if err := w.sweep(ctx, time.Now()); err != nil {
+		case <-w.reset:
+			ticker.Stop()
+			interval = w.currentInterval()
+			ticker = w.clock.NewTicker(interval)
+			w.progress(true, interval)
+		case <-ticker.C():
+			if err := w.sweep(ctx, w.clock.Now()); err != nil {
 				w.log.Error(err, "ttl sweep failed")
 			}
+			// A failed sweep still proves the loop runs; restarting the
+			// operator would not bring the API server back.
+			w.progress(true, interval)
 		}
 	}
 }
 
-func (w *ttlWatcher) sweep(ctx context.Context, now time.Time) error {
-	var list fgtechv1.FgtechList
-	if err := w.client.List(ctx, &list); err != nil {
+// NeedLeaderElection implements manager.LeaderElectionRunnable: with leader
+// election on, only the leader sweeps. Without it, as in sharding mode, every
+// replica sweeps its own namespaces.
+func (w *ttlWatcher) NeedLeaderElection() bool {
+	return true
+}
+
+// progress records that the sweep loop started, completed a sweep or
+// restarted its ticker, or that it stopped when running is false.
+func (w *ttlWatcher) progress(running bool, interval time.Duration) {
+	w.liveMu.Lock()
+	defer w.liveMu.Unlock()
+	w.running = running
+	w.lastProgress = w.clock.Now()
+	w.liveInterval = interval
+}
+
+// LivenessCheck implements TTLWatcher. It passes while the loop is not
+// running, as on the replicas not holding the leader lease.
+func (w *ttlWatcher) LivenessCheck(_ *http.Request) error {
+	w.liveMu.Lock()
+	defer w.liveMu.Unlock()
+	if !w.running {
+		return nil
+	}
+	if since := w.clock.Since(w.lastProgress); since > TTLWatcherLivenessIntervals*w.liveInterval {
+		return fmt.Errorf("no TTL sweep completed for %s, sweep interval %s", since.Round(time.Second), w.liveInterval)
+	}
+	return nil
+}
+
+// Reconfigure implements Reconfigurable. A new interval restarts the ticker.
+func (w *ttlWatcher) Reconfigure(cfg OperatorConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.defaultTTLSeconds = cfg.DefaultTTLSeconds
+	w.ingressHost = cfg.IngressHost
+	w.ingressTLSSecret = cfg.IngressTLSSecret
+	w.ingressClassName = cfg.IngressClassName
+	w.expiryPolicy = cfg.ExpiryPolicy
+	w.activatorHost = cfg.ActivatorHost
+	w.classes = nil
+	if cfg.TTLSweepInterval > 0 && cfg.TTLSweepInterval != w.interval {
+		w.interval = cfg.TTLSweepInterval
+		select {
+		case w.reset <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *ttlWatcher) currentInterval() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.interval
+}
+
+func (w *ttlWatcher) sweep(ctx context.Context, now time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "TTL.sweep")
+	defer func() { tracing.End(span, "", err) }()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list, err := w.list(ctx)
+	if err != nil {
 		return err
 	}
 
+	expired := 0
 	namespacesToSync := make(map[string]struct{})
 	for i := range list.Items {
 		item := list.Items[i]
-		ttl := pod.ResolveTTLSeconds(&item, w.defaultTTLSeconds)
-		if ttl <= 0 {
+		if isDormant(&item) || item.IsPaused() || !owns(w.shard, item.Namespace) {
 			continue
 		}
-		expiry := item.CreationTimestamp.Time.Add(time.Duration(ttl) * time.Second)
-		if now.Before(expiry) {
+		var ttl int64
+		if item.Status.ExpiresAt == nil {
+			settings, err := w.classResolver().Resolve(ctx, &item)
+			if err != nil {
+				w.log.Error(err, "failed to resolve fgtech class", "name", item.Name, "namespace", item.Namespace)
+				continue
+			}
+			ttl = settings.TTLSeconds(&item)
+		}
+		expiry, ok := pod.ExpiryFor(&item, ttl)
+		if !ok || now.Before(expiry) {
 			continue
 		}
-		if err := w.cleanup(ctx, &item); err != nil {
+		policy, err := w.cleanup(ctx, &item)
+		if err != nil {
 			w.log.Error(err, "failed to cleanup expired fgtech", "name", item.Name, "namespace", item.Namespace)
+			w.event(&item, corev1.EventTypeWarning, "ExpiryFailed", fmt.Sprintf("TTL reached, expiry policy not applied: %v", err))
 			continue
 		}
+		w.event(&item, corev1.EventTypeNormal, "Expired", fmt.Sprintf("TTL reached, %s policy applied", policy))
+		if w.notifier != nil {
+			w.notifier.Publish(notify.Event{
+				Type:      notify.TypeExpired,
+				Namespace: item.Namespace,
+				Name:      item.Name,
+				Data: map[string]string{
+					"expiresAt": expiry.UTC().Format(time.RFC3339),
+					"policy":    policy,
+				},
+			})
+		}
+		expired++
 		namespacesToSync[item.Namespace] = struct{}{}
 	}
+	metrics.SweepExpirations.Observe(float64(expired))
+	span.SetAttributes(tracing.AttrExpired.Int(expired))
 
-	if len(namespacesToSync) > 0 {
-		ingMgr := ingress.NewManager(w.client, w.ingressHost, w.ingressTLSSecret, w.ingressClassName)
+	if w.ingressSync != nil {
+		for ns := range namespacesToSync {
+			w.ingressSync.Enqueue(ns)
+		}
+	} else if len(namespacesToSync) > 0 {
+		ingMgr := ingress.NewManager(w.client, w.ingressHost, w.ingressTLSSecret, w.classResolver(), ingressOptions(w.activatorHost, w.recorder)...)
 		for ns := range namespacesToSync {
 			if err := ingMgr.SyncNamespace(ctx, ns, w.log); err != nil {
 				w.log.Error(err, "failed to sync ingress after ttl cleanup", "namespace", ns)
@@ -91,36 +285,45 @@ func (w *ttlWatcher) sweep(ctx context.Context, now time.Time) error {
 	return nil
 }
 
-func (w *ttlWatcher) cleanup(ctx context.Context, fg *fgtechv1.Fgtech) error {
-	deleteIgnoreNotFound := func(obj client.Object) error {
-		err := w.client.Delete(ctx, obj)
-		if err != nil && !apierrors.IsNotFound(err) {
-			return err
-		}
-		return nil
+func (w *ttlWatcher) event(fg *fgtechv1.Fgtech, eventType, reason, message string) {
+	if w.recorder != nil {
+		w.recorder.Event(fg, eventType, reason, message)
 	}
+}
 
-	if err := deleteIgnoreNotFound(&corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      pod.PodNameFor(fg),
-			Namespace: fg.Namespace,
-		},
-	}); err != nil {
-		return err
+// list returns the Fgtech resources of the watched namespaces.
+func (w *ttlWatcher) list(ctx context.Context) (fgtechv1.FgtechList, error) {
+	var list fgtechv1.FgtechList
+	if len(w.namespaces) == 0 {
+		err := w.client.List(ctx, &list)
+		return list, err
 	}
-
-	if err := deleteIgnoreNotFound(&corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      pod.ServiceNameFor(fg),
-			Namespace: fg.Namespace,
-		},
-	}); err != nil {
-		return err
+	for _, ns := range w.namespaces {
+		var items fgtechv1.FgtechList
+		if err := w.client.List(ctx, &items, client.InNamespace(ns)); err != nil {
+			return list, err
+		}
+		list.Items = append(list.Items, items.Items...)
 	}
+	return list, nil
+}
 
-	if err := deleteIgnoreNotFound(fg); err != nil {
-		return err
-	}
+func (w *ttlWatcher) cleanup(ctx context.Context, fg *fgtechv1.Fgtech) (string, error) {
+	e := &expirer{client: w.client, defaultPolicy: w.expiryPolicy, archiver: w.archiver}
+	return e.expire(ctx, fg, w.log)
+}
 
-	return nil
+// classResolver applies the operator defaults where no FgtechClass does.
+func (w *ttlWatcher) classResolver() *class.Resolver {
+	if w.classes == nil {
+		var reader client.Reader = w.client
+		if w.namespacedRBAC {
+			reader = nil
+		}
+		w.classes = class.NewResolver(reader, class.Defaults{
+			TTLSeconds:       w.defaultTTLSeconds,
+			IngressClassName: w.ingressClassName,
+		})
+	}
+	return w.classes
 }
@@ -6,12 +6,15 @@ import (
 	"time"
 
 	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
 	"github.com/fgtech/ia/cursor/pkg/pod"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
@@ -48,10 +51,14 @@ func TestTTLWatcherDeletesExpiredResources(t *testing.T) {
 		ingressHost:       "example.com",
 		ingressTLSSecret:  "fgtech-tls",
 	}
+	deleted := testutil.ToFloat64(metrics.Expirations.WithLabelValues(fgtechv1.ExpiryPolicyDelete))
 
 	if err := w.sweep(context.Background(), now); err != nil {
 		t.Fatalf("sweep: %v", err)
 	}
+	if got := testutil.ToFloat64(metrics.Expirations.WithLabelValues(fgtechv1.ExpiryPolicyDelete)) - deleted; got != 1 {
+		t.Fatalf("delete expirations = %v, want 1", got)
+	}
 
 	assertNotFound := func(obj clientObject, desc string) {
 		err := cl.Get(context.Background(), client.ObjectKey{Namespace: fg.Namespace, Name: obj.GetName()}, obj)
@@ -106,3 +113,120 @@ type clientObject interface {
 func int64Ptr(v int64) *int64 {
 	return &v
 }
+
+func TestTTLWatcherLeavesTeardownToFinalizer(t *testing.T) {
+	now := time.Now()
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "demo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+			Finalizers:        []string{fgtechv1.FinalizerCleanup},
+		},
+	}
+	podObj := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod.PodNameFor(fg), Namespace: fg.Namespace}}
+
+	cl := fake.NewClientBuilder().WithScheme(newScheme(t)).WithRuntimeObjects(fg, podObj).Build()
+	w := &ttlWatcher{
+		client:            cl,
+		log:               logr.Discard(),
+		defaultTTLSeconds: 3600,
+		ingressHost:       "example.com",
+		ingressTLSSecret:  "fgtech-tls",
+	}
+
+	if err := w.sweep(context.Background(), now); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.DeletionTimestamp.IsZero() {
+		t.Fatalf("expected deletion to be requested")
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(podObj), &corev1.Pod{}); err != nil {
+		t.Fatalf("pod must be left to the finalizer: %v", err)
+	}
+}
+
+func TestTTLWatcherSweepsWatchedNamespacesOnly(t *testing.T) {
+	now := time.Now()
+	expired := func(namespace string) *fgtechv1.Fgtech {
+		return &fgtechv1.Fgtech{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "demo",
+				Namespace:         namespace,
+				CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+			},
+		}
+	}
+	watched, other := expired("team-a"), expired("team-b")
+
+	cl := fake.NewClientBuilder().WithScheme(newScheme(t)).WithRuntimeObjects(watched, other).Build()
+	w := NewTTLWatcher(cl, logr.Discard(), TTLWatcherOptions{
+		DefaultTTLSeconds: 3600,
+		IngressHost:       "example.com",
+		IngressTLSSecret:  "fgtech-tls",
+		Namespaces:        []string{"team-a"},
+		NamespacedRBAC:    true,
+	}).(*ttlWatcher)
+
+	if err := w.sweep(context.Background(), now); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(watched), &fgtechv1.Fgtech{}); err == nil {
+		t.Fatalf("expected the fgtech of the watched namespace to be removed")
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(other), &fgtechv1.Fgtech{}); err != nil {
+		t.Fatalf("expected the fgtech of another namespace to remain, got err: %v", err)
+	}
+}
+
+func TestTTLWatcherLivenessDetectsWedgedSweep(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(newScheme(t)).Build()
+	w := NewTTLWatcher(cl, logr.Discard(), TTLWatcherOptions{Interval: time.Minute}).(*ttlWatcher)
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	w.clock = fakeClock
+	if err := w.LivenessCheck(nil); err != nil {
+		t.Fatalf("liveness before start: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	eventually := func(desc string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", desc)
+			}
+		}
+	}
+	eventually("the ticker", fakeClock.HasWaiters)
+
+	// Sweeps complete on every tick: the watcher stays alive.
+	for i := 0; i < 5; i++ {
+		fakeClock.Step(time.Minute)
+		eventually("a completed sweep", func() bool { return w.LivenessCheck(nil) == nil })
+	}
+
+	// A sweep stuck on the watcher lock stops the progress.
+	w.mu.Lock()
+	fakeClock.Step(time.Minute)
+	fakeClock.Step(TTLWatcherLivenessIntervals * time.Minute)
+	if err := w.LivenessCheck(nil); err == nil {
+		t.Fatalf("expected the liveness check to fail while the sweep is stuck")
+	}
+	w.mu.Unlock()
+	eventually("the sweep to resume", func() bool { return w.LivenessCheck(nil) == nil })
+}
@@ -0,0 +1,319 @@
+package activator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/activity"
+	"github.com/fgtech/ia/cursor/pkg/ingress"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	defaultWakeTimeout   = 2 * time.Minute
+	defaultMaxConcurrent = 100
+	defaultPollInterval  = time.Second
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fgtech_activator_requests_total",
+		Help: "Requests handled by the activator, by result.",
+	}, []string{"result"})
+	wakeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "fgtech_activator_wake_duration_seconds",
+		Help:    "Time between a request reaching the activator and the instance becoming ready.",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+	})
+	inflightRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "fgtech_activator_inflight_requests",
+		Help: "Requests currently held by the activator.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(requestsTotal, wakeDuration, inflightRequests)
+}
+
+// Options configures an Activator.
+type Options struct {
+	// BindAddress is the address the activator HTTP server listens on.
+	BindAddress string
+	// WakeTimeout bounds how long a request waits for the instance to become ready.
+	WakeTimeout time.Duration
+	// MaxConcurrent caps the requests held at once; extra requests get a 503.
+	MaxConcurrent int
+	// PollInterval is the readiness polling period.
+	PollInterval time.Duration
+	// Target returns the base URL requests are proxied to once the instance is
+	// ready. It defaults to the in-cluster Service URL.
+	Target func(fg *fgtechv1.Fgtech) string
+}
+
+// Activator receives requests for hibernated instances, wakes them up, waits
+// for readiness and proxies the held request. The reconciler then switches the
+// ingress route back to the instance Service.
+type Activator struct {
+	client client.Client
+	log    logr.Logger
+	opts   Options
+	slots  chan struct{}
+}
+
+func New(c client.Client, log logr.Logger, opts Options) *Activator {
+	if opts.WakeTimeout <= 0 {
+		opts.WakeTimeout = defaultWakeTimeout
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = defaultMaxConcurrent
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.Target == nil {
+		opts.Target = activity.ServiceURL
+	}
+	return &Activator{
+		client: c,
+		log:    log,
+		opts:   opts,
+		slots:  make(chan struct{}, opts.MaxConcurrent),
+	}
+}
+
+// Start implements manager.Runnable.
+func (a *Activator) Start(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              a.opts.BindAddress,
+		Handler:           a,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every replica
+// serves requests routed to the activator Service.
+func (a *Activator) NeedLeaderElection() bool {
+	return false
+}
+
+func (a *Activator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case a.slots <- struct{}{}:
+		defer func() { <-a.slots }()
+	default:
+		requestsTotal.WithLabelValues("rejected").Inc()
+		http.Error(w, "activator busy", http.StatusServiceUnavailable)
+		return
+	}
+	inflightRequests.Inc()
+	defer inflightRequests.Dec()
+
+	namespace, err := a.namespaceFor(r.Context(), r.Host, r.URL.Path)
+	var fg *fgtechv1.Fgtech
+	if err == nil {
+		fg, err = a.lookup(r.Context(), r.URL.Path, namespace)
+	}
+	if err != nil {
+		requestsTotal.WithLabelValues("error").Inc()
+		a.log.Error(err, "fgtech lookup failed", "path", r.URL.Path)
+		http.Error(w, "lookup failed", http.StatusBadGateway)
+		return
+	}
+	if fg == nil {
+		requestsTotal.WithLabelValues("not_found").Inc()
+		http.NotFound(w, r)
+		return
+	}
+	log := a.log.WithValues("fgtech", types.NamespacedName{Namespace: fg.Namespace, Name: fg.Name})
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.opts.WakeTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := a.wake(ctx, fg); err != nil {
+		requestsTotal.WithLabelValues("error").Inc()
+		log.Error(err, "wake request failed")
+		http.Error(w, "wake failed", http.StatusBadGateway)
+		return
+	}
+	if err := a.waitReady(ctx, fg); err != nil {
+		if ctx.Err() == nil {
+			requestsTotal.WithLabelValues("error").Inc()
+			log.Error(err, "readiness check failed")
+			http.Error(w, "readiness check failed", http.StatusBadGateway)
+			return
+		}
+		requestsTotal.WithLabelValues("timeout").Inc()
+		log.Info("instance not ready in time", "timeout", a.opts.WakeTimeout)
+		http.Error(w, "instance is waking up, retry shortly", http.StatusGatewayTimeout)
+		return
+	}
+	wakeDuration.Observe(time.Since(start).Seconds())
+
+	target, err := url.Parse(a.opts.Target(fg))
+	if err != nil {
+		requestsTotal.WithLabelValues("error").Inc()
+		log.Error(err, "invalid proxy target")
+		http.Error(w, "invalid target", http.StatusBadGateway)
+		return
+	}
+	requestsTotal.WithLabelValues("proxied").Inc()
+	httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+}
+
+// namespaceFor returns the namespace the request came through: the one whose
+// managed Ingress routes host and path to its activator Service, along the
+// longest route. Requests carry nothing else identifying the namespace that
+// clients could not forge. It returns "" when no Ingress routes the request to
+// the activator, and an error when several namespaces do along the same route.
+func (a *Activator) namespaceFor(ctx context.Context, host, path string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	var list networkingv1.IngressList
+	if err := a.client.List(ctx, &list, client.MatchingLabels(pod.ManagedLabels(""))); err != nil {
+		return "", err
+	}
+	longest, namespaces := "", map[string]bool{}
+	for i := range list.Items {
+		route := ingress.ActivatorRoute(&list.Items[i], host, path)
+		if route == "" || len(route) < len(longest) {
+			continue
+		}
+		if len(route) > len(longest) {
+			longest, namespaces = route, map[string]bool{}
+		}
+		namespaces[list.Items[i].Namespace] = true
+	}
+	if len(namespaces) > 1 {
+		return "", fmt.Errorf("route %s of host %q sent to the activator by %d namespaces", longest, host, len(namespaces))
+	}
+	for namespace := range namespaces {
+		return namespace, nil
+	}
+	return "", nil
+}
+
+// lookup returns the non-archived Fgtech of namespace whose route is the
+// longest prefix of path, querying the route index for each candidate prefix.
+// Without a namespace there is nothing to look up: the same route may exist in
+// several namespaces.
+func (a *Activator) lookup(ctx context.Context, path, namespace string) (*fgtechv1.Fgtech, error) {
+	if namespace == "" {
+		return nil, nil
+	}
+	for _, route := range routeCandidates(path) {
+		var list fgtechv1.FgtechList
+		opts := []client.ListOption{client.MatchingFields{ingress.RouteIndex: route}, client.InNamespace(namespace)}
+		if err := a.client.List(ctx, &list, opts...); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			if list.Items[i].Status.Phase != fgtechv1.PhaseArchived {
+				return &list.Items[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// routeCandidates returns path and its parent paths, longest first:
+// /apps/demo/x gives /apps/demo/x, /apps/demo and /apps.
+func routeCandidates(path string) []string {
+	var candidates []string
+	for path != "" && path != "/" {
+		candidates = append(candidates, path)
+		i := strings.LastIndex(path, "/")
+		if i <= 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return candidates
+}
+
+// wake asks the reconciler to bring a hibernated instance back and records the
+// request as activity for idle mode.
+func (a *Activator) wake(ctx context.Context, fg *fgtechv1.Fgtech) error {
+	if fg.Status.Phase != fgtechv1.PhaseHibernated {
+		return nil
+	}
+	if _, pending := fg.Annotations[fgtechv1.AnnotationWake]; pending {
+		return nil
+	}
+	patch := client.MergeFrom(fg.DeepCopy())
+	if fg.Annotations == nil {
+		fg.Annotations = map[string]string{}
+	}
+	fg.Annotations[fgtechv1.AnnotationWake] = "activator"
+	fg.Annotations[fgtechv1.AnnotationLastActivity] = time.Now().UTC().Format(time.RFC3339)
+	if err := a.client.Patch(ctx, fg, patch); err != nil {
+		return fmt.Errorf("annotate %s: %w", fgtechv1.AnnotationWake, err)
+	}
+	a.log.Info("wake requested", "name", fg.Name, "namespace", fg.Namespace)
+	return nil
+}
+
+// waitReady polls until the instance is Running and its Pod reports Ready.
+func (a *Activator) waitReady(ctx context.Context, fg *fgtechv1.Fgtech) error {
+	key := client.ObjectKeyFromObject(fg)
+	podKey := types.NamespacedName{Namespace: fg.Namespace, Name: pod.PodNameFor(fg)}
+	return wait.PollUntilContextCancel(ctx, a.opts.PollInterval, true, func(ctx context.Context) (bool, error) {
+		var current fgtechv1.Fgtech
+		if err := a.client.Get(ctx, key, &current); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		if current.Status.Phase == fgtechv1.PhaseHibernated {
+			return false, nil
+		}
+		var p corev1.Pod
+		if err := a.client.Get(ctx, podKey, &p); err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return isPodReady(&p), nil
+	})
+}
+
+func isPodReady(p *corev1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,293 @@
+package activator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/ingress"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newActivatorScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client scheme: %v", err)
+	}
+	if err := fgtechv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add fgtech scheme: %v", err)
+	}
+	return scheme
+}
+
+// newActivatorClientBuilder registers the route index the lookup relies on.
+func newActivatorClientBuilder(t *testing.T) *fake.ClientBuilder {
+	t.Helper()
+	return fake.NewClientBuilder().WithScheme(newActivatorScheme(t)).
+		WithIndex(&fgtechv1.Fgtech{}, ingress.RouteIndex, ingress.RouteIndexValue)
+}
+
+func hibernated(name string) *fgtechv1.Fgtech {
+	return &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "demo"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx", Version: "1.0.0", ExtraPath: "/apps"},
+		Status:     fgtechv1.FgtechStatus{Phase: fgtechv1.PhaseHibernated},
+	}
+}
+
+// routed returns the managed Ingress of namespace sending the given routes of
+// example.com to the activator, as the ingress manager does for hibernated
+// instances.
+func routed(namespace string, routes ...string) *networkingv1.Ingress {
+	ing := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name:      "fgtech-global-ingress",
+		Namespace: namespace,
+		Labels:    pod.ManagedLabels(""),
+	}}
+	rule := &networkingv1.HTTPIngressRuleValue{}
+	for _, route := range routes {
+		rule.Paths = append(rule.Paths, networkingv1.HTTPIngressPath{
+			Path: route,
+			Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+				Name: "fgtech-activator",
+				Port: networkingv1.ServiceBackendPort{Number: 80},
+			}},
+		})
+	}
+	ing.Spec.Rules = []networkingv1.IngressRule{{Host: "example.com", IngressRuleValue: networkingv1.IngressRuleValue{HTTP: rule}}}
+	return ing
+}
+
+// fakeReconciler plays the operator: once the wake annotation shows up it marks
+// the instance Running and creates a Ready pod.
+func fakeReconciler(ctx context.Context, t *testing.T, cl client.Client, fg *fgtechv1.Fgtech) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var current fgtechv1.Fgtech
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(fg), &current); err != nil {
+			continue
+		}
+		if _, ok := current.Annotations[fgtechv1.AnnotationWake]; !ok {
+			continue
+		}
+		current.Status.Phase = fgtechv1.PhaseRunning
+		if err := cl.Status().Update(ctx, &current); err != nil {
+			t.Errorf("update status: %v", err)
+			return
+		}
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.PodNameFor(fg), Namespace: fg.Namespace},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			}},
+		}
+		if err := cl.Create(ctx, p); err != nil {
+			t.Errorf("create pod: %v", err)
+		}
+		return
+	}
+}
+
+func TestActivatorWakesAndProxies(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from "+r.URL.Path)
+	}))
+	defer backend.Close()
+
+	fg := hibernated("demo")
+	cl := newActivatorClientBuilder(t).WithObjects(fg, routed("demo", "/apps/demo")).WithStatusSubresource(fg).Build()
+	a := New(cl, logr.Discard(), Options{
+		WakeTimeout:  5 * time.Second,
+		PollInterval: 10 * time.Millisecond,
+		Target:       func(*fgtechv1.Fgtech) string { return backend.URL },
+	})
+	srv := httptest.NewServer(a)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fakeReconciler(ctx, t, cl, fg)
+
+	before := testutil.ToFloat64(requestsTotal.WithLabelValues("proxied"))
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/apps/demo/index.html", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Host = "example.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello from /apps/demo/index.html" {
+		t.Fatalf("response = %d %q", resp.StatusCode, body)
+	}
+	if got := testutil.ToFloat64(requestsTotal.WithLabelValues("proxied")) - before; got != 1 {
+		t.Fatalf("proxied requests = %v, want 1", got)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if got.Annotations[fgtechv1.AnnotationLastActivity] == "" {
+		t.Fatalf("expected last activity to be recorded")
+	}
+}
+
+func TestActivatorTimesOut(t *testing.T) {
+	fg := hibernated("sleepy")
+	cl := newActivatorClientBuilder(t).WithObjects(fg, routed("demo", "/apps/sleepy")).WithStatusSubresource(fg).Build()
+	a := New(cl, logr.Discard(), Options{WakeTimeout: 50 * time.Millisecond, PollInterval: 10 * time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apps/sleepy", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", rec.Code)
+	}
+
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(fg), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if _, ok := got.Annotations[fgtechv1.AnnotationWake]; !ok {
+		t.Fatalf("expected wake annotation to be set")
+	}
+}
+
+func TestActivatorRejectsBeyondConcurrencyLimit(t *testing.T) {
+	cl := newActivatorClientBuilder(t).Build()
+	a := New(cl, logr.Discard(), Options{MaxConcurrent: 1})
+	a.slots <- struct{}{}
+
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apps/demo", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+}
+
+func TestActivatorUnknownPath(t *testing.T) {
+	cl := newActivatorClientBuilder(t).WithObjects(hibernated("demo"), routed("demo", "/apps/demo")).Build()
+	a := New(cl, logr.Discard(), Options{})
+
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apps/demolition", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestActivatorLookup(t *testing.T) {
+	nested := hibernated("demo-x")
+	nested.Spec.ExtraPath = "/apps/demo"
+	other := hibernated("demo")
+	other.Namespace = "other"
+	archived := hibernated("old")
+	archived.Status.Phase = fgtechv1.PhaseArchived
+	cl := newActivatorClientBuilder(t).WithObjects(hibernated("demo"), nested, other, archived).Build()
+	a := New(cl, logr.Discard(), Options{})
+
+	tests := []struct {
+		path      string
+		namespace string
+		want      string
+	}{
+		{path: "/apps/demo", namespace: "demo", want: "demo/demo"},
+		{path: "/apps/demo/static/app.js", namespace: "demo", want: "demo/demo"},
+		{path: "/apps/demo/demo-x/", namespace: "demo", want: "demo/demo-x"},
+		{path: "/apps/demo", namespace: "other", want: "other/demo"},
+		{path: "/apps/demo"},
+		{path: "/apps/old", namespace: "demo"},
+		{path: "/apps/demolition", namespace: "demo"},
+		{path: "/", namespace: "demo"},
+	}
+	for _, tt := range tests {
+		fg, err := a.lookup(context.Background(), tt.path, tt.namespace)
+		if err != nil {
+			t.Fatalf("lookup(%q): %v", tt.path, err)
+		}
+		got := ""
+		if fg != nil {
+			got = fg.Namespace + "/" + fg.Name
+		}
+		if got != tt.want {
+			t.Fatalf("lookup(%q, %q) = %q, want %q", tt.path, tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestActivatorNamespaceFromIngress(t *testing.T) {
+	running := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "fgtech-global-ingress", Namespace: "running", Labels: pod.ManagedLabels("")}}
+	running.Spec.Rules = []networkingv1.IngressRule{{Host: "example.com", IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+		Paths: []networkingv1.HTTPIngressPath{{Path: "/apps/demo", Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: "demo"}}}},
+	}}}}
+	cl := newActivatorClientBuilder(t).WithObjects(
+		routed("demo", "/apps/demo", "/apps/x"),
+		routed("other", "/apps/demo/nested", "/apps/x"),
+		running,
+	).Build()
+	a := New(cl, logr.Discard(), Options{})
+
+	tests := []struct {
+		host, path string
+		want       string
+		wantErr    bool
+	}{
+		{host: "example.com", path: "/apps/demo/index.html", want: "demo"},
+		{host: "example.com:443", path: "/apps/demo", want: "demo"},
+		{host: "example.com", path: "/apps/demo/nested/x", want: "other"},
+		{host: "example.com", path: "/apps/demolition"},
+		{host: "elsewhere.com", path: "/apps/demo"},
+		{host: "example.com", path: "/apps/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := a.namespaceFor(context.Background(), tt.host, tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Fatalf("namespaceFor(%q, %q) = %q, %v; want %q, error %v", tt.host, tt.path, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestActivatorIgnoresNamespaceHeader(t *testing.T) {
+	other := hibernated("demo")
+	other.Namespace = "other"
+	cl := newActivatorClientBuilder(t).WithObjects(other, routed("demo", "/apps/demo")).Build()
+	a := New(cl, logr.Discard(), Options{})
+
+	req := httptest.NewRequest(http.MethodGet, "/apps/demo", nil)
+	req.Header.Set("X-Fgtech-Namespace", "other")
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	var got fgtechv1.Fgtech
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(other), &got); err != nil {
+		t.Fatalf("get fgtech: %v", err)
+	}
+	if _, ok := got.Annotations[fgtechv1.AnnotationWake]; ok {
+		t.Fatalf("the fgtech of another namespace was woken")
+	}
+}
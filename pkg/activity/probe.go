@@ -0,0 +1,108 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+)
+
+// defaultHTTPClient keeps a hung heartbeat endpoint from blocking a reconcile.
+var defaultHTTPClient = &http.Client{Timeout: 5 * time.Second}
+
+// Probe reports the last activity observed for a Fgtech instance.
+// The boolean is false when no activity has been reported yet.
+type Probe interface {
+	LastActivity(ctx context.Context, fg *fgtechv1.Fgtech) (time.Time, bool, error)
+}
+
+// AnnotationProbe reads the fgtech.io/last-activity annotation written by the instance.
+type AnnotationProbe struct{}
+
+func (AnnotationProbe) LastActivity(_ context.Context, fg *fgtechv1.Fgtech) (time.Time, bool, error) {
+	v := fg.Annotations[fgtechv1.AnnotationLastActivity]
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s annotation %q: %w", fgtechv1.AnnotationLastActivity, v, err)
+	}
+	return t, true, nil
+}
+
+// HTTPProbe queries the heartbeat path declared in spec.idle on the instance Service.
+type HTTPProbe struct {
+	Client *http.Client
+	// BaseURL returns the scheme and host used to reach the instance. It
+	// defaults to the in-cluster Service DNS name.
+	BaseURL func(fg *fgtechv1.Fgtech) string
+}
+
+type heartbeat struct {
+	LastActivity string `json:"lastActivity"`
+}
+
+func (p *HTTPProbe) LastActivity(ctx context.Context, fg *fgtechv1.Fgtech) (time.Time, bool, error) {
+	if fg.Spec.Idle == nil || fg.Spec.Idle.HeartbeatPath == "" {
+		return time.Time{}, false, nil
+	}
+	base := ServiceURL(fg)
+	if p.BaseURL != nil {
+		base = p.BaseURL(fg)
+	}
+	url := strings.TrimRight(base, "/") + "/" + strings.TrimLeft(fg.Spec.Idle.HeartbeatPath, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	httpClient := p.Client
+	if httpClient == nil {
+		httpClient = defaultHTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, false, fmt.Errorf("heartbeat %s returned %d", url, resp.StatusCode)
+	}
+
+	var hb heartbeat
+	if err := json.NewDecoder(resp.Body).Decode(&hb); err != nil {
+		return time.Time{}, false, fmt.Errorf("decode heartbeat: %w", err)
+	}
+	if hb.LastActivity == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, hb.LastActivity)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid heartbeat lastActivity %q: %w", hb.LastActivity, err)
+	}
+	return t, true, nil
+}
+
+// DefaultProbe uses the heartbeat endpoint when one is declared and falls back
+// to the last-activity annotation otherwise.
+type DefaultProbe struct {
+	HTTP HTTPProbe
+}
+
+func (p *DefaultProbe) LastActivity(ctx context.Context, fg *fgtechv1.Fgtech) (time.Time, bool, error) {
+	if fg.Spec.Idle != nil && fg.Spec.Idle.HeartbeatPath != "" {
+		return p.HTTP.LastActivity(ctx, fg)
+	}
+	return AnnotationProbe{}.LastActivity(ctx, fg)
+}
+
+// ServiceURL returns the in-cluster URL of the Service fronting a Fgtech.
+func ServiceURL(fg *fgtechv1.Fgtech) string {
+	return fmt.Sprintf("http://%s.%s.svc", pod.ServiceNameFor(fg), fg.Namespace)
+}
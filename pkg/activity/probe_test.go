@@ -0,0 +1,63 @@
+package activity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnnotationProbe(t *testing.T) {
+	fg := &fgtechv1.Fgtech{ObjectMeta: metav1.ObjectMeta{
+		Name:        "demo",
+		Namespace:   "default",
+		Annotations: map[string]string{fgtechv1.AnnotationLastActivity: "2024-06-01T10:00:00Z"},
+	}}
+
+	got, ok, err := AnnotationProbe{}.LastActivity(context.Background(), fg)
+	if err != nil || !ok {
+		t.Fatalf("LastActivity = %v, %v, %v", got, ok, err)
+	}
+	if want := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("LastActivity = %s, want %s", got, want)
+	}
+
+	fg.Annotations[fgtechv1.AnnotationLastActivity] = "yesterday"
+	if _, _, err := (AnnotationProbe{}).LastActivity(context.Background(), fg); err == nil {
+		t.Fatalf("expected error for malformed annotation")
+	}
+}
+
+func TestHTTPProbeReadsHeartbeat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz/activity" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"lastActivity":"2024-06-01T11:30:00Z"}`))
+	}))
+	defer srv.Close()
+
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec: fgtechv1.FgtechSpec{
+			Idle: &fgtechv1.IdleSpec{TimeoutSeconds: 600, HeartbeatPath: "/healthz/activity"},
+		},
+	}
+	p := &DefaultProbe{HTTP: HTTPProbe{
+		Client:  srv.Client(),
+		BaseURL: func(*fgtechv1.Fgtech) string { return srv.URL },
+	}}
+
+	got, ok, err := p.LastActivity(context.Background(), fg)
+	if err != nil || !ok {
+		t.Fatalf("LastActivity = %v, %v, %v", got, ok, err)
+	}
+	if want := time.Date(2024, 6, 1, 11, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("LastActivity = %s, want %s", got, want)
+	}
+}
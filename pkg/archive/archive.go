@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/ingress"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrNotFound is returned by stores when an entry does not exist.
+var ErrNotFound = errors.New("archive entry not found")
+
+// Entry is the serialised definition of a Fgtech taken before its deletion.
+type Entry struct {
+	ID         string           `json:"id"`
+	Namespace  string           `json:"namespace"`
+	Name       string           `json:"name"`
+	ArchivedAt time.Time        `json:"archivedAt"`
+	Fgtech     *fgtechv1.Fgtech `json:"fgtech"`
+	// Pod, Service and Route are the rendered workload, kept when the
+	// archiver is configured to include it.
+	Pod     *corev1.Pod     `json:"pod,omitempty"`
+	Service *corev1.Service `json:"service,omitempty"`
+	Route   string          `json:"route,omitempty"`
+}
+
+// Store persists archive entries per namespace.
+type Store interface {
+	Put(ctx context.Context, entry *Entry) error
+	Get(ctx context.Context, namespace, id string) (*Entry, error)
+	List(ctx context.Context, namespace string) ([]Entry, error)
+	Delete(ctx context.Context, namespace, id string) error
+}
+
+// Archiver snapshots Fgtech resources into a Store and enforces retention.
+type Archiver struct {
+	Client client.Client
+	Store  Store
+	// Retention is how long entries are kept; zero keeps them forever.
+	Retention time.Duration
+	// IncludeWorkload also stores the rendered Pod, Service and route.
+	IncludeWorkload bool
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Archive stores a snapshot of fg and prunes the namespace entries past retention.
+func (a *Archiver) Archive(ctx context.Context, fg *fgtechv1.Fgtech) (*Entry, error) {
+	now := a.now().UTC().Truncate(time.Second)
+	entry := &Entry{
+		ID:         fmt.Sprintf("%s-%d", fg.Name, now.Unix()),
+		Namespace:  fg.Namespace,
+		Name:       fg.Name,
+		ArchivedAt: now,
+		Fgtech:     sanitize(fg),
+	}
+
+	if a.IncludeWorkload {
+		var p corev1.Pod
+		if err := a.Client.Get(ctx, types.NamespacedName{Namespace: fg.Namespace, Name: pod.PodNameFor(fg)}, &p); err == nil {
+			entry.Pod = &p
+			stripServerFields(&entry.Pod.ObjectMeta)
+			entry.Pod.Status = corev1.PodStatus{}
+		} else if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		var svc corev1.Service
+		if err := a.Client.Get(ctx, types.NamespacedName{Namespace: fg.Namespace, Name: pod.ServiceNameFor(fg)}, &svc); err == nil {
+			entry.Service = &svc
+			stripServerFields(&entry.Service.ObjectMeta)
+			entry.Service.Status = corev1.ServiceStatus{}
+		} else if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		entry.Route = ingress.RoutePathFor(fg)
+	}
+
+	if err := a.Store.Put(ctx, entry); err != nil {
+		return nil, fmt.Errorf("archive %s/%s: %w", fg.Namespace, fg.Name, err)
+	}
+	if a.Retention > 0 {
+		if err := Prune(ctx, a.Store, fg.Namespace, now.Add(-a.Retention)); err != nil {
+			return entry, fmt.Errorf("prune archive %s: %w", fg.Namespace, err)
+		}
+	}
+	return entry, nil
+}
+
+func (a *Archiver) now() time.Time {
+	if a.Now == nil {
+		return time.Now()
+	}
+	return a.Now()
+}
+
+// Prune deletes the namespace entries archived before cutoff.
+func Prune(ctx context.Context, s Store, namespace string, cutoff time.Time) error {
+	entries, err := s.List(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.ArchivedAt.Before(cutoff) {
+			if err := s.Delete(ctx, namespace, e.ID); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Restore recreates the Fgtech stored in an archive entry. A positive
+// ttlSeconds replaces the archived TTL; the new object starts a fresh lifetime.
+func Restore(ctx context.Context, c client.Client, s Store, namespace, id string, ttlSeconds int64) (*fgtechv1.Fgtech, error) {
+	entry, err := s.Get(ctx, namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Fgtech == nil {
+		return nil, fmt.Errorf("archive entry %s/%s holds no fgtech", namespace, id)
+	}
+
+	fg := entry.Fgtech.DeepCopy()
+	fg.Namespace = namespace
+	if ttlSeconds > 0 {
+		fg.Spec.TTLSeconds = &ttlSeconds
+	}
+	if err := c.Create(ctx, fg); err != nil {
+		return nil, err
+	}
+	return fg, nil
+}
+
+// sortEntries orders entries from the most recent to the oldest.
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].ArchivedAt.Equal(entries[j].ArchivedAt) {
+			return entries[i].ID < entries[j].ID
+		}
+		return entries[i].ArchivedAt.After(entries[j].ArchivedAt)
+	})
+}
+
+// transientAnnotations are one-shot requests that must not survive a restore.
+var transientAnnotations = []string{
+	fgtechv1.AnnotationExtend,
+	fgtechv1.AnnotationWake,
+	fgtechv1.AnnotationLastActivity,
+}
+
+func sanitize(fg *fgtechv1.Fgtech) *fgtechv1.Fgtech {
+	out := &fgtechv1.Fgtech{
+		TypeMeta: metav1.TypeMeta{APIVersion: fgtechv1.GroupVersion.String(), Kind: "Fgtech"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fg.Name,
+			Namespace: fg.Namespace,
+		},
+	}
+	fg.Spec.DeepCopyInto(&out.Spec)
+	if len(fg.Labels) > 0 {
+		out.Labels = make(map[string]string, len(fg.Labels))
+		for k, v := range fg.Labels {
+			out.Labels[k] = v
+		}
+	}
+	for k, v := range fg.Annotations {
+		if isTransient(k) {
+			continue
+		}
+		if out.Annotations == nil {
+			out.Annotations = map[string]string{}
+		}
+		out.Annotations[k] = v
+	}
+	return out
+}
+
+func isTransient(annotation string) bool {
+	for _, t := range transientAnnotations {
+		if annotation == t {
+			return true
+		}
+	}
+	return false
+}
+
+func stripServerFields(meta *metav1.ObjectMeta) {
+	meta.UID = ""
+	meta.ResourceVersion = ""
+	meta.Generation = 0
+	meta.CreationTimestamp = metav1.Time{}
+	meta.ManagedFields = nil
+	meta.OwnerReferences = nil
+}
@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newArchiveScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client scheme: %v", err)
+	}
+	if err := fgtechv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add fgtech scheme: %v", err)
+	}
+	return scheme
+}
+
+func sampleFgtech() *fgtechv1.Fgtech {
+	ttl := int64(60)
+	return &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "sample",
+			Namespace:       "demo",
+			UID:             "uid-1",
+			ResourceVersion: "42",
+			Labels:          map[string]string{"team": "a"},
+			Annotations: map[string]string{
+				"note":                    "keep",
+				fgtechv1.AnnotationExtend: "1h",
+			},
+		},
+		Spec:   fgtechv1.FgtechSpec{Image: "nginx", Version: "1.0.0", ExtraPath: "/apps", TTLSeconds: &ttl},
+		Status: fgtechv1.FgtechStatus{Phase: fgtechv1.PhaseRunning},
+	}
+}
+
+func TestArchiverStoresSanitizedDefinitionAndWorkload(t *testing.T) {
+	fg := sampleFgtech()
+	p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod.PodNameFor(fg), Namespace: "demo", UID: "pod-uid"}}
+	c := fake.NewClientBuilder().WithScheme(newArchiveScheme(t)).WithObjects(p).Build()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a := &Archiver{Client: c, Store: NewConfigMapStore(c), IncludeWorkload: true, Now: func() time.Time { return now }}
+	entry, err := a.Archive(context.Background(), fg)
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if entry.ID != "sample-1714564800" {
+		t.Fatalf("unexpected entry id %q", entry.ID)
+	}
+
+	got, err := a.Store.Get(context.Background(), "demo", entry.ID)
+	if err != nil {
+		t.Fatalf("get entry: %v", err)
+	}
+	if got.Fgtech.UID != "" || got.Fgtech.ResourceVersion != "" {
+		t.Fatalf("server fields should be stripped, got %+v", got.Fgtech.ObjectMeta)
+	}
+	if got.Fgtech.Status.Phase != "" {
+		t.Fatalf("status should not be archived, got %+v", got.Fgtech.Status)
+	}
+	if _, ok := got.Fgtech.Annotations[fgtechv1.AnnotationExtend]; ok {
+		t.Fatalf("transient annotations should be dropped")
+	}
+	if got.Fgtech.Annotations["note"] != "keep" || got.Fgtech.Labels["team"] != "a" {
+		t.Fatalf("metadata should be kept, got %+v", got.Fgtech.ObjectMeta)
+	}
+	if got.Pod == nil || got.Pod.UID != "" {
+		t.Fatalf("expected sanitized pod in entry, got %+v", got.Pod)
+	}
+	if got.Service != nil {
+		t.Fatalf("missing service should not be archived")
+	}
+	if got.Route != "/apps/sample" {
+		t.Fatalf("unexpected route %q", got.Route)
+	}
+}
+
+func TestArchiverPrunesPastRetention(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newArchiveScheme(t)).Build()
+	store := NewConfigMapStore(c)
+	ctx := context.Background()
+
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	old := &Entry{ID: "old-1", Namespace: "demo", Name: "old", ArchivedAt: now.Add(-8 * 24 * time.Hour)}
+	recent := &Entry{ID: "recent-1", Namespace: "demo", Name: "recent", ArchivedAt: now.Add(-time.Hour)}
+	for _, e := range []*Entry{old, recent} {
+		if err := store.Put(ctx, e); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+
+	a := &Archiver{Client: c, Store: store, Retention: 7 * 24 * time.Hour, Now: func() time.Time { return now }}
+	if _, err := a.Archive(ctx, sampleFgtech()); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	entries, err := store.List(ctx, "demo")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "sample" || entries[1].ID != "recent-1" {
+		t.Fatalf("unexpected entries after prune: %+v", entries)
+	}
+}
+
+func TestConfigMapStoreNotFound(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newArchiveScheme(t)).Build()
+	store := NewConfigMapStore(c)
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "demo", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound without recycle bin, got %v", err)
+	}
+	if err := store.Put(ctx, &Entry{ID: "a-1", Namespace: "demo", Name: "a"}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := store.Delete(ctx, "demo", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound on delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "demo", "a-1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	entries, err := store.List(ctx, "demo")
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty recycle bin, got %v %+v", err, entries)
+	}
+}
+
+func TestRestoreRecreatesFgtechWithNewTTL(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(newArchiveScheme(t)).Build()
+	store := NewConfigMapStore(c)
+	ctx := context.Background()
+
+	a := &Archiver{Client: c, Store: store}
+	entry, err := a.Archive(ctx, sampleFgtech())
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	restored, err := Restore(ctx, c, store, "demo", entry.ID, 3600)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored.Spec.TTLSeconds == nil || *restored.Spec.TTLSeconds != 3600 {
+		t.Fatalf("expected new TTL, got %v", restored.Spec.TTLSeconds)
+	}
+
+	var fg fgtechv1.Fgtech
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "demo", Name: "sample"}, &fg); err != nil {
+		t.Fatalf("restored fgtech not found: %v", err)
+	}
+	if fg.Spec.Image != "nginx" || fg.Spec.ExtraPath != "/apps" {
+		t.Fatalf("spec not restored: %+v", fg.Spec)
+	}
+
+	if _, err := Restore(ctx, c, store, "demo", entry.ID, 0); err == nil {
+		t.Fatalf("restoring over an existing fgtech should fail")
+	}
+	if _, err := Restore(ctx, c, store, "demo", "missing", 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
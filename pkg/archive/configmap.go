@@ -0,0 +1,127 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fgtech/ia/cursor/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RecycleBinName is the ConfigMap holding the archive entries of a namespace.
+const RecycleBinName = "fgtech-recycle-bin"
+
+const entrySuffix = ".json"
+
+// ConfigMapStore keeps entries as JSON keys of a per-namespace ConfigMap.
+// Entries are small; a ConfigMap holds up to 1MiB, which retention keeps in check.
+type ConfigMapStore struct {
+	Client client.Client
+}
+
+func NewConfigMapStore(c client.Client) *ConfigMapStore {
+	return &ConfigMapStore{Client: c}
+}
+
+func (s *ConfigMapStore) Put(ctx context.Context, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.get(ctx, entry.Namespace)
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      RecycleBinName,
+					Namespace: entry.Namespace,
+					Labels:    pod.ManagedLabels(""),
+				},
+				Data: map[string]string{entry.ID + entrySuffix: string(data)},
+			}
+			return s.Client.Create(ctx, cm)
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[entry.ID+entrySuffix] = string(data)
+		return s.Client.Update(ctx, cm)
+	})
+}
+
+func (s *ConfigMapStore) Get(ctx context.Context, namespace, id string) (*Entry, error) {
+	cm, err := s.get(ctx, namespace)
+	if apierrors.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := cm.Data[id+entrySuffix]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		return nil, fmt.Errorf("decode archive entry %s/%s: %w", namespace, id, err)
+	}
+	return &entry, nil
+}
+
+func (s *ConfigMapStore) List(ctx context.Context, namespace string) ([]Entry, error) {
+	cm, err := s.get(ctx, namespace)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(cm.Data))
+	for key, raw := range cm.Data {
+		if !strings.HasSuffix(key, entrySuffix) {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			return nil, fmt.Errorf("decode archive entry %s/%s: %w", namespace, key, err)
+		}
+		entries = append(entries, entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (s *ConfigMapStore) Delete(ctx context.Context, namespace, id string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.get(ctx, namespace)
+		if apierrors.IsNotFound(err) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := cm.Data[id+entrySuffix]; !ok {
+			return ErrNotFound
+		}
+		delete(cm.Data, id+entrySuffix)
+		return s.Client.Update(ctx, cm)
+	})
+}
+
+func (s *ConfigMapStore) get(ctx context.Context, namespace string) (*corev1.ConfigMap, error) {
+	var cm corev1.ConfigMap
+	if err := s.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: RecycleBinName}, &cm); err != nil {
+		return nil, err
+	}
+	return &cm, nil
+}
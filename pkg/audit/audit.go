@@ -0,0 +1,251 @@
+// Package audit records the changes made to Fgtech specs as structured
+// records, each listing the modified fields with their old and new values.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Audited operations.
+const (
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+const queueSize = 256
+
+// Record is one audited change of a Fgtech.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Operation  string    `json:"operation"`
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	UID        string    `json:"uid,omitempty"`
+	Generation int64     `json:"generation,omitempty"`
+	// Manager is the field manager that made the change, as recorded in
+	// metadata.managedFields: kubectl-edit, kubectl-client-side-apply, the
+	// name of a controller...
+	Manager string   `json:"manager,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Change is a modified field. Old is omitted for an added field and New for a
+// removed one.
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// Diff compares the JSON forms of old and new and returns their differences
+// sorted by field, each field path starting with prefix. Lists are compared
+// item by item.
+func Diff(prefix string, old, new interface{}) ([]Change, error) {
+	a, err := toJSONValue(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toJSONValue(new)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	diffValues(prefix, a, b, &changes)
+	return changes, nil
+}
+
+// Redacted replaces the values Redact hides.
+const Redacted = "<redacted>"
+
+// Redact replaces with Redacted the values of the fields of changes for which
+// secret returns true, including the ones nested in an added or removed
+// object or list: the record still tells that they changed.
+func Redact(changes []Change, secret func(field string) bool) []Change {
+	for i := range changes {
+		c := &changes[i]
+		c.Old = redactValue(c.Field, c.Old, secret)
+		c.New = redactValue(c.Field, c.New, secret)
+	}
+	return changes
+}
+
+func redactValue(path string, v interface{}, secret func(string) bool) interface{} {
+	if v == nil {
+		return nil
+	}
+	if secret(path) {
+		return Redacted
+	}
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, item := range vv {
+			vv[k] = redactValue(path+"."+k, item, secret)
+		}
+	case []interface{}:
+		for i, item := range vv {
+			vv[i] = redactValue(path+"["+strconv.Itoa(i)+"]", item, secret)
+		}
+	}
+	return v
+}
+
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func diffValues(path string, a, b interface{}, changes *[]Change) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(av)+len(bv))
+			for k := range av {
+				keys = append(keys, k)
+			}
+			for k := range bv {
+				if _, ok := av[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				diffValues(path+"."+k, av[k], bv[k], changes)
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			for i := 0; i < len(av) || i < len(bv); i++ {
+				var x, y interface{}
+				if i < len(av) {
+					x = av[i]
+				}
+				if i < len(bv) {
+					y = bv[i]
+				}
+				diffValues(path+"["+strconv.Itoa(i)+"]", x, y, changes)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Field: path, Old: a, New: b})
+	}
+}
+
+// SpecManager returns the field manager that last changed the spec of
+// updated, compared to old: the manager whose entry appeared or moved forward,
+// or else the latest one owning spec fields. It returns "" when managedFields
+// tell nothing about the spec.
+func SpecManager(old, updated metav1.Object) string {
+	before := map[string]time.Time{}
+	for _, e := range old.GetManagedFields() {
+		if e.Time != nil {
+			before[managerKey(e)] = e.Time.Time
+		}
+	}
+	var latest, moved string
+	var latestAt, movedAt time.Time
+	for _, e := range updated.GetManagedFields() {
+		if e.Subresource != "" || e.FieldsV1 == nil || !strings.Contains(string(e.FieldsV1.Raw), `"f:spec"`) {
+			continue
+		}
+		var at time.Time
+		if e.Time != nil {
+			at = e.Time.Time
+		}
+		if latest == "" || at.After(latestAt) {
+			latest, latestAt = e.Manager, at
+		}
+		if prev, ok := before[managerKey(e)]; (!ok || at.After(prev)) && (moved == "" || at.After(movedAt)) {
+			moved, movedAt = e.Manager, at
+		}
+	}
+	if moved != "" {
+		return moved
+	}
+	return latest
+}
+
+func managerKey(e metav1.ManagedFieldsEntry) string {
+	return e.Manager + "/" + string(e.Operation) + "/" + e.Subresource
+}
+
+// Auditor accepts audit records. Audit must not block the caller.
+type Auditor interface {
+	Audit(rec Record)
+}
+
+// Dispatcher queues records and writes them to every sink in the background.
+// It implements manager.Runnable.
+type Dispatcher struct {
+	sinks []Sink
+	log   logr.Logger
+	queue chan Record
+	now   func() time.Time
+}
+
+func NewDispatcher(log logr.Logger, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		sinks: sinks,
+		log:   log,
+		queue: make(chan Record, queueSize),
+		now:   time.Now,
+	}
+}
+
+// Audit stamps the record time when unset and queues it. Records are dropped,
+// and logged, when the queue is full so that event handlers never wait on
+// slow sinks.
+func (d *Dispatcher) Audit(rec Record) {
+	if d == nil || len(d.sinks) == 0 {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = d.now().UTC()
+	}
+	select {
+	case d.queue <- rec:
+	default:
+		d.log.Info("audit queue full, dropping record", "operation", rec.Operation, "namespace", rec.Namespace, "name", rec.Name)
+	}
+}
+
+// Start implements manager.Runnable. The sinks are closed on return.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	defer func() {
+		for _, sink := range d.sinks {
+			if err := sink.Close(); err != nil {
+				d.log.Error(err, "unable to close audit sink")
+			}
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case rec := <-d.queue:
+			for _, sink := range d.sinks {
+				if err := sink.Write(ctx, rec); err != nil {
+					d.log.Error(err, "audit write failed", "operation", rec.Operation, "namespace", rec.Namespace, "name", rec.Name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestDiff(t *testing.T) {
+	base := fgtechv1.FgtechSpec{
+		Image:   "nginx:1.25",
+		Version: "1.0.0",
+		Env:     []corev1.EnvVar{{Name: "MODE", Value: "dev"}},
+	}
+	for _, tc := range []struct {
+		name   string
+		mutate func(s *fgtechv1.FgtechSpec)
+		want   []Change
+	}{
+		{name: "unchanged", mutate: func(s *fgtechv1.FgtechSpec) {}},
+		{
+			name:   "scalar",
+			mutate: func(s *fgtechv1.FgtechSpec) { s.Image = "nginx:1.27" },
+			want:   []Change{{Field: "spec.image", Old: "nginx:1.25", New: "nginx:1.27"}},
+		},
+		{
+			name:   "added field",
+			mutate: func(s *fgtechv1.FgtechSpec) { s.TTLSeconds = int64Ptr(600) },
+			want:   []Change{{Field: "spec.ttlSeconds", New: float64(600)}},
+		},
+		{
+			name:   "list item",
+			mutate: func(s *fgtechv1.FgtechSpec) { s.Env = []corev1.EnvVar{{Name: "MODE", Value: "prod"}} },
+			want:   []Change{{Field: "spec.env[0].value", Old: "dev", New: "prod"}},
+		},
+		{
+			name: "list growth",
+			mutate: func(s *fgtechv1.FgtechSpec) {
+				s.Env = append(s.Env, corev1.EnvVar{Name: "DEBUG", Value: "1"})
+			},
+			want: []Change{{Field: "spec.env[1]", New: map[string]interface{}{"name": "DEBUG", "value": "1"}}},
+		},
+		{
+			name:   "removed list",
+			mutate: func(s *fgtechv1.FgtechSpec) { s.Env = nil },
+			want:   []Change{{Field: "spec.env", Old: []interface{}{map[string]interface{}{"name": "MODE", "value": "dev"}}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			updated := *base.DeepCopy()
+			tc.mutate(&updated)
+			got, err := Diff("spec", base, updated)
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Diff = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	old := fgtechv1.FgtechSpec{Image: "nginx:1.25", Env: []corev1.EnvVar{{Name: "TOKEN", Value: "s3cr3t"}}}
+	updated := fgtechv1.FgtechSpec{Image: "nginx:1.27", Env: []corev1.EnvVar{
+		{Name: "TOKEN", Value: "t0p"},
+		{Name: "DEBUG", Value: "1"},
+	}}
+	changes, err := Diff("spec", old, updated)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	got := Redact(changes, func(field string) bool { return strings.HasSuffix(field, ".value") })
+	want := []Change{
+		{Field: "spec.env[0].value", Old: Redacted, New: Redacted},
+		{Field: "spec.env[1]", New: map[string]interface{}{"name": "DEBUG", "value": Redacted}},
+		{Field: "spec.image", Old: "nginx:1.25", New: "nginx:1.27"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Redact = %#v, want %#v", got, want)
+	}
+}
+
+func TestSpecManager(t *testing.T) {
+	t0 := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(manager string, at time.Time, fields string, subresource string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{
+			Manager:     manager,
+			Operation:   metav1.ManagedFieldsOperationUpdate,
+			Time:        &metav1.Time{Time: at},
+			FieldsType:  "FieldsV1",
+			FieldsV1:    &metav1.FieldsV1{Raw: []byte(fields)},
+			Subresource: subresource,
+		}
+	}
+	spec := `{"f:spec":{"f:image":{}}}`
+	old := &fgtechv1.Fgtech{ObjectMeta: metav1.ObjectMeta{ManagedFields: []metav1.ManagedFieldsEntry{
+		entry("kubectl-client-side-apply", t0, spec, ""),
+		entry("portal", t0.Add(time.Minute), spec, ""),
+	}}}
+	updated := old.DeepCopy()
+	updated.ManagedFields[0].Time = &metav1.Time{Time: t0.Add(2 * time.Minute)}
+	updated.ManagedFields = append(updated.ManagedFields, entry("fgtech-operator", t0.Add(3*time.Minute), `{"f:status":{}}`, "status"))
+
+	if got := SpecManager(old, updated); got != "kubectl-client-side-apply" {
+		t.Fatalf("SpecManager = %q, want the manager whose entry moved", got)
+	}
+	if got := SpecManager(updated, updated); got != "kubectl-client-side-apply" {
+		t.Fatalf("SpecManager = %q, want the latest spec manager", got)
+	}
+	if got := SpecManager(old, &fgtechv1.Fgtech{}); got != "" {
+		t.Fatalf("SpecManager = %q, want none without managedFields", got)
+	}
+}
+
+type memorySink struct {
+	records chan Record
+}
+
+func (s *memorySink) Write(_ context.Context, rec Record) error {
+	s.records <- rec
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestDispatcherStampsAndDelivers(t *testing.T) {
+	sink := &memorySink{records: make(chan Record, 1)}
+	d := NewDispatcher(logr.Discard(), sink)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Start(ctx)
+
+	d.Audit(Record{Operation: OperationDelete, Namespace: "team-a", Name: "demo"})
+	rec := <-sink.records
+	if !rec.Time.Equal(now) || rec.Name != "demo" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"time":"2024-06-01T12:00:00Z","operation":"delete","namespace":"team-a","name":"demo"}`
+	if string(data) != want {
+		t.Fatalf("record JSON = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink writes audit records to a single destination.
+type Sink interface {
+	Write(ctx context.Context, rec Record) error
+	Close() error
+}
+
+// Sink specifications accepted by NewSink.
+const (
+	specStdout     = "stdout"
+	specFilePrefix = "file:"
+)
+
+// FileOptions bound the size of the files written by file sinks.
+type FileOptions struct {
+	// MaxBytes is the size past which the file is rotated; zero never rotates.
+	MaxBytes int64
+	// MaxBackups is the number of rotated files kept next to the current one.
+	MaxBackups int
+}
+
+// CheckSpec reports whether spec names a sink: stdout, file:<path> or an
+// http(s) URL.
+func CheckSpec(spec string) error {
+	switch {
+	case spec == specStdout:
+		return nil
+	case strings.HasPrefix(spec, specFilePrefix):
+		if strings.TrimPrefix(spec, specFilePrefix) == "" {
+			return fmt.Errorf("%q: missing file path", spec)
+		}
+		return nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return nil
+	}
+	return fmt.Errorf("%q is not stdout, file:<path> or an http(s) URL", spec)
+}
+
+// NewSink builds the sink named by spec; see CheckSpec.
+func NewSink(spec string, file FileOptions) (Sink, error) {
+	if err := CheckSpec(spec); err != nil {
+		return nil, err
+	}
+	switch {
+	case spec == specStdout:
+		return NewWriterSink(os.Stdout), nil
+	case strings.HasPrefix(spec, specFilePrefix):
+		return NewFileSink(strings.TrimPrefix(spec, specFilePrefix), file)
+	}
+	return NewHTTPSink(spec), nil
+}
+
+// WriterSink writes records as JSON lines.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(_ context.Context, rec Record) error {
+	line, err := jsonLine(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// Close implements Sink; the writer is left open.
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// FileSink appends JSON lines to a local file, renamed to <path>.1 once it
+// reaches MaxBytes; older files shift to <path>.2 and so on up to MaxBackups.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	opts FileOptions
+	f    *os.File
+	size int64
+}
+
+// NewFileSink opens path for appending, creating it and its directory.
+func NewFileSink(path string, opts FileOptions) (*FileSink, error) {
+	s := &FileSink{path: path, opts: opts}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(_ context.Context, rec Record) error {
+	line, err := jsonLine(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.MaxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.opts.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotate %s: %w", s.path, err)
+		}
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups, drops the oldest one and starts a new file.
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	if s.opts.MaxBackups < 1 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+	if err := os.Remove(backupName(s.path, s.opts.MaxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := s.opts.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupName(s.path, i), backupName(s.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, backupName(s.path, 1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// HTTPSink POSTs each record as a JSON document.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPSink returns a sink with a 10s request timeout.
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPSink) Write(ctx context.Context, rec Record) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post audit record to %s: status %d", s.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *HTTPSink) Close() error {
+	return nil
+}
+
+func jsonLine(rec Record) ([]byte, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
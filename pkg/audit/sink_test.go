@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSpec(t *testing.T) {
+	for spec, valid := range map[string]bool{
+		"stdout":                    true,
+		"file:/var/log/audit.log":   true,
+		"https://audit.example.com": true,
+		"http://audit:8080/fgtech":  true,
+		"file:":                     false,
+		"stderr":                    false,
+		"/var/log/audit.log":        false,
+	} {
+		if err := CheckSpec(spec); (err == nil) != valid {
+			t.Fatalf("CheckSpec(%q) = %v, want valid=%v", spec, err, valid)
+		}
+	}
+}
+
+func TestWriterSinkWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	for _, name := range []string{"one", "two"} {
+		if err := sink.Write(context.Background(), Record{Operation: OperationUpdate, Name: name}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q, want 2", lines)
+	}
+	var rec Record
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil || rec.Name != "two" {
+		t.Fatalf("second line %q: %+v, %v", lines[1], rec, err)
+	}
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "fgtech.log")
+	line, _ := jsonLine(Record{Operation: OperationUpdate, Name: "demo"})
+	sink, err := NewSink("file:"+path, FileOptions{MaxBytes: int64(2 * len(line)), MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	defer sink.Close()
+
+	// Two records per file: 7 records leave 1 in the current file and two
+	// full backups, the first two records being dropped.
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(context.Background(), Record{Operation: OperationUpdate, Name: "demo"}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	for name, records := range map[string]int{path: 1, path + ".1": 2, path + ".2": 2} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if got := strings.Count(string(data), "\n"); got != records {
+			t.Fatalf("%s holds %d records, want %d", name, got, records)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected no third backup, got err: %v", err)
+	}
+}
+
+func TestHTTPSinkPostsRecord(t *testing.T) {
+	received := make(chan Record, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		received <- rec
+	}))
+	defer srv.Close()
+
+	sink := &HTTPSink{URL: srv.URL, Client: srv.Client()}
+	rec := Record{Operation: OperationUpdate, Namespace: "team-a", Name: "demo", Changes: []Change{{Field: "spec.image", Old: "a", New: "b"}}}
+	if err := sink.Write(context.Background(), rec); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := <-received; got.Name != "demo" || len(got.Changes) != 1 || got.Changes[0].Field != "spec.image" {
+		t.Fatalf("received %+v", got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := (&HTTPSink{URL: failing.URL, Client: failing.Client()}).Write(context.Background(), rec); err == nil {
+		t.Fatalf("expected an error on a 502 answer")
+	}
+}
@@ -0,0 +1,210 @@
+package class
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrNotFound is wrapped by Resolve when spec.className names a missing class.
+var ErrNotFound = errors.New("fgtech class not found")
+
+// Defaults are the operator-wide settings, used when no class applies and for
+// the fields a class leaves empty.
+type Defaults struct {
+	TTLSeconds       int64
+	ServiceAccount   string
+	Port             int32
+	IngressClassName string
+}
+
+// Settings are the effective settings of a Fgtech: its class merged over the
+// operator defaults.
+type Settings struct {
+	// ClassName is the class that applied; empty when none did.
+	ClassName          string
+	DefaultTTLSeconds  int64
+	MaxTTLSeconds      int64
+	ServiceAccount     string
+	Port               int32
+	Resources          corev1.ResourceRequirements
+	NodeSelector       map[string]string
+	Tolerations        []corev1.Toleration
+	PriorityClassName  string
+	PodSecurityContext *corev1.PodSecurityContext
+	SecurityContext    *corev1.SecurityContext
+	IngressClassName   string
+	AllowedRegistries  []string
+	RecreatePods       bool
+}
+
+// TTLSeconds returns the TTL of fg: spec.ttlSeconds or the class default,
+// capped by the class maximum. Zero means no TTL.
+func (s Settings) TTLSeconds(fg *fgtechv1.Fgtech) int64 {
+	ttl := s.DefaultTTLSeconds
+	if fg.Spec.TTLSeconds != nil && *fg.Spec.TTLSeconds > 0 {
+		ttl = *fg.Spec.TTLSeconds
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	if s.MaxTTLSeconds > 0 && ttl > s.MaxTTLSeconds {
+		return s.MaxTTLSeconds
+	}
+	return ttl
+}
+
+// ImageAllowed reports whether image comes from one of the allowed registries.
+func (s Settings) ImageAllowed(image string) bool {
+	if len(s.AllowedRegistries) == 0 {
+		return true
+	}
+	repo := Repository(image)
+	for _, allowed := range s.AllowedRegistries {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed == "" {
+			continue
+		}
+		if repo == allowed || strings.HasPrefix(repo, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Repository returns the fully qualified repository of an image reference,
+// without tag nor digest: nginx:1.25 becomes docker.io/library/nginx.
+func Repository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i:], "/") {
+		image = image[:i]
+	}
+	first, rest, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return image
+	}
+	if !found {
+		return "docker.io/library/" + image
+	}
+	return "docker.io/" + first + "/" + rest
+}
+
+// Resolver looks up the FgtechClass of a Fgtech.
+type Resolver struct {
+	reader   client.Reader
+	defaults Defaults
+}
+
+// NewResolver returns a Resolver reading classes through r. A nil r disables
+// the classes: only the defaults apply and naming a class fails.
+func NewResolver(r client.Reader, defaults Defaults) *Resolver {
+	return &Resolver{reader: r, defaults: defaults}
+}
+
+// Defaults returns the settings applied when no class is involved.
+func (r *Resolver) Defaults() Settings {
+	return Settings{
+		DefaultTTLSeconds: r.defaults.TTLSeconds,
+		ServiceAccount:    r.defaults.ServiceAccount,
+		Port:              r.defaults.Port,
+		IngressClassName:  r.defaults.IngressClassName,
+	}
+}
+
+// Resolve returns the settings of fg. spec.className must name an existing
+// class; without it the default class applies, then the operator defaults.
+func (r *Resolver) Resolve(ctx context.Context, fg *fgtechv1.Fgtech) (Settings, error) {
+	if r.reader == nil {
+		if fg.Spec.ClassName != "" {
+			return Settings{}, fmt.Errorf("%w: %s (classes are disabled)", ErrNotFound, fg.Spec.ClassName)
+		}
+		return r.merge(nil), nil
+	}
+	var cls *fgtechv1.FgtechClass
+	if fg.Spec.ClassName != "" {
+		var found fgtechv1.FgtechClass
+		if err := r.reader.Get(ctx, types.NamespacedName{Name: fg.Spec.ClassName}, &found); err != nil {
+			if apierrors.IsNotFound(err) {
+				return Settings{}, fmt.Errorf("%w: %s", ErrNotFound, fg.Spec.ClassName)
+			}
+			return Settings{}, err
+		}
+		cls = &found
+	} else {
+		var err error
+		if cls, err = r.defaultClass(ctx); err != nil {
+			return Settings{}, err
+		}
+	}
+	return r.merge(cls), nil
+}
+
+// DefaultClassName returns the name of the class applying to the Fgtech
+// resources without spec.className; empty when none does.
+func (r *Resolver) DefaultClassName(ctx context.Context) (string, error) {
+	if r.reader == nil {
+		return "", nil
+	}
+	cls, err := r.defaultClass(ctx)
+	if err != nil || cls == nil {
+		return "", err
+	}
+	return cls.Name, nil
+}
+
+// defaultClass returns the class annotated as default, or nil. When several
+// are, the most recently created wins, as for StorageClasses.
+func (r *Resolver) defaultClass(ctx context.Context) (*fgtechv1.FgtechClass, error) {
+	var list fgtechv1.FgtechClassList
+	if err := r.reader.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	var best *fgtechv1.FgtechClass
+	for i := range list.Items {
+		c := &list.Items[i]
+		if !c.IsDefault() {
+			continue
+		}
+		if best == nil || c.CreationTimestamp.After(best.CreationTimestamp.Time) ||
+			(c.CreationTimestamp.Equal(&best.CreationTimestamp) && c.Name < best.Name) {
+			best = c
+		}
+	}
+	return best, nil
+}
+
+func (r *Resolver) merge(cls *fgtechv1.FgtechClass) Settings {
+	s := r.Defaults()
+	if cls == nil {
+		return s
+	}
+	spec := cls.Spec.DeepCopy()
+	s.ClassName = cls.Name
+	if spec.DefaultTTLSeconds != nil {
+		s.DefaultTTLSeconds = *spec.DefaultTTLSeconds
+	}
+	if spec.MaxTTLSeconds != nil {
+		s.MaxTTLSeconds = *spec.MaxTTLSeconds
+	}
+	if spec.IngressClassName != "" {
+		s.IngressClassName = spec.IngressClassName
+	}
+	s.Resources = spec.Resources
+	s.NodeSelector = spec.NodeSelector
+	s.Tolerations = spec.Tolerations
+	s.PriorityClassName = spec.PriorityClassName
+	s.PodSecurityContext = spec.PodSecurityContext
+	s.SecurityContext = spec.SecurityContext
+	s.AllowedRegistries = spec.AllowedRegistries
+	s.RecreatePods = spec.RecreatePods
+	return s
+}
@@ -0,0 +1,172 @@
+package class
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRepository(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "nginx", want: "docker.io/library/nginx"},
+		{image: "nginx:1.25", want: "docker.io/library/nginx"},
+		{image: "fgtech/app:2", want: "docker.io/fgtech/app"},
+		{image: "ghcr.io/fgtech/app:2", want: "ghcr.io/fgtech/app"},
+		{image: "registry.local:5000/app", want: "registry.local:5000/app"},
+		{image: "localhost/app@sha256:abcd", want: "localhost/app"},
+	}
+	for _, tt := range tests {
+		if got := Repository(tt.image); got != tt.want {
+			t.Fatalf("Repository(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestImageAllowed(t *testing.T) {
+	s := Settings{AllowedRegistries: []string{"ghcr.io/fgtech", "registry.local:5000", "docker.io/library/"}}
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{image: "ghcr.io/fgtech/app:1", want: true},
+		{image: "ghcr.io/fgtech-evil/app:1", want: false},
+		{image: "ghcr.io/other/app:1", want: false},
+		{image: "registry.local:5000/team/app", want: true},
+		{image: "nginx:1.25", want: true},
+		{image: "someone/nginx:1.25", want: false},
+	}
+	for _, tt := range tests {
+		if got := s.ImageAllowed(tt.image); got != tt.want {
+			t.Fatalf("ImageAllowed(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+	if !(Settings{}).ImageAllowed("anything/goes") {
+		t.Fatalf("expected every image to be allowed without restriction")
+	}
+}
+
+func TestTTLSeconds(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		spec     *int64
+		want     int64
+	}{
+		{name: "default", settings: Settings{DefaultTTLSeconds: 3600}, want: 3600},
+		{name: "spec override", settings: Settings{DefaultTTLSeconds: 3600}, spec: int64Ptr(600), want: 600},
+		{name: "capped spec", settings: Settings{DefaultTTLSeconds: 3600, MaxTTLSeconds: 7200}, spec: int64Ptr(86400), want: 7200},
+		{name: "capped default", settings: Settings{DefaultTTLSeconds: 86400, MaxTTLSeconds: 7200}, want: 7200},
+		{name: "no ttl", settings: Settings{MaxTTLSeconds: 7200}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fg := &fgtechv1.Fgtech{Spec: fgtechv1.FgtechSpec{TTLSeconds: tt.spec}}
+			if got := tt.settings.TTLSeconds(fg); got != tt.want {
+				t.Fatalf("TTLSeconds = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	now := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	gpu := &fgtechv1.FgtechClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+		Spec: fgtechv1.FgtechClassSpec{
+			DefaultTTLSeconds: int64Ptr(1800),
+			NodeSelector:      map[string]string{"accelerator": "gpu"},
+			IngressClassName:  "internal",
+		},
+	}
+	oldDefault := &fgtechv1.FgtechClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "standard",
+			CreationTimestamp: metav1.NewTime(now),
+			Annotations:       map[string]string{fgtechv1.AnnotationDefaultClass: "true"},
+		},
+		Spec: fgtechv1.FgtechClassSpec{MaxTTLSeconds: int64Ptr(7200)},
+	}
+	newDefault := &fgtechv1.FgtechClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "small",
+			CreationTimestamp: metav1.NewTime(now.Add(time.Hour)),
+			Annotations:       map[string]string{fgtechv1.AnnotationDefaultClass: "true"},
+		},
+		Spec: fgtechv1.FgtechClassSpec{MaxTTLSeconds: int64Ptr(3600)},
+	}
+	defaults := Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080, IngressClassName: "nginx"}
+
+	tests := []struct {
+		name        string
+		objects     []*fgtechv1.FgtechClass
+		className   string
+		wantClass   string
+		wantTTL     int64
+		wantIngress string
+		wantErr     error
+		disabled    bool
+	}{
+		{name: "operator defaults", wantTTL: 3600, wantIngress: "nginx"},
+		{name: "named class", objects: []*fgtechv1.FgtechClass{gpu, oldDefault}, className: "gpu", wantClass: "gpu", wantTTL: 1800, wantIngress: "internal"},
+		{name: "newest default class", objects: []*fgtechv1.FgtechClass{gpu, oldDefault, newDefault}, wantClass: "small", wantTTL: 3600, wantIngress: "nginx"},
+		{name: "missing class", objects: []*fgtechv1.FgtechClass{oldDefault}, className: "gpu", wantErr: ErrNotFound},
+		{name: "disabled ignores default class", objects: []*fgtechv1.FgtechClass{oldDefault}, disabled: true, wantTTL: 3600, wantIngress: "nginx"},
+		{name: "disabled rejects named class", objects: []*fgtechv1.FgtechClass{gpu}, className: "gpu", disabled: true, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(newClassScheme(t))
+			for _, obj := range tt.objects {
+				builder = builder.WithObjects(obj.DeepCopy())
+			}
+			r := NewResolver(builder.Build(), defaults)
+			if tt.disabled {
+				r = NewResolver(nil, defaults)
+			}
+			fg := &fgtechv1.Fgtech{Spec: fgtechv1.FgtechSpec{ClassName: tt.className}}
+
+			s, err := r.Resolve(context.Background(), fg)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Resolve error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if s.ClassName != tt.wantClass || s.DefaultTTLSeconds != tt.wantTTL || s.IngressClassName != tt.wantIngress {
+				t.Fatalf("Resolve = class %q ttl %d ingress %q, want %q %d %q", s.ClassName, s.DefaultTTLSeconds, s.IngressClassName, tt.wantClass, tt.wantTTL, tt.wantIngress)
+			}
+			if s.ServiceAccount != "default" || s.Port != 8080 {
+				t.Fatalf("operator defaults lost: %+v", s)
+			}
+		})
+	}
+}
+
+func newClassScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client scheme: %v", err)
+	}
+	if err := fgtechv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add fgtech scheme: %v", err)
+	}
+	return scheme
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
@@ -0,0 +1,109 @@
+// Package health provides the readiness checks served by the manager on
+// /readyz. Each check returns the reason of its failure, shown on
+// /readyz/<name>.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// Timeout bounds each check, below the one second kubelet probes wait by
+// default.
+const Timeout = 800 * time.Millisecond
+
+// CacheSyncer is the part of cache.Cache the cache check uses.
+type CacheSyncer interface {
+	WaitForCacheSync(ctx context.Context) bool
+}
+
+// CachesSynced fails until every informer of c has synced.
+func CachesSynced(c CacheSyncer) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), Timeout)
+		defer cancel()
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informer caches not synced")
+		}
+		return nil
+	}
+}
+
+// APIServer fails when the API server does not answer its /version
+// endpoint, readable by any client.
+func APIServer(c rest.Interface) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), Timeout)
+		defer cancel()
+		if err := c.Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+			return fmt.Errorf("API server unreachable: %w", err)
+		}
+		return nil
+	}
+}
+
+// IngressClass fails when the IngressClass returned by name cannot be read.
+// An empty name, leaving the choice to the cluster default, passes.
+func IngressClass(r client.Reader, name func() string) healthz.Checker {
+	return func(req *http.Request) error {
+		className := name()
+		if className == "" {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), Timeout)
+		defer cancel()
+		if err := r.Get(ctx, types.NamespacedName{Name: className}, &networkingv1.IngressClass{}); err != nil {
+			return fmt.Errorf("ingress class %s: %w", className, err)
+		}
+		return nil
+	}
+}
+
+// IngressSecrets fails when a TLS Secret referenced by the Ingresses matching
+// selector cannot be read in the namespace of its Ingress. Ingresses are
+// listed with list, usually the cache, and the Secrets read with get. owns,
+// when set, limits the check to the namespaces it accepts.
+func IngressSecrets(list, get client.Reader, selector client.MatchingLabels, owns func(namespace string) bool) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), Timeout)
+		defer cancel()
+		var ingresses networkingv1.IngressList
+		if err := list.List(ctx, &ingresses, selector); err != nil {
+			return fmt.Errorf("list ingresses: %w", err)
+		}
+		seen := map[types.NamespacedName]bool{}
+		var keys []types.NamespacedName
+		for _, ing := range ingresses.Items {
+			if owns != nil && !owns(ing.Namespace) {
+				continue
+			}
+			for _, tls := range ing.Spec.TLS {
+				key := types.NamespacedName{Namespace: ing.Namespace, Name: tls.SecretName}
+				if tls.SecretName == "" || seen[key] {
+					continue
+				}
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		var errs []error
+		for _, key := range keys {
+			if err := get.Get(ctx, key, &corev1.Secret{}); err != nil {
+				errs = append(errs, fmt.Errorf("secret %s: %w", key, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type syncer bool
+
+func (s syncer) WaitForCacheSync(context.Context) bool { return bool(s) }
+
+func probe() *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/readyz", nil)
+}
+
+func TestCachesSynced(t *testing.T) {
+	if err := CachesSynced(syncer(true))(probe()); err != nil {
+		t.Fatalf("synced caches: %v", err)
+	}
+	if err := CachesSynced(syncer(false))(probe()); err == nil {
+		t.Fatalf("expected an error for unsynced caches")
+	}
+}
+
+func TestAPIServer(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"major":"1","minor":"30"}`))
+	}))
+	defer srv.Close()
+	dc, err := discovery.NewDiscoveryClientForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("discovery client: %v", err)
+	}
+	check := APIServer(dc.RESTClient())
+
+	if err := check(probe()); err != nil {
+		t.Fatalf("reachable API server: %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := check(probe()); err == nil {
+		t.Fatalf("expected an error on a 503 answer")
+	}
+}
+
+func TestIngressClass(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+		&networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: "nginx"}},
+	).Build()
+
+	for _, tc := range []struct {
+		name    string
+		class   string
+		wantErr bool
+	}{
+		{name: "present", class: "nginx"},
+		{name: "unset"},
+		{name: "missing class", class: "traefik", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := IngressClass(cl, func() string { return tc.class })(probe())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestIngressSecrets(t *testing.T) {
+	managed := map[string]string{"app": "fgtech"}
+	ingress := func(namespace, secret string, labels map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "fgtech", Namespace: namespace, Labels: labels},
+			Spec:       networkingv1.IngressSpec{TLS: []networkingv1.IngressTLS{{SecretName: secret}}},
+		}
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "fgtech-tls", Namespace: "team-a"}}
+
+	for _, tc := range []struct {
+		name    string
+		objs    []client.Object
+		owns    func(string) bool
+		wantErr string
+	}{
+		{name: "no ingress"},
+		{name: "present", objs: []client.Object{ingress("team-a", "fgtech-tls", managed), secret}},
+		{name: "missing", objs: []client.Object{ingress("team-a", "fgtech-tls", managed), ingress("team-b", "fgtech-tls", managed), secret}, wantErr: "team-b/fgtech-tls"},
+		{name: "unmanaged ingress", objs: []client.Object{ingress("team-b", "fgtech-tls", nil)}},
+		{name: "without tls", objs: []client.Object{ingress("team-b", "", managed)}},
+		{name: "other shard", objs: []client.Object{ingress("team-b", "fgtech-tls", managed)}, owns: func(ns string) bool { return ns == "team-a" }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(tc.objs...).Build()
+			err := IngressSecrets(cl, cl, client.MatchingLabels(managed), tc.owns)(probe())
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("err = %v, want one naming %s", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package ingress
+
+import (
+	"context"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RouteIndex is the field index of the Fgtech resources by RoutePathFor.
+// Cache indexes are kept per namespace, so it also serves the lookups
+// combined with client.InNamespace.
+const RouteIndex = "fgtech.route"
+
+// RouteIndexValue is the indexer function of RouteIndex.
+func RouteIndexValue(obj client.Object) []string {
+	fg, ok := obj.(*fgtechv1.Fgtech)
+	if !ok {
+		return nil
+	}
+	return []string{RoutePathFor(fg)}
+}
+
+// IndexFields registers the field indexes the ingress and activator lookups use.
+func IndexFields(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &fgtechv1.Fgtech{}, RouteIndex, RouteIndexValue)
+}
@@ -0,0 +1,46 @@
+package ingress
+
+import "sync"
+
+// namespaceLocks serialises the syncs of a namespace across every Manager of
+// the process: the Fgtech controller, the ingress sync and the TTL watcher
+// each hold their own Manager, rebuilt on reconfiguration, yet rewrite the
+// same objects.
+var namespaceLocks keyedMutex
+
+// keyedMutex is a set of mutexes by key, dropped once nobody holds or waits
+// for them.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks key and returns the function unlocking it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	l := k.locks[key]
+	if l == nil {
+		if k.locks == nil {
+			k.locks = make(map[string]*keyedLock)
+		}
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
@@ -2,12 +2,17 @@ package ingress
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
 
 	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
 	"github.com/fgtech/ia/cursor/pkg/pod"
+	"github.com/fgtech/ia/cursor/pkg/tracing"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
@@ -15,116 +20,293 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	ingressName             = "fgtech-global-ingress"
 	defaultBackendName      = "fgtech-fake-backend"
+	activatorServiceName    = "fgtech-activator"
 	defaultBackendImage     = "nginxdemos/hello"
 	defaultBackendContainer = "backend"
+
+	componentDefaultBackend = "default-backend"
+	componentActivator      = "activator"
 )
 
-// Manager ensures a single ingress per namespace aggregates all Fgtech routes.
+// componentLabels returns the labels of an object shared by the namespace.
+func componentLabels(component string) map[string]string {
+	l := pod.ManagedLabels("")
+	l[pod.LabelComponent] = component
+	return l
+}
+
+// Manager ensures a single ingress per namespace and ingress class aggregates
+// the Fgtech routes. The ingress of the default ingress class is always kept;
+// the ones of the classes set by FgtechClasses exist while they have routes.
 type Manager struct {
-	client           client.Client
-	host             string
-	tlsSecret        string
-	ingressClassName string
+	client        client.Client
+	host          string
+	tlsSecret     string
+	classes       *class.Resolver
+	activatorHost string
+	recorder      record.EventRecorder
+}
+
+// Option customises a Manager.
+type Option func(*Manager)
+
+// WithActivator routes hibernated instances to the activator reachable at host
+// (port 80) instead of the default backend wake-up page. The Ingress reaches it
+// through an ExternalName Service created in each namespace.
+func WithActivator(host string) Option {
+	return func(m *Manager) {
+		m.activatorHost = host
+	}
 }
 
-func NewManager(c client.Client, host, tlsSecret, ingressClassName string) *Manager {
-	return &Manager{client: c, host: host, tlsSecret: tlsSecret, ingressClassName: ingressClassName}
+// WithRecorder records RouteAdded and RouteRemoved events on the Fgtech whose
+// route enters or leaves an Ingress.
+func WithRecorder(r record.EventRecorder) Option {
+	return func(m *Manager) {
+		m.recorder = r
+	}
+}
+
+// NewManager builds a Manager resolving the ingress class of each Fgtech
+// through classes.
+func NewManager(c client.Client, host, tlsSecret string, classes *class.Resolver, opts ...Option) *Manager {
+	m := &Manager{client: c, host: host, tlsSecret: tlsSecret, classes: classes}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
-// SyncNamespace reconciles the ingress for the provided namespace.
-func (m *Manager) SyncNamespace(ctx context.Context, namespace string, log logr.Logger) error {
+// SyncNamespace reconciles the ingress for the provided namespace. The syncs
+// of a namespace run one at a time, whichever Manager runs them.
+func (m *Manager) SyncNamespace(ctx context.Context, namespace string, log logr.Logger) (err error) {
+	ctx, span := tracing.Start(ctx, "Ingress.SyncNamespace", tracing.AttrNamespace.String(namespace))
+	defer func() { tracing.End(span, "", err) }()
 	if m.host == "" {
 		return fmt.Errorf("FGTECH_INGRESS_FQDN env not set")
 	}
+	defer namespaceLocks.lock(namespace)()
 
 	if err := m.ensureDefaultBackend(ctx, namespace); err != nil {
 		return err
 	}
+	if m.activatorHost != "" {
+		if err := m.ensureActivatorService(ctx, namespace); err != nil {
+			return err
+		}
+	}
 
-	routes, err := m.collectRoutes(ctx, namespace)
+	routes, owners, err := m.collectRoutes(ctx, namespace)
 	if err != nil {
 		return err
 	}
 
-	key := types.NamespacedName{Name: ingressName, Namespace: namespace}
+	defaultClass := m.classes.Defaults().IngressClassName
+	if _, ok := routes[defaultClass]; !ok {
+		routes[defaultClass] = nil
+	}
+	for className, paths := range routes {
+		if err := m.syncIngress(ctx, namespace, className, paths, owners, log); err != nil {
+			return err
+		}
+	}
+
+	return m.deleteStaleIngresses(ctx, namespace, routes, owners, log)
+}
+
+func (m *Manager) syncIngress(ctx context.Context, namespace, className string, routes []networkingv1.HTTPIngressPath, owners map[string]*fgtechv1.Fgtech, log logr.Logger) error {
+	name := m.ingressNameFor(className)
+	key := types.NamespacedName{Name: name, Namespace: namespace}
 	var ing networkingv1.Ingress
 	if err := m.client.Get(ctx, key, &ing); err != nil {
 		if apierrors.IsNotFound(err) {
-			newIng := m.buildIngress(namespace, routes)
+			newIng := m.buildIngress(namespace, name, className, routes)
 			if err := m.client.Create(ctx, newIng); err != nil {
 				return err
 			}
-			log.Info("Ingress created", "ingress", ingressName)
+			metrics.IngressRoutes.WithLabelValues(namespace, name).Set(float64(len(routes)))
+			m.recordRouteChanges(name, nil, newIng, owners)
+			log.Info("Ingress created", "ingress", name)
 			return nil
 		}
 		return err
 	}
 
-	if m.needsUpdate(&ing, routes) {
+	if m.needsUpdate(&ing, className, routes) {
 		updated := ing.DeepCopy()
-		m.applySpec(updated, routes)
+		m.applySpec(updated, className, routes)
 		if err := m.client.Update(ctx, updated); err != nil {
+			if apierrors.IsConflict(err) {
+				metrics.IngressConflicts.Inc()
+			}
 			return err
 		}
-		log.Info("Ingress updated", "ingress", ingressName)
+		m.recordRouteChanges(name, &ing, updated, owners)
+		log.Info("Ingress updated", "ingress", name)
 	}
+	metrics.IngressRoutes.WithLabelValues(namespace, name).Set(float64(len(routes)))
+	return nil
+}
 
+// deleteStaleIngresses removes the ingresses of the ingress classes left without routes.
+func (m *Manager) deleteStaleIngresses(ctx context.Context, namespace string, routes map[string][]networkingv1.HTTPIngressPath, owners map[string]*fgtechv1.Fgtech, log logr.Logger) error {
+	var list networkingv1.IngressList
+	if err := m.client.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabels(pod.ManagedLabels(""))); err != nil {
+		return err
+	}
+	desired := make(map[string]bool, len(routes))
+	for className := range routes {
+		desired[m.ingressNameFor(className)] = true
+	}
+	for i := range list.Items {
+		ing := &list.Items[i]
+		if desired[ing.Name] || !strings.HasPrefix(ing.Name, ingressName+"-") {
+			continue
+		}
+		if err := m.client.Delete(ctx, ing); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		metrics.IngressRoutes.DeleteLabelValues(namespace, ing.Name)
+		m.recordRouteChanges(ing.Name, ing, nil, owners)
+		log.Info("Ingress deleted", "ingress", ing.Name)
+	}
 	return nil
 }
 
-func (m *Manager) collectRoutes(ctx context.Context, namespace string) ([]networkingv1.HTTPIngressPath, error) {
+// ingressNameFor keeps the historical name for the default ingress class and
+// suffixes the others with their ingress class name.
+func (m *Manager) ingressNameFor(className string) string {
+	if className == m.classes.Defaults().IngressClassName {
+		return ingressName
+	}
+	return ingressName + "-" + className
+}
+
+// collectRoutes returns the routes of the namespace grouped by ingress class,
+// and the Fgtech resources of the namespace by route path, routed or not.
+// Instances whose FgtechClass is missing get no route until it exists.
+func (m *Manager) collectRoutes(ctx context.Context, namespace string) (map[string][]networkingv1.HTTPIngressPath, map[string]*fgtechv1.Fgtech, error) {
 	var list fgtechv1.FgtechList
 	if err := m.client.List(ctx, &list, client.InNamespace(namespace)); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	paths := make([]networkingv1.HTTPIngressPath, 0, len(list.Items))
+	routes := make(map[string][]networkingv1.HTTPIngressPath)
+	owners := make(map[string]*fgtechv1.Fgtech, len(list.Items))
 	for i := range list.Items {
 		item := list.Items[i]
-		pathValue := buildRoutePath(item.Spec.ExtraPath, item.Name)
+		owners[RoutePathFor(&item)] = &list.Items[i]
+		// Archived instances have no route; terminating ones lose it first.
+		if item.Status.Phase == fgtechv1.PhaseArchived || !item.DeletionTimestamp.IsZero() {
+			continue
+		}
+		settings, err := m.classes.Resolve(ctx, &item)
+		if err != nil {
+			if errors.Is(err, class.ErrNotFound) {
+				continue
+			}
+			return nil, nil, err
+		}
+		pathValue := RoutePathFor(&item)
 		backend := networkingv1.IngressBackend{
 			Service: &networkingv1.IngressServiceBackend{
-				Name: pod.ServiceNameFor(&item),
+				Name: m.backendServiceFor(&item),
 				Port: networkingv1.ServiceBackendPort{Number: 80},
 			},
 		}
-		paths = append(paths, networkingv1.HTTPIngressPath{
+		routes[settings.IngressClassName] = append(routes[settings.IngressClassName], networkingv1.HTTPIngressPath{
 			Path:     pathValue,
 			PathType: pathTypePtr(networkingv1.PathTypePrefix),
 			Backend:  backend,
 		})
 	}
 
-	sort.Slice(paths, func(i, j int) bool {
-		return paths[i].Path < paths[j].Path
-	})
+	for _, paths := range routes {
+		sort.Slice(paths, func(i, j int) bool {
+			return paths[i].Path < paths[j].Path
+		})
+	}
 
-	return paths, nil
+	return routes, owners, nil
 }
 
-func (m *Manager) buildIngress(namespace string, routes []networkingv1.HTTPIngressPath) *networkingv1.Ingress {
+// recordRouteChanges emits RouteAdded and RouteRemoved on the Fgtech owning
+// each path that entered or left the Ingress name; before or after is nil when
+// the Ingress is created or deleted. Paths of Fgtech resources already gone
+// are skipped.
+func (m *Manager) recordRouteChanges(name string, before, after *networkingv1.Ingress, owners map[string]*fgtechv1.Fgtech) {
+	if m.recorder == nil {
+		return
+	}
+	old, cur := ingressPaths(before), ingressPaths(after)
+	for path := range cur {
+		if fg := owners[path]; fg != nil && !old[path] {
+			m.recorder.Eventf(fg, corev1.EventTypeNormal, "RouteAdded", "route %s%s added to ingress %s", m.host, path, name)
+		}
+	}
+	for path := range old {
+		if fg := owners[path]; fg != nil && !cur[path] {
+			m.recorder.Eventf(fg, corev1.EventTypeNormal, "RouteRemoved", "route %s%s removed from ingress %s", m.host, path, name)
+		}
+	}
+}
+
+// ingressPaths returns the set of paths routed by ing.
+func ingressPaths(ing *networkingv1.Ingress) map[string]bool {
+	paths := map[string]bool{}
+	if ing == nil {
+		return paths
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			paths[p.Path] = true
+		}
+	}
+	return paths
+}
+
+// backendServiceFor returns the Service a route points at: the instance Service,
+// the default backend page while scaled down by its schedule, or, while
+// hibernated, the activator when one is configured and the wake-up page otherwise.
+func (m *Manager) backendServiceFor(fg *fgtechv1.Fgtech) string {
+	switch fg.Status.Phase {
+	case fgtechv1.PhaseScaledDown:
+		return defaultBackendName
+	case fgtechv1.PhaseHibernated:
+		if m.activatorHost != "" {
+			return activatorServiceName
+		}
+		return defaultBackendName
+	}
+	return pod.ServiceNameFor(fg)
+}
+
+func (m *Manager) buildIngress(namespace, name, className string, routes []networkingv1.HTTPIngressPath) *networkingv1.Ingress {
 	ing := &networkingv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      ingressName,
+			Name:      name,
 			Namespace: namespace,
-			Labels: map[string]string{
-				"app": "fgtech",
-			},
+			Labels:    pod.ManagedLabels(""),
 		},
 	}
-	m.applySpec(ing, routes)
+	m.applySpec(ing, className, routes)
 	return ing
 }
 
-func (m *Manager) applySpec(ing *networkingv1.Ingress, routes []networkingv1.HTTPIngressPath) {
-	if m.ingressClassName != "" {
-		ing.Spec.IngressClassName = &m.ingressClassName
+func (m *Manager) applySpec(ing *networkingv1.Ingress, className string, routes []networkingv1.HTTPIngressPath) {
+	ing.Spec.IngressClassName = nil
+	if className != "" {
+		ing.Spec.IngressClassName = &className
 	}
 	ing.Spec.DefaultBackend = &networkingv1.IngressBackend{
 		Service: &networkingv1.IngressServiceBackend{
@@ -163,9 +345,9 @@ func (m *Manager) applySpec(ing *networkingv1.Ingress, routes []networkingv1.HTT
 	}
 }
 
-func (m *Manager) needsUpdate(ing *networkingv1.Ingress, routes []networkingv1.HTTPIngressPath) bool {
+func (m *Manager) needsUpdate(ing *networkingv1.Ingress, className string, routes []networkingv1.HTTPIngressPath) bool {
 	desired := &networkingv1.Ingress{}
-	m.applySpec(desired, routes)
+	m.applySpec(desired, className, routes)
 	return !ingressEqual(ing, desired)
 }
 
@@ -243,6 +425,38 @@ func ingressEqual(existing, desired *networkingv1.Ingress) bool {
 	return true
 }
 
+// ActivatorRoute returns the longest path of ing that routes host and path to
+// the activator Service, or "" when ing sends them elsewhere. A rule without a
+// host matches every host.
+func ActivatorRoute(ing *networkingv1.Ingress, host, path string) string {
+	route := ""
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil || (rule.Host != "" && rule.Host != host) {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			if p.Backend.Service == nil || p.Backend.Service.Name != activatorServiceName {
+				continue
+			}
+			if prefixMatches(p.Path, path) && len(p.Path) > len(route) {
+				route = p.Path
+			}
+		}
+	}
+	return route
+}
+
+// prefixMatches applies the Prefix path type: prefix matches path element-wise.
+func prefixMatches(prefix, path string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// RoutePathFor returns the ingress path serving a Fgtech.
+func RoutePathFor(fg *fgtechv1.Fgtech) string {
+	return buildRoutePath(fg.Spec.ExtraPath, fg.Name)
+}
+
 func buildRoutePath(extraPath, name string) string {
 	base := strings.TrimSpace(extraPath)
 	base = strings.Trim(base, "/")
@@ -271,13 +485,11 @@ func (m *Manager) ensureBackendPod(ctx context.Context, namespace string) error
 	var existing corev1.Pod
 	if err := m.client.Get(ctx, key, &existing); err != nil {
 		if apierrors.IsNotFound(err) {
-			pod := &corev1.Pod{
+			backend := &corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      defaultBackendName,
 					Namespace: namespace,
-					Labels: map[string]string{
-						"app": defaultBackendName,
-					},
+					Labels:    componentLabels(componentDefaultBackend),
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
@@ -293,7 +505,7 @@ func (m *Manager) ensureBackendPod(ctx context.Context, namespace string) error
 					RestartPolicy: corev1.RestartPolicyAlways,
 				},
 			}
-			return m.client.Create(ctx, pod)
+			return m.create(ctx, backend, nil)
 		}
 		return err
 	}
@@ -309,10 +521,10 @@ func (m *Manager) ensureBackendService(ctx context.Context, namespace string) er
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      defaultBackendName,
 					Namespace: namespace,
-					Labels:    map[string]string{"app": defaultBackendName},
+					Labels:    componentLabels(componentDefaultBackend),
 				},
 				Spec: corev1.ServiceSpec{
-					Selector: map[string]string{"app": defaultBackendName},
+					Selector: componentLabels(componentDefaultBackend),
 					Ports: []corev1.ServicePort{
 						{
 							Name:       "http",
@@ -322,9 +534,68 @@ func (m *Manager) ensureBackendService(ctx context.Context, namespace string) er
 					},
 				},
 			}
-			return m.client.Create(ctx, svc)
+			return m.create(ctx, svc, map[string]interface{}{"selector": svc.Spec.Selector})
+		}
+		return err
+	}
+	return nil
+}
+
+// create creates a shared object. One left by an operator version that did not
+// label it is invisible to the label-filtered cache and already exists: its
+// labels, and the spec fields given, are patched so that the cache sees it.
+func (m *Manager) create(ctx context.Context, obj client.Object, spec map[string]interface{}) error {
+	err := m.client.Create(ctx, obj)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": obj.GetLabels()},
+	}
+	if spec != nil {
+		patch["spec"] = spec
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	return m.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
+}
+
+// ensureActivatorService keeps an ExternalName Service pointing at the activator
+// so that the namespace Ingress can route hibernated paths to it.
+func (m *Manager) ensureActivatorService(ctx context.Context, namespace string) error {
+	key := types.NamespacedName{Name: activatorServiceName, Namespace: namespace}
+	var existing corev1.Service
+	if err := m.client.Get(ctx, key, &existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      activatorServiceName,
+					Namespace: namespace,
+					Labels:    componentLabels(componentActivator),
+				},
+				Spec: corev1.ServiceSpec{
+					Type:         corev1.ServiceTypeExternalName,
+					ExternalName: m.activatorHost,
+					Ports: []corev1.ServicePort{
+						{
+							Name: "http",
+							Port: 80,
+						},
+					},
+				},
+			}
+			return m.create(ctx, svc, nil)
 		}
 		return err
 	}
+	if existing.Spec.Type != corev1.ServiceTypeExternalName || existing.Spec.ExternalName != m.activatorHost {
+		updated := existing.DeepCopy()
+		updated.Spec.Type = corev1.ServiceTypeExternalName
+		updated.Spec.ExternalName = m.activatorHost
+		updated.Spec.Selector = nil
+		return m.client.Update(ctx, updated)
+	}
 	return nil
 }
@@ -2,16 +2,31 @@ package ingress
 
 import (
 	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/fgtech/ia/cursor/pkg/pod"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/yaml"
 )
 
@@ -68,7 +83,7 @@ func TestSyncNamespaceBuildsIngressYAML(t *testing.T) {
 	}
 	defaultNamespace := "demo"
 	cl := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(fg1, fg2).Build()
-	mgr := NewManager(cl, "apps.example.com", "fgtech-tls", "nginx")
+	mgr := NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"}))
 
 	if err := mgr.SyncNamespace(context.Background(), defaultNamespace, logr.Discard()); err != nil {
 		t.Fatalf("SyncNamespace error: %v", err)
@@ -133,6 +148,304 @@ status:
 	}
 }
 
+func TestCollectRoutesFollowsPhase(t *testing.T) {
+	items := []*fgtechv1.Fgtech{
+		{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "demo"}, Status: fgtechv1.FgtechStatus{Phase: fgtechv1.PhaseRunning}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "sleeping", Namespace: "demo"}, Status: fgtechv1.FgtechStatus{Phase: fgtechv1.PhaseHibernated}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gone", Namespace: "demo"}, Status: fgtechv1.FgtechStatus{Phase: fgtechv1.PhaseArchived}},
+		{ObjectMeta: metav1.ObjectMeta{
+			Name:              "leaving",
+			Namespace:         "demo",
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+			Finalizers:        []string{fgtechv1.FinalizerCleanup},
+		}, Status: fgtechv1.FgtechStatus{Phase: fgtechv1.PhaseRunning}},
+	}
+	builder := fake.NewClientBuilder().WithScheme(newIngressScheme(t))
+	for _, item := range items {
+		builder = builder.WithObjects(item)
+	}
+	cl := builder.Build()
+	mgr := NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"}))
+
+	routes, _, err := mgr.collectRoutes(context.Background(), "demo")
+	if err != nil {
+		t.Fatalf("collectRoutes: %v", err)
+	}
+	got := map[string]string{}
+	for _, r := range routes["nginx"] {
+		got[r.Path] = r.Backend.Service.Name
+	}
+	want := map[string]string{"/running": "running-svc", "/sleeping": defaultBackendName}
+	if len(got) != len(want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+	for path, svc := range want {
+		if got[path] != svc {
+			t.Fatalf("route %s -> %s, want %s", path, got[path], svc)
+		}
+	}
+}
+
+func TestSyncNamespaceRoutesHibernatedToActivator(t *testing.T) {
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "sleeping", Namespace: "demo"},
+		Status:     fgtechv1.FgtechStatus{Phase: fgtechv1.PhaseHibernated},
+	}
+	cl := fake.NewClientBuilder().WithScheme(newIngressScheme(t)).WithObjects(fg).Build()
+	mgr := NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"}), WithActivator("fgtech-activator.fgtech-system.svc.cluster.local"))
+
+	if err := mgr.SyncNamespace(context.Background(), "demo", logr.Discard()); err != nil {
+		t.Fatalf("SyncNamespace error: %v", err)
+	}
+
+	var svc corev1.Service
+	if err := cl.Get(context.Background(), types.NamespacedName{Name: activatorServiceName, Namespace: "demo"}, &svc); err != nil {
+		t.Fatalf("activator service not found: %v", err)
+	}
+	if svc.Spec.Type != corev1.ServiceTypeExternalName || svc.Spec.ExternalName != "fgtech-activator.fgtech-system.svc.cluster.local" {
+		t.Fatalf("unexpected activator service spec: %+v", svc.Spec)
+	}
+
+	var ing networkingv1.Ingress
+	if err := cl.Get(context.Background(), types.NamespacedName{Name: ingressName, Namespace: "demo"}, &ing); err != nil {
+		t.Fatalf("ingress not found: %v", err)
+	}
+	paths := ing.Spec.Rules[0].HTTP.Paths
+	if len(paths) != 1 || paths[0].Backend.Service.Name != activatorServiceName {
+		t.Fatalf("expected hibernated route to target the activator, got %+v", paths)
+	}
+}
+
+func TestSyncNamespaceSplitsRoutesByIngressClass(t *testing.T) {
+	internal := &fgtechv1.FgtechClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "private"},
+		Spec:       fgtechv1.FgtechClassSpec{IngressClassName: "internal"},
+	}
+	public := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "demo"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx:1.25", Version: "1.0.0"},
+	}
+	private := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "demo"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx:1.25", Version: "1.0.0", ClassName: "private"},
+	}
+	orphan := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "demo"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx:1.25", Version: "1.0.0", ClassName: "missing"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(newIngressScheme(t)).WithObjects(internal, public, private, orphan).Build()
+	mgr := NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"}))
+	ctx := context.Background()
+
+	if err := mgr.SyncNamespace(ctx, "demo", logr.Discard()); err != nil {
+		t.Fatalf("SyncNamespace error: %v", err)
+	}
+
+	want := map[string]struct{ class, path string }{
+		ingressName:               {class: "nginx", path: "/public"},
+		ingressName + "-internal": {class: "internal", path: "/private"},
+	}
+	for name, w := range want {
+		var ing networkingv1.Ingress
+		if err := cl.Get(ctx, types.NamespacedName{Name: name, Namespace: "demo"}, &ing); err != nil {
+			t.Fatalf("ingress %s not found: %v", name, err)
+		}
+		if ing.Spec.IngressClassName == nil || *ing.Spec.IngressClassName != w.class {
+			t.Fatalf("ingress %s class = %v, want %s", name, ing.Spec.IngressClassName, w.class)
+		}
+		paths := ing.Spec.Rules[0].HTTP.Paths
+		if len(paths) != 1 || paths[0].Path != w.path {
+			t.Fatalf("ingress %s paths = %+v, want only %s", name, paths, w.path)
+		}
+		if got := testutil.ToFloat64(metrics.IngressRoutes.WithLabelValues("demo", name)); got != 1 {
+			t.Fatalf("ingress %s routes metric = %v, want 1", name, got)
+		}
+	}
+
+	if err := cl.Delete(ctx, private); err != nil {
+		t.Fatalf("delete fgtech: %v", err)
+	}
+	if err := mgr.SyncNamespace(ctx, "demo", logr.Discard()); err != nil {
+		t.Fatalf("SyncNamespace error: %v", err)
+	}
+	err := cl.Get(ctx, types.NamespacedName{Name: ingressName + "-internal", Namespace: "demo"}, &networkingv1.Ingress{})
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the internal ingress to be deleted, got err: %v", err)
+	}
+	if metrics.IngressRoutes.DeleteLabelValues("demo", ingressName+"-internal") {
+		t.Fatalf("expected the routes metric of the deleted ingress to be removed")
+	}
+}
+
+func TestSyncNamespaceCountsUpdateConflicts(t *testing.T) {
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "conflicts"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx:1.25", Version: "1.0.0"},
+	}
+	stale := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: ingressName, Namespace: "conflicts", Labels: pod.ManagedLabels("")}}
+	cl := fake.NewClientBuilder().WithScheme(newIngressScheme(t)).WithObjects(fg, stale).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				if _, ok := obj.(*networkingv1.Ingress); ok {
+					return apierrors.NewConflict(schema.GroupResource{Group: "networking.k8s.io", Resource: "ingresses"}, obj.GetName(), nil)
+				}
+				return c.Update(ctx, obj, opts...)
+			},
+		}).Build()
+	mgr := NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"}))
+	conflicts := testutil.ToFloat64(metrics.IngressConflicts)
+
+	if err := mgr.SyncNamespace(context.Background(), "conflicts", logr.Discard()); !apierrors.IsConflict(err) {
+		t.Fatalf("SyncNamespace error = %v, want a conflict", err)
+	}
+	if got := testutil.ToFloat64(metrics.IngressConflicts) - conflicts; got != 1 {
+		t.Fatalf("conflicts = %v, want 1", got)
+	}
+}
+
+func TestSyncNamespaceSerialisesConcurrentSyncs(t *testing.T) {
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "busy"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx:1.25", Version: "1.0.0"},
+	}
+	// Slow Ingress reads widen the window in which two syncs would interleave.
+	var inFlight, overlaps atomic.Int32
+	cl := fake.NewClientBuilder().WithScheme(newIngressScheme(t)).WithObjects(fg).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if _, ok := obj.(*networkingv1.Ingress); ok {
+					if inFlight.Add(1) > 1 {
+						overlaps.Add(1)
+					}
+					defer inFlight.Add(-1)
+					time.Sleep(5 * time.Millisecond)
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+	// The reconciler and the TTL watcher each hold their own Manager.
+	managers := []*Manager{
+		NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"})),
+		NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"})),
+	}
+	conflicts := testutil.ToFloat64(metrics.IngressConflicts)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(m *Manager) {
+			defer wg.Done()
+			errs <- m.SyncNamespace(context.Background(), "busy", logr.Discard())
+		}(managers[i%len(managers)])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent SyncNamespace: %v", err)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.IngressConflicts) - conflicts; got != 0 {
+		t.Fatalf("conflicts = %v, want 0", got)
+	}
+	if n := overlaps.Load(); n != 0 {
+		t.Fatalf("%d syncs of the namespace overlapped", n)
+	}
+	namespaceLocks.mu.Lock()
+	defer namespaceLocks.mu.Unlock()
+	if len(namespaceLocks.locks) != 0 {
+		t.Fatalf("namespace locks not released: %v", namespaceLocks.locks)
+	}
+}
+
+func TestSyncNamespaceAdoptsUnlabeledSharedObjects(t *testing.T) {
+	legacy := map[string]string{"app": defaultBackendName}
+	backendPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: defaultBackendName, Namespace: "demo", Labels: legacy}}
+	backendSvc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: defaultBackendName, Namespace: "demo", Labels: legacy},
+		Spec:       corev1.ServiceSpec{Selector: legacy},
+	}
+	activatorSvc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: activatorServiceName, Namespace: "demo", Labels: map[string]string{"app": activatorServiceName}},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "activator.local"},
+	}
+	// Hide the objects the label-filtered cache would not hold.
+	cl := fake.NewClientBuilder().WithScheme(newIngressScheme(t)).WithObjects(backendPod, backendSvc, activatorSvc).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if err := c.Get(ctx, key, obj, opts...); err != nil {
+					return err
+				}
+				if !pod.ManagedSelector().Matches(labels.Set(obj.GetLabels())) {
+					return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+				}
+				return nil
+			},
+		}).Build()
+	mgr := NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"}), WithActivator("activator.local"))
+	ctx := context.Background()
+
+	if err := mgr.SyncNamespace(ctx, "demo", logr.Discard()); err != nil {
+		t.Fatalf("SyncNamespace error: %v", err)
+	}
+
+	want := componentLabels(componentDefaultBackend)
+	var gotPod corev1.Pod
+	if err := cl.Get(ctx, types.NamespacedName{Name: defaultBackendName, Namespace: "demo"}, &gotPod); err != nil {
+		t.Fatalf("default backend pod not visible: %v", err)
+	}
+	if !reflect.DeepEqual(gotPod.Labels, want) {
+		t.Fatalf("default backend pod labels = %v, want %v", gotPod.Labels, want)
+	}
+	var gotSvc corev1.Service
+	if err := cl.Get(ctx, types.NamespacedName{Name: defaultBackendName, Namespace: "demo"}, &gotSvc); err != nil {
+		t.Fatalf("default backend service not visible: %v", err)
+	}
+	if !reflect.DeepEqual(gotSvc.Spec.Selector, want) {
+		t.Fatalf("default backend selector = %v, want %v", gotSvc.Spec.Selector, want)
+	}
+	if err := cl.Get(ctx, types.NamespacedName{Name: activatorServiceName, Namespace: "demo"}, &corev1.Service{}); err != nil {
+		t.Fatalf("activator service not visible: %v", err)
+	}
+}
+
+func TestSyncNamespaceRecordsRouteEvents(t *testing.T) {
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "events"},
+		Spec:       fgtechv1.FgtechSpec{Image: "nginx:1.25", Version: "1.0.0"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(newIngressScheme(t)).WithObjects(fg).WithStatusSubresource(fg).Build()
+	recorder := record.NewFakeRecorder(10)
+	mgr := NewManager(cl, "apps.example.com", "fgtech-tls", class.NewResolver(cl, class.Defaults{IngressClassName: "nginx"}), WithRecorder(recorder))
+	ctx := context.Background()
+
+	if err := mgr.SyncNamespace(ctx, "events", logr.Discard()); err != nil {
+		t.Fatalf("SyncNamespace error: %v", err)
+	}
+	if ev := <-recorder.Events; ev != "Normal RouteAdded route apps.example.com/demo added to ingress "+ingressName {
+		t.Fatalf("unexpected event %q", ev)
+	}
+	// An unchanged route records nothing.
+	if err := mgr.SyncNamespace(ctx, "events", logr.Discard()); err != nil {
+		t.Fatalf("SyncNamespace error: %v", err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Fatalf("unexpected event %q", <-recorder.Events)
+	}
+
+	fg.Status.Phase = fgtechv1.PhaseArchived
+	if err := cl.Status().Update(ctx, fg); err != nil {
+		t.Fatalf("archive fgtech: %v", err)
+	}
+	if err := mgr.SyncNamespace(ctx, "events", logr.Discard()); err != nil {
+		t.Fatalf("SyncNamespace error: %v", err)
+	}
+	if ev := <-recorder.Events; ev != "Normal RouteRemoved route apps.example.com/demo removed from ingress "+ingressName {
+		t.Fatalf("unexpected event %q", ev)
+	}
+}
+
 func newIngressScheme(t *testing.T) *runtime.Scheme {
 	t.Helper()
 	scheme := runtime.NewScheme()
@@ -0,0 +1,187 @@
+// Package metrics holds the operator metrics, registered with the
+// controller-runtime registry and served on --metrics-bind-address. Label
+// values come from fixed sets or from namespace, phase, class and ingress
+// names, never from instance names, so that cardinality stays bounded.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Pod recreation reasons that are not a podNeedsUpdate difference.
+const (
+	RecreationPodFailed        = "podFailed"
+	RecreationDeadlineExceeded = "deadlineExceeded"
+	RecreationDeadlineExtended = "deadlineExtended"
+)
+
+// DeletionImageNotAllowed is the PodDeletions reason of the Pods whose image
+// the class no longer allows.
+const DeletionImageNotAllowed = "imageNotAllowed"
+
+var (
+	// ReadySeconds observes the time from the start of an instance lifetime
+	// (creation or wake-up) to its Pod first turning Ready.
+	ReadySeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "fgtech_instance_ready_seconds",
+		Help:    "Time from the creation or wake-up of an instance to its Pod becoming Ready.",
+		Buckets: []float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600},
+	})
+	// PodRecreations counts the instance Pods deleted to be replaced, by reason.
+	PodRecreations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fgtech_pod_recreations_total",
+		Help: "Instance Pods deleted to be recreated, by reason.",
+	}, []string{"reason"})
+	// PodDeletions counts the instance Pods deleted and not replaced, by reason.
+	PodDeletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fgtech_pod_deletions_total",
+		Help: "Instance Pods deleted without a replacement, by reason.",
+	}, []string{"reason"})
+	// Expirations counts the instances expired, by applied policy.
+	Expirations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fgtech_expirations_total",
+		Help: "Instances expired, by applied expiry policy.",
+	}, []string{"policy"})
+	// SweepExpirations observes how many instances each TTL sweep expired.
+	SweepExpirations = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "fgtech_ttl_sweep_expirations",
+		Help:    "Instances expired by each safety-net TTL sweep.",
+		Buckets: []float64{0, 1, 2, 5, 10, 25, 50, 100, 250},
+	})
+	// IngressRoutes reports the routes of each Ingress the operator manages.
+	IngressRoutes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fgtech_ingress_routes",
+		Help: "Routes held by each operator-managed Ingress.",
+	}, []string{"namespace", "ingress"})
+	// IngressConflicts counts the Ingress updates rejected for a stale resourceVersion.
+	IngressConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fgtech_ingress_update_conflicts_total",
+		Help: "Ingress updates rejected with a conflict.",
+	})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(ReadySeconds, PodRecreations, PodDeletions, Expirations, SweepExpirations, IngressRoutes, IngressConflicts)
+}
+
+// ForgetNamespace drops the series of a deleted namespace.
+func ForgetNamespace(namespace string) {
+	IngressRoutes.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+}
+
+var (
+	instancesDesc = prometheus.NewDesc("fgtech_instances",
+		"Fgtech instances by namespace, phase and class.",
+		[]string{"namespace", "phase", "class"}, nil)
+	ttlRemainingDesc = prometheus.NewDesc("fgtech_ttl_remaining_seconds",
+		"Time left before expiry of the instances with a TTL, by namespace.",
+		[]string{"namespace"}, nil)
+)
+
+// ttlRemainingBuckets are the upper bounds of fgtech_ttl_remaining_seconds.
+var ttlRemainingBuckets = []float64{300, 900, 1800, 3600, 7200, 21600, 43200, 86400}
+
+// collectTimeout bounds the Fgtech list made on each scrape.
+const collectTimeout = 5 * time.Second
+
+// InstanceCollector derives fgtech_instances and fgtech_ttl_remaining_seconds
+// from the Fgtech resources on each scrape.
+type InstanceCollector struct {
+	reader  client.Reader
+	classes *class.Resolver
+	log     logr.Logger
+	clock   clock.PassiveClock
+}
+
+// NewInstanceCollector lists the Fgtech resources through r, normally the
+// manager cache. The instances without spec.className are counted under the
+// default class of classes; a nil classes leaves their class empty.
+func NewInstanceCollector(r client.Reader, classes *class.Resolver, log logr.Logger, c clock.PassiveClock) *InstanceCollector {
+	if c == nil {
+		c = clock.RealClock{}
+	}
+	return &InstanceCollector{reader: r, classes: classes, log: log, clock: c}
+}
+
+// Describe implements prometheus.Collector.
+func (c *InstanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- instancesDesc
+	ch <- ttlRemainingDesc
+}
+
+// Collect implements prometheus.Collector. A failed list leaves both metrics
+// out of the scrape rather than failing it.
+func (c *InstanceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	var list fgtechv1.FgtechList
+	if err := c.reader.List(ctx, &list); err != nil {
+		c.log.Error(err, "unable to list fgteches for metrics")
+		return
+	}
+	var defaultClass string
+	if c.classes != nil {
+		var err error
+		if defaultClass, err = c.classes.DefaultClassName(ctx); err != nil {
+			c.log.Error(err, "unable to resolve the default class for metrics")
+			return
+		}
+	}
+
+	type instanceKey struct{ namespace, phase, class string }
+	instances := map[instanceKey]float64{}
+	type ttlHistogram struct {
+		count   uint64
+		sum     float64
+		buckets map[float64]uint64
+	}
+	ttls := map[string]*ttlHistogram{}
+	now := c.clock.Now()
+	for i := range list.Items {
+		item := &list.Items[i]
+		className := item.Spec.ClassName
+		if className == "" {
+			className = defaultClass
+		}
+		instances[instanceKey{item.Namespace, item.Status.Phase, className}]++
+
+		if item.Status.ExpiresAt == nil {
+			continue
+		}
+		remaining := item.Status.ExpiresAt.Sub(now).Seconds()
+		if remaining < 0 {
+			remaining = 0
+		}
+		h := ttls[item.Namespace]
+		if h == nil {
+			h = &ttlHistogram{buckets: make(map[float64]uint64, len(ttlRemainingBuckets))}
+			for _, b := range ttlRemainingBuckets {
+				h.buckets[b] = 0
+			}
+			ttls[item.Namespace] = h
+		}
+		h.count++
+		h.sum += remaining
+		for _, b := range ttlRemainingBuckets {
+			if remaining <= b {
+				h.buckets[b]++
+			}
+		}
+	}
+
+	for k, n := range instances {
+		ch <- prometheus.MustNewConstMetric(instancesDesc, prometheus.GaugeValue, n, k.namespace, k.phase, k.class)
+	}
+	for ns, h := range ttls {
+		ch <- prometheus.MustNewConstHistogram(ttlRemainingDesc, h.count, h.sum, h.buckets, ns)
+	}
+}
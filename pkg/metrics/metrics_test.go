@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newFakeClient(t *testing.T, objs ...client.Object) client.WithWatch {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := fgtechv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add fgtech scheme: %v", err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestInstanceCollector(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	instance := func(namespace, name, phase, className string, ttl time.Duration) *fgtechv1.Fgtech {
+		fg := &fgtechv1.Fgtech{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       fgtechv1.FgtechSpec{ClassName: className},
+			Status:     fgtechv1.FgtechStatus{Phase: phase},
+		}
+		if ttl != 0 {
+			fg.Status.ExpiresAt = &metav1.Time{Time: now.Add(ttl)}
+		}
+		return fg
+	}
+	cl := newFakeClient(t,
+		instance("team-a", "one", fgtechv1.PhaseRunning, "", 10*time.Minute),
+		instance("team-a", "two", fgtechv1.PhaseRunning, "", 2*time.Hour),
+		instance("team-a", "three", fgtechv1.PhaseHibernated, "gpu", 0),
+		instance("team-b", "four", fgtechv1.PhaseRunning, "gpu", -time.Minute),
+		&fgtechv1.FgtechClass{ObjectMeta: metav1.ObjectMeta{
+			Name:        "standard",
+			Annotations: map[string]string{fgtechv1.AnnotationDefaultClass: "true"},
+		}},
+	)
+	classes := class.NewResolver(cl, class.Defaults{})
+	c := NewInstanceCollector(cl, classes, logr.Discard(), clocktesting.NewFakePassiveClock(now))
+
+	want := `
+# HELP fgtech_instances Fgtech instances by namespace, phase and class.
+# TYPE fgtech_instances gauge
+fgtech_instances{class="standard",namespace="team-a",phase="Running"} 2
+fgtech_instances{class="gpu",namespace="team-a",phase="Hibernated"} 1
+fgtech_instances{class="gpu",namespace="team-b",phase="Running"} 1
+# HELP fgtech_ttl_remaining_seconds Time left before expiry of the instances with a TTL, by namespace.
+# TYPE fgtech_ttl_remaining_seconds histogram
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="300"} 0
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="900"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="1800"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="3600"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="7200"} 2
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="21600"} 2
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="43200"} 2
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="86400"} 2
+fgtech_ttl_remaining_seconds_bucket{namespace="team-a",le="+Inf"} 2
+fgtech_ttl_remaining_seconds_sum{namespace="team-a"} 7800
+fgtech_ttl_remaining_seconds_count{namespace="team-a"} 2
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="300"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="900"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="1800"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="3600"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="7200"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="21600"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="43200"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="86400"} 1
+fgtech_ttl_remaining_seconds_bucket{namespace="team-b",le="+Inf"} 1
+fgtech_ttl_remaining_seconds_sum{namespace="team-b"} 0
+fgtech_ttl_remaining_seconds_count{namespace="team-b"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+}
+
+func TestInstanceCollectorSkipsFailedList(t *testing.T) {
+	cl := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			return errors.New("cache not synced")
+		},
+	}).Build()
+	c := NewInstanceCollector(cl, nil, logr.Discard(), nil)
+	if n := testutil.CollectAndCount(c); n != 0 {
+		t.Fatalf("collected %d metrics, want none", n)
+	}
+}
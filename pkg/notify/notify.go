@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Lifecycle event types, in CloudEvents reverse-DNS form.
+const (
+	TypeCreated      = "io.fgtech.fgtech.created"
+	TypeUpdated      = "io.fgtech.fgtech.updated"
+	TypeExpiringSoon = "io.fgtech.fgtech.expiringsoon"
+	TypeExpired      = "io.fgtech.fgtech.expired"
+	TypeDeleted      = "io.fgtech.fgtech.deleted"
+)
+
+const (
+	source      = "/fgtech-operator"
+	specVersion = "1.0"
+	contentType = "application/cloudevents+json"
+	queueSize   = 256
+)
+
+// Event is a lifecycle notification about a single Fgtech.
+type Event struct {
+	Type      string
+	Namespace string
+	Name      string
+	Data      map[string]string
+}
+
+// CloudEvent is the structured-mode JSON representation of an Event.
+type CloudEvent struct {
+	SpecVersion     string            `json:"specversion"`
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject"`
+	Time            time.Time         `json:"time"`
+	DataContentType string            `json:"datacontenttype"`
+	Data            map[string]string `json:"data,omitempty"`
+}
+
+// Publisher accepts lifecycle events. Publish must not block the caller.
+type Publisher interface {
+	Publish(ev Event)
+}
+
+// Sink delivers a CloudEvent to a single destination.
+type Sink interface {
+	Send(ctx context.Context, ce CloudEvent) error
+}
+
+// WebhookSink POSTs CloudEvents to an HTTP endpoint, retrying transport
+// errors, 429 and 5xx responses with exponential backoff.
+type WebhookSink struct {
+	URL     string
+	Client  *http.Client
+	Backoff wait.Backoff
+}
+
+// NewWebhookSink returns a sink with a 10s request timeout and five attempts
+// spaced from 500ms up to 8s.
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		Backoff: wait.Backoff{
+			Duration: 500 * time.Millisecond,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    5,
+			Cap:      8 * time.Second,
+		},
+	}
+}
+
+func (s *WebhookSink) Send(ctx context.Context, ce CloudEvent) error {
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return err
+	}
+
+	backoff := s.Backoff
+	if backoff.Steps < 1 {
+		backoff.Steps = 1
+	}
+	var lastErr error
+	for backoff.Steps > 0 {
+		delay := backoff.Step()
+		lastErr = s.post(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+		if _, retryable := lastErr.(retryableError); !retryable || backoff.Steps == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return fmt.Errorf("deliver %s to %s: %w", ce.Type, s.URL, lastErr)
+}
+
+type retryableError struct{ error }
+
+func (s *WebhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return retryableError{err}
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return retryableError{fmt.Errorf("status %d", resp.StatusCode)}
+	default:
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// Dispatcher queues events and fans them out to every sink in the background.
+// It implements manager.Runnable.
+type Dispatcher struct {
+	sinks []Sink
+	log   logr.Logger
+	queue chan CloudEvent
+	now   func() time.Time
+	seq   atomic.Uint64
+}
+
+func NewDispatcher(log logr.Logger, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		sinks: sinks,
+		log:   log,
+		queue: make(chan CloudEvent, queueSize),
+		now:   time.Now,
+	}
+}
+
+// Publish converts the event to a CloudEvent and queues it. Events are dropped
+// when the queue is full so that reconciles never wait on slow sinks.
+func (d *Dispatcher) Publish(ev Event) {
+	if d == nil || len(d.sinks) == 0 {
+		return
+	}
+	now := d.now().UTC()
+	ce := CloudEvent{
+		SpecVersion:     specVersion,
+		ID:              strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatUint(d.seq.Add(1), 36),
+		Source:          source,
+		Type:            ev.Type,
+		Subject:         ev.Namespace + "/" + ev.Name,
+		Time:            now,
+		DataContentType: "application/json",
+		Data:            ev.Data,
+	}
+	select {
+	case d.queue <- ce:
+	default:
+		d.log.Info("notification queue full, dropping event", "type", ev.Type, "subject", ce.Subject)
+	}
+}
+
+// Start implements manager.Runnable.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ce := <-d.queue:
+			for _, sink := range d.sinks {
+				if err := sink.Send(ctx, ce); err != nil {
+					d.log.Error(err, "notification delivery failed", "type", ce.Type, "subject", ce.Subject)
+				}
+			}
+		}
+	}
+}
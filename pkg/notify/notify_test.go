@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestWebhookSinkRetriesUntilSuccess(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan CloudEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != contentType {
+			t.Errorf("Content-Type = %s, want %s", ct, contentType)
+		}
+		var ce CloudEvent
+		if err := json.NewDecoder(r.Body).Decode(&ce); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		received <- ce
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{
+		URL:     srv.URL,
+		Client:  srv.Client(),
+		Backoff: wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 5},
+	}
+	ce := CloudEvent{SpecVersion: specVersion, ID: "1", Source: source, Type: TypeExpired, Subject: "default/demo"}
+	if err := sink.Send(context.Background(), ce); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("calls = %d, want 3", got)
+	}
+	if got := <-received; got.Type != TypeExpired || got.Subject != "default/demo" {
+		t.Fatalf("received %+v", got)
+	}
+}
+
+func TestWebhookSinkDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{URL: srv.URL, Client: srv.Client(), Backoff: wait.Backoff{Duration: time.Millisecond, Steps: 5}}
+	if err := sink.Send(context.Background(), CloudEvent{Type: TypeCreated}); err == nil {
+		t.Fatalf("expected error for 400 response")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("calls = %d, want 1", got)
+	}
+}
+
+func TestDispatcherDeliversCloudEvents(t *testing.T) {
+	received := make(chan CloudEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ce CloudEvent
+		if err := json.NewDecoder(r.Body).Decode(&ce); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		received <- ce
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(logr.Discard(), &WebhookSink{URL: srv.URL, Client: srv.Client()})
+	d.now = func() time.Time { return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC) }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Start(ctx)
+
+	d.Publish(Event{Type: TypeCreated, Namespace: "default", Name: "demo", Data: map[string]string{"image": "nginx"}})
+
+	select {
+	case ce := <-received:
+		if ce.SpecVersion != "1.0" || ce.Source != source || ce.Type != TypeCreated || ce.Subject != "default/demo" {
+			t.Fatalf("unexpected cloud event %+v", ce)
+		}
+		if ce.Data["image"] != "nginx" || ce.ID == "" || !ce.Time.Equal(d.now()) {
+			t.Fatalf("unexpected cloud event payload %+v", ce)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for delivery")
+	}
+}
@@ -0,0 +1,300 @@
+package pod
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// HealthState is the coarse classification of a workload Pod.
+type HealthState string
+
+const (
+	// HealthReady means every container is ready.
+	HealthReady HealthState = "Ready"
+	// HealthStarting covers scheduling, image pulls in progress and readiness probes.
+	HealthStarting HealthState = "Starting"
+	// HealthDegraded means the kubelet keeps retrying without success
+	// (image pull errors, crash loops); recreating the Pod would not help.
+	HealthDegraded HealthState = "Degraded"
+	// HealthFailed means the Pod stopped for good (Failed, Evicted, deadline
+	// exceeded) and must be recreated.
+	HealthFailed HealthState = "Failed"
+)
+
+const (
+	// logTailLines and logTailBytes bound the log captured into status.
+	logTailLines = 20
+	logTailBytes = 2048
+
+	// reasonDeadlineExceeded is the Pod status reason once activeDeadlineSeconds is reached.
+	reasonDeadlineExceeded = "DeadlineExceeded"
+
+	recreateBackoffBase = 10 * time.Second
+	recreateBackoffMax  = 5 * time.Minute
+	// healthyResetAfter is how long a Pod stays Ready before the recreation
+	// backoff starts over.
+	healthyResetAfter = 10 * time.Minute
+)
+
+// Health is the outcome of Classify.
+type Health struct {
+	State     HealthState
+	Reason    string
+	Message   string
+	Container string
+	ExitCode  *int32
+	// Previous is set when the failure belongs to the previous run of the
+	// container, whose log must be read with the previous flag.
+	Previous bool
+}
+
+var degradedWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"CrashLoopBackOff":           true,
+}
+
+// Classify derives the Pod health from its phase and container statuses.
+func Classify(p *corev1.Pod) Health {
+	if p.Status.Phase == corev1.PodFailed || p.Status.Phase == corev1.PodSucceeded {
+		h := Health{State: HealthFailed, Reason: p.Status.Reason, Message: p.Status.Message}
+		for _, cs := range p.Status.ContainerStatuses {
+			if t := cs.State.Terminated; t != nil {
+				h.Container = cs.Name
+				h.ExitCode = int32Ptr(t.ExitCode)
+				if h.Reason == "" {
+					h.Reason = t.Reason
+				}
+				if h.Message == "" {
+					h.Message = fmt.Sprintf("container %s exited with code %d", cs.Name, t.ExitCode)
+				}
+				break
+			}
+		}
+		if h.Reason == "" {
+			h.Reason = string(p.Status.Phase)
+		}
+		if h.Message == "" {
+			h.Message = fmt.Sprintf("pod %s: %s", strings.ToLower(string(p.Status.Phase)), h.Reason)
+		}
+		return h
+	}
+
+	for _, cs := range p.Status.ContainerStatuses {
+		w := cs.State.Waiting
+		if w == nil || !degradedWaitingReasons[w.Reason] {
+			continue
+		}
+		h := Health{State: HealthDegraded, Reason: w.Reason, Message: w.Message, Container: cs.Name}
+		if t := cs.LastTerminationState.Terminated; t != nil && w.Reason == "CrashLoopBackOff" {
+			h.ExitCode = int32Ptr(t.ExitCode)
+			h.Previous = true
+			h.Message = fmt.Sprintf("container %s restarted %d times, last exit %s with code %d", cs.Name, cs.RestartCount, t.Reason, t.ExitCode)
+			if t.Reason == "OOMKilled" {
+				h.Reason = t.Reason
+			}
+		}
+		return h
+	}
+
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			return Health{State: HealthReady, Reason: "Ready"}
+		}
+	}
+	return Health{State: HealthStarting, Reason: "Starting", Message: "waiting for the pod to become ready"}
+}
+
+// RecreateBackoff returns the delay before the next recreation once n failed
+// Pods were already replaced in a row: none for the first one, then 10s
+// doubling up to 5m.
+func RecreateBackoff(n int32) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	d := recreateBackoffBase
+	for i := int32(1); i < n; i++ {
+		d *= 2
+		if d >= recreateBackoffMax {
+			return recreateBackoffMax
+		}
+	}
+	return d
+}
+
+// LogFetcher reads the last lines of a container log.
+type LogFetcher interface {
+	TailLogs(ctx context.Context, namespace, pod, container string, previous bool, lines int64) (string, error)
+}
+
+// ClientsetLogFetcher reads logs through the Kubernetes API.
+type ClientsetLogFetcher struct {
+	Client kubernetes.Interface
+}
+
+func (f ClientsetLogFetcher) TailLogs(ctx context.Context, namespace, pod, container string, previous bool, lines int64) (string, error) {
+	raw, err := f.Client.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+		TailLines: &lines,
+	}).DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// WithLogFetcher captures the tail of the failed container log into status.
+func WithLogFetcher(f LogFetcher) Option {
+	return func(m *Manager) {
+		m.logFetcher = f
+	}
+}
+
+// handleHealth records the Pod health in the Fgtech status and replaces
+// terminally failed Pods with backoff. done is true when Ensure must return.
+func (m *Manager) handleHealth(ctx context.Context, fg *fgtechv1.Fgtech, p *corev1.Pod, log logr.Logger) (res ctrl.Result, done bool, err error) {
+	now := m.clock.Now()
+	h := Classify(p)
+	m.setHealthCondition(fg, h, now)
+
+	switch h.State {
+	case HealthReady:
+		cond := meta.FindStatusCondition(fg.Status.Conditions, fgtechv1.ConditionPodHealthy)
+		if fg.Status.PodRecreations > 0 && cond != nil && now.Sub(cond.LastTransitionTime.Time) >= healthyResetAfter {
+			fg.Status.PodRecreations = 0
+		}
+		return ctrl.Result{}, false, nil
+	case HealthDegraded:
+		m.recordFailure(ctx, fg, p, h, now, log)
+		return ctrl.Result{}, false, nil
+	case HealthFailed:
+		m.recordFailure(ctx, fg, p, h, now, log)
+	default:
+		return ctrl.Result{}, false, nil
+	}
+
+	if h.Reason == reasonDeadlineExceeded {
+		return m.replaceDeadlineExceeded(ctx, fg, p, now, log)
+	}
+
+	if last := fg.Status.LastPodRecreationAt; last != nil {
+		if wait := last.Add(RecreateBackoff(fg.Status.PodRecreations)).Sub(now); wait > 0 {
+			log.Info("Failed pod kept until the recreation backoff elapses", "pod", p.Name, "retryIn", wait.String())
+			return ctrl.Result{RequeueAfter: wait}, true, nil
+		}
+	}
+
+	if err := m.client.Delete(ctx, p); err != nil {
+		return ctrl.Result{}, true, err
+	}
+	fg.Status.PodRecreations++
+	metrics.PodRecreations.WithLabelValues(metrics.RecreationPodFailed).Inc()
+	fg.Status.LastPodRecreationAt = &metav1.Time{Time: now.Truncate(time.Second)}
+	log.Info("Failed pod deleted to be replaced", "pod", p.Name, "reason", h.Reason, "recreations", fg.Status.PodRecreations)
+	m.event(fg, corev1.EventTypeWarning, "PodReplaced", fmt.Sprintf("pod %s failed (%s), replacing it", p.Name, h.Reason))
+	return ctrl.Result{Requeue: true}, true, nil
+}
+
+// replaceDeadlineExceeded replaces a Pod killed by its activeDeadlineSeconds.
+// alignDeadline replaces a Pod as soon as an extension outgrows its deadline,
+// but one extended while the operator was down still dies at the original
+// expiry. The Pod did not crash, so it is replaced at once and does not feed
+// the recreation backoff; status.lastPodFailure and status.lastPodRecreationAt
+// record the replacement.
+func (m *Manager) replaceDeadlineExceeded(ctx context.Context, fg *fgtechv1.Fgtech, p *corev1.Pod, now time.Time, log logr.Logger) (ctrl.Result, bool, error) {
+	if err := m.client.Delete(ctx, p); err != nil {
+		return ctrl.Result{}, true, err
+	}
+	metrics.PodRecreations.WithLabelValues(metrics.RecreationDeadlineExceeded).Inc()
+	fg.Status.LastPodRecreationAt = &metav1.Time{Time: now.Truncate(time.Second)}
+	log.Info("Pod past its deadline deleted to be replaced", "pod", p.Name)
+	m.event(fg, corev1.EventTypeNormal, "PodReplaced", fmt.Sprintf("pod %s reached its activeDeadlineSeconds before the fgtech expiry, replacing it with a pod aligned on the expiry", p.Name))
+	return ctrl.Result{Requeue: true}, true, nil
+}
+
+// setHealthCondition updates ConditionPodHealthy and emits a warning event
+// whenever the Pod turns unhealthy for a new reason.
+func (m *Manager) setHealthCondition(fg *fgtechv1.Fgtech, h Health, now time.Time) {
+	status := metav1.ConditionUnknown
+	switch h.State {
+	case HealthReady:
+		status = metav1.ConditionTrue
+	case HealthDegraded, HealthFailed:
+		status = metav1.ConditionFalse
+	}
+
+	prev := meta.FindStatusCondition(fg.Status.Conditions, fgtechv1.ConditionPodHealthy)
+	changed := prev == nil || prev.Status != status || prev.Reason != h.Reason
+	// Only the first readiness of a lifetime is observed, not the recovery
+	// of a degraded or replaced Pod.
+	firstReady := status == metav1.ConditionTrue && (prev == nil || prev.Status == metav1.ConditionUnknown) && fg.Status.PodRecreations == 0
+	meta.SetStatusCondition(&fg.Status.Conditions, metav1.Condition{
+		Type:               fgtechv1.ConditionPodHealthy,
+		Status:             status,
+		ObservedGeneration: fg.Generation,
+		LastTransitionTime: metav1.NewTime(now.Truncate(time.Second)),
+		Reason:             h.Reason,
+		Message:            h.Message,
+	})
+	if firstReady {
+		metrics.ReadySeconds.Observe(now.Sub(LifetimeStart(fg)).Seconds())
+	}
+	if changed && status == metav1.ConditionFalse {
+		m.event(fg, corev1.EventTypeWarning, h.Reason, h.Message)
+	}
+}
+
+// recordFailure stores the failure in status, with the container log tail,
+// once per Pod and reason.
+func (m *Manager) recordFailure(ctx context.Context, fg *fgtechv1.Fgtech, p *corev1.Pod, h Health, now time.Time, log logr.Logger) {
+	last := fg.Status.LastPodFailure
+	if last != nil && last.PodUID == string(p.UID) && last.Reason == h.Reason {
+		return
+	}
+
+	failure := &fgtechv1.PodFailure{
+		PodUID:     string(p.UID),
+		Container:  h.Container,
+		Reason:     h.Reason,
+		Message:    h.Message,
+		ExitCode:   h.ExitCode,
+		ObservedAt: metav1.Time{Time: now.Truncate(time.Second)},
+	}
+	if m.logFetcher != nil && h.Container != "" && h.ExitCode != nil {
+		tail, err := m.logFetcher.TailLogs(ctx, p.Namespace, p.Name, h.Container, h.Previous, logTailLines)
+		if err != nil {
+			log.Info("unable to read the failed container log", "pod", p.Name, "error", err.Error())
+		} else {
+			failure.LogTail = truncateTail(tail, logTailBytes)
+		}
+	}
+	fg.Status.LastPodFailure = failure
+}
+
+// truncateTail keeps the last max bytes of s, cut at a line boundary when possible.
+func truncateTail(s string, max int) string {
+	s = strings.TrimRight(s, "\n")
+	if len(s) <= max {
+		return s
+	}
+	s = s[len(s)-max:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 && i < len(s)-1 {
+		s = s[i+1:]
+	}
+	return s
+}
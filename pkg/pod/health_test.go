@@ -0,0 +1,304 @@
+package pod
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     corev1.PodStatus
+		wantState  HealthState
+		wantReason string
+		wantExit   *int32
+	}{
+		{
+			name: "ready",
+			status: corev1.PodStatus{Phase: corev1.PodRunning, Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			}},
+			wantState:  HealthReady,
+			wantReason: "Ready",
+		},
+		{
+			name:       "starting",
+			status:     corev1.PodStatus{Phase: corev1.PodPending},
+			wantState:  HealthStarting,
+			wantReason: "Starting",
+		},
+		{
+			name: "image pull error",
+			status: corev1.PodStatus{Phase: corev1.PodPending, ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "fgtech",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "pull access denied"}},
+			}}},
+			wantState:  HealthDegraded,
+			wantReason: "ImagePullBackOff",
+		},
+		{
+			name: "crash loop",
+			status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "fgtech",
+				RestartCount:         4,
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 2}},
+			}}},
+			wantState:  HealthDegraded,
+			wantReason: "CrashLoopBackOff",
+			wantExit:   int32Ptr(2),
+		},
+		{
+			name: "crash loop after OOM kill",
+			status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "fgtech",
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+			}}},
+			wantState:  HealthDegraded,
+			wantReason: "OOMKilled",
+			wantExit:   int32Ptr(137),
+		},
+		{
+			name:       "evicted",
+			status:     corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted", Message: "The node was low on resource: memory."},
+			wantState:  HealthFailed,
+			wantReason: "Evicted",
+		},
+		{
+			name: "container exited",
+			status: corev1.PodStatus{Phase: corev1.PodFailed, ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "fgtech",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}},
+			}}},
+			wantState:  HealthFailed,
+			wantReason: "Error",
+			wantExit:   int32Ptr(1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Classify(&corev1.Pod{Status: tt.status})
+			if h.State != tt.wantState || h.Reason != tt.wantReason {
+				t.Fatalf("Classify = %s/%s, want %s/%s", h.State, h.Reason, tt.wantState, tt.wantReason)
+			}
+			if (h.ExitCode == nil) != (tt.wantExit == nil) || (h.ExitCode != nil && *h.ExitCode != *tt.wantExit) {
+				t.Fatalf("ExitCode = %v, want %v", derefInt32(h.ExitCode), derefInt32(tt.wantExit))
+			}
+		})
+	}
+}
+
+func TestRecreateBackoff(t *testing.T) {
+	tests := []struct {
+		n    int32
+		want time.Duration
+	}{
+		{0, 0},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{4, 80 * time.Second},
+		{10, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := RecreateBackoff(tt.n); got != tt.want {
+			t.Fatalf("RecreateBackoff(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+type stubLogFetcher struct {
+	logs     string
+	previous bool
+	calls    int
+}
+
+func (f *stubLogFetcher) TailLogs(_ context.Context, _, _, _ string, previous bool, _ int64) (string, error) {
+	f.calls++
+	f.previous = previous
+	return f.logs, nil
+}
+
+func TestEnsureRecreatesFailedPodWithBackoff(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute))},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		Status: fgtechv1.FgtechStatus{
+			PodRecreations:      2,
+			LastPodRecreationAt: &metav1.Time{Time: now.Add(-5 * time.Second)},
+		},
+	}
+	failed := buildPod(fg, PodNameFor(fg), int64Ptr(3000), class.Settings{ServiceAccount: "default", Port: 8080})
+	failed.UID = "pod-1"
+	failed.Status = corev1.PodStatus{Phase: corev1.PodFailed, ContainerStatuses: []corev1.ContainerStatus{{
+		Name:  "fgtech",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+	}}}
+
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(failed).Build()
+	clock := clocktesting.NewFakePassiveClock(now)
+	recorder := record.NewFakeRecorder(10)
+	logs := &stubLogFetcher{logs: "line 1\nline 2\nout of memory\n"}
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}), WithClock(clock), WithRecorder(recorder), WithLogFetcher(logs))
+	failedRecreations := testutil.ToFloat64(metrics.PodRecreations.WithLabelValues(metrics.RecreationPodFailed))
+
+	res, err := mgr.Ensure(context.Background(), fg, logr.Discard())
+	if err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if res.RequeueAfter != 15*time.Second {
+		t.Fatalf("RequeueAfter = %s, want the 15s left of the 20s backoff", res.RequeueAfter)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(failed), &corev1.Pod{}); err != nil {
+		t.Fatalf("failed pod must be kept during the backoff: %v", err)
+	}
+
+	cond := meta.FindStatusCondition(fg.Status.Conditions, fgtechv1.ConditionPodHealthy)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "OOMKilled" {
+		t.Fatalf("unexpected PodHealthy condition %+v", cond)
+	}
+	failure := fg.Status.LastPodFailure
+	if failure == nil || failure.Reason != "OOMKilled" || failure.ExitCode == nil || *failure.ExitCode != 137 {
+		t.Fatalf("unexpected last pod failure %+v", failure)
+	}
+	if failure.LogTail != "line 1\nline 2\nout of memory" || logs.previous {
+		t.Fatalf("unexpected log capture %q (previous=%v)", failure.LogTail, logs.previous)
+	}
+	if ev := <-recorder.Events; !strings.HasPrefix(ev, "Warning OOMKilled") {
+		t.Fatalf("unexpected event %q", ev)
+	}
+
+	clock.SetTime(now.Add(15 * time.Second))
+	res, err = mgr.Ensure(context.Background(), fg, logr.Discard())
+	if err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if !res.Requeue {
+		t.Fatalf("expected a requeue once the failed pod is deleted")
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(failed), &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected failed pod to be deleted, got err: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.PodRecreations.WithLabelValues(metrics.RecreationPodFailed)) - failedRecreations; got != 1 {
+		t.Fatalf("failed pod recreations = %v, want 1", got)
+	}
+	if fg.Status.PodRecreations != 3 || !fg.Status.LastPodRecreationAt.Time.Equal(now.Add(15*time.Second)) {
+		t.Fatalf("unexpected recreation bookkeeping %d at %v", fg.Status.PodRecreations, fg.Status.LastPodRecreationAt)
+	}
+	if logs.calls != 1 {
+		t.Fatalf("log captured %d times, want once per failure", logs.calls)
+	}
+}
+
+func TestEnsureResetsBackoffOnceHealthy(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute))},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		Status:     fgtechv1.FgtechStatus{PodRecreations: 3},
+	}
+	ready := buildPod(fg, PodNameFor(fg), int64Ptr(3000), class.Settings{ServiceAccount: "default", Port: 8080})
+	ready.Status = corev1.PodStatus{Phase: corev1.PodRunning, Conditions: []corev1.PodCondition{
+		{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+	}}
+
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ready).Build()
+	clock := clocktesting.NewFakePassiveClock(now)
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}), WithClock(clock))
+
+	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if cond := meta.FindStatusCondition(fg.Status.Conditions, fgtechv1.ConditionPodHealthy); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Fatalf("expected PodHealthy=True, got %+v", cond)
+	}
+	if fg.Status.PodRecreations != 3 {
+		t.Fatalf("backoff must not reset as soon as the pod is ready")
+	}
+
+	clock.SetTime(now.Add(healthyResetAfter))
+	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if fg.Status.PodRecreations != 0 {
+		t.Fatalf("PodRecreations = %d, want 0 after staying healthy", fg.Status.PodRecreations)
+	}
+}
+
+func readyObservations(t *testing.T) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.ReadySeconds.Write(&m); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestEnsureObservesTimeToReady(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		Status: fgtechv1.FgtechStatus{
+			ActiveSince: &metav1.Time{Time: now.Add(-40 * time.Second)},
+			Conditions: []metav1.Condition{{
+				Type: fgtechv1.ConditionPodHealthy, Status: metav1.ConditionUnknown, Reason: "ContainerCreating",
+				LastTransitionTime: metav1.NewTime(now.Add(-30 * time.Second)),
+			}},
+		},
+	}
+	ready := buildPod(fg, PodNameFor(fg), int64Ptr(3000), class.Settings{ServiceAccount: "default", Port: 8080})
+	ready.Status = corev1.PodStatus{Phase: corev1.PodRunning, Conditions: []corev1.PodCondition{
+		{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+	}}
+
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ready).Build()
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}), WithClock(clocktesting.NewFakePassiveClock(now)))
+
+	count, sum := readyObservations(t)
+	for i := 0; i < 2; i++ {
+		if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+			t.Fatalf("Ensure returned error: %v", err)
+		}
+	}
+	gotCount, gotSum := readyObservations(t)
+	if gotCount-count != 1 || gotSum-sum != 40 {
+		t.Fatalf("observed %d samples summing %vs, want one of 40s since the wake-up", gotCount-count, gotSum-sum)
+	}
+}
+
+func TestTruncateTail(t *testing.T) {
+	got := truncateTail("first line\nsecond line\nthird\n", 12)
+	if got != "third" {
+		t.Fatalf("truncateTail = %q, want %q", got, "third")
+	}
+}
+
+func derefInt32(v *int32) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
@@ -0,0 +1,66 @@
+package pod
+
+import (
+	"fmt"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PreDeleteJobNameFor returns the name of the Job running the pre-delete hook.
+func PreDeleteJobNameFor(fg *fgtechv1.Fgtech) string {
+	return fmt.Sprintf("%s-predelete", fg.Name)
+}
+
+// BuildPreDeleteJob renders the Job running spec.preDelete.command with the
+// instance image. The Job runs once and is bounded by deadlineSeconds.
+func BuildPreDeleteJob(fg *fgtechv1.Fgtech, defaultSA string, deadlineSeconds int64) *batchv1.Job {
+	var command []string
+	if fg.Spec.PreDelete != nil {
+		command = append(command, fg.Spec.PreDelete.Command...)
+	}
+	if deadlineSeconds < 1 {
+		deadlineSeconds = 1
+	}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      PreDeleteJobNameFor(fg),
+			Namespace: fg.Namespace,
+			Labels:    ManagedLabels(fg.Name),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          int32Ptr(0),
+			ActiveDeadlineSeconds: int64Ptr(deadlineSeconds),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						LabelApp:       AppName,
+						LabelComponent: ComponentPreDelete,
+					},
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: resolveServiceAccount(fg, defaultSA),
+					RestartPolicy:      corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:            "predelete",
+							Image:           fg.Spec.Image,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Command:         command,
+							Env: []corev1.EnvVar{
+								{Name: "FGTECH_VERSION", Value: fg.Spec.Version},
+								{Name: "FGTECH_NAME", Value: fg.Name},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func int32Ptr(v int32) *int32 {
+	return &v
+}
@@ -0,0 +1,37 @@
+package pod
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// LabelApp is set to AppName on every Pod, Service, Job, Ingress and
+	// ConfigMap the operator creates. The manager cache only holds the Pods,
+	// Services, Jobs and Ingresses carrying it.
+	LabelApp = "app"
+	AppName  = "fgtech"
+	// LabelName names the Fgtech an instance object belongs to.
+	LabelName = "fgtech-name"
+	// LabelComponent tells the objects shared by a namespace apart: the
+	// default backend and the activator Service. It also marks the Pods of
+	// the pre-delete Jobs, which carry no LabelName so that the Service of
+	// the instance never sends them traffic.
+	LabelComponent = "fgtech-component"
+	// ComponentPreDelete is the LabelComponent of the pre-delete Job Pods.
+	ComponentPreDelete = "predelete"
+)
+
+// ManagedLabels returns the labels of the objects the operator creates for
+// the Fgtech named name; an empty name gives the labels shared by all of them.
+func ManagedLabels(name string) map[string]string {
+	l := map[string]string{LabelApp: AppName}
+	if name != "" {
+		l[LabelName] = name
+	}
+	return l
+}
+
+// ManagedSelector selects the objects the operator creates.
+func ManagedSelector() labels.Selector {
+	return labels.SelectorFromSet(ManagedLabels(""))
+}
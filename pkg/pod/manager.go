@@ -2,43 +2,105 @@ package pod
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"time"
 
 	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
+	"github.com/fgtech/ia/cursor/pkg/tracing"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// classHashAnnotation and workloadHashAnnotation record on the Pod the class
+// settings and the command, env, volumes and probes it was built with; the Pod
+// is recreated when they change, for the class only when it sets recreatePods.
+const (
+	classHashAnnotation    = "fgtech.io/class-hash"
+	workloadHashAnnotation = "fgtech.io/workload-hash"
+)
+
+// deadlineSlack absorbs the rounding between the deadline a Pod was created
+// with and the one computed from its start; a longer gap is an extension.
+const deadlineSlack = time.Minute
+
+// defaultCommand keeps instances without spec.command alive.
+var defaultCommand = []string{"sh", "-c", "while true; do echo fgtech running; sleep 30; done"}
+
 // Manager manages Pods associated to Fgtech resources.
 type Manager struct {
-	client            client.Client
-	scheme            *runtime.Scheme
-	defaultTTLSeconds int64
-	defaultSA         string
-	defaultPort       int32
+	client     client.Client
+	scheme     *runtime.Scheme
+	classes    *class.Resolver
+	clock      clock.PassiveClock
+	recorder   record.EventRecorder
+	logFetcher LogFetcher
+}
+
+// Option customises a Manager.
+type Option func(*Manager)
+
+// WithClock sets the clock used to turn the absolute expiry into pod deadlines.
+func WithClock(c clock.PassiveClock) Option {
+	return func(m *Manager) {
+		m.clock = c
+	}
+}
+
+// WithRecorder records events on the Fgtech when its Pod or Service is created
+// or replaced and when the Pod turns unhealthy.
+func WithRecorder(r record.EventRecorder) Option {
+	return func(m *Manager) {
+		m.recorder = r
+	}
 }
 
-func NewManager(c client.Client, scheme *runtime.Scheme, defaultTTLSeconds int64, defaultSA string, defaultPort int32) *Manager {
-	return &Manager{client: c, scheme: scheme, defaultTTLSeconds: defaultTTLSeconds, defaultSA: defaultSA, defaultPort: defaultPort}
+// NewManager builds a Manager resolving TTL, service account, port and
+// placement of each Fgtech through classes.
+func NewManager(c client.Client, scheme *runtime.Scheme, classes *class.Resolver, opts ...Option) *Manager {
+	m := &Manager{client: c, scheme: scheme, classes: classes, clock: clock.RealClock{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // Ensure makes sure the Pod and Service backing the provided Fgtech exist and match its spec.
-func (m *Manager) Ensure(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) (ctrl.Result, error) {
+// It records the Pod health in fg.Status; persisting the status is left to the caller.
+func (m *Manager) Ensure(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) (result ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "Pod.Ensure", tracing.Fgtech(fg)...)
+	defer func() { tracing.EndResult(span, result, err) }()
+	settings, err := m.classes.Resolve(ctx, fg)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	podName := PodNameFor(fg)
 	podKey := types.NamespacedName{Name: podName, Namespace: fg.Namespace}
 
 	var existingPod corev1.Pod
 	if err := m.client.Get(ctx, podKey, &existingPod); err != nil {
 		if apierrors.IsNotFound(err) {
-			newPod := buildPod(fg, podName, m.defaultTTLSeconds, m.defaultSA, m.defaultPort)
+			if !settings.ImageAllowed(fg.Spec.Image) {
+				m.rejectImage(fg, settings, log)
+				return ctrl.Result{}, nil
+			}
+			deadline := ActiveDeadlineFor(fg, settings.TTLSeconds(fg), m.clock.Now())
+			newPod := buildPod(fg, podName, deadline, settings)
 			if err := controllerutil.SetControllerReference(fg, newPod, m.scheme); err != nil {
 				return ctrl.Result{}, err
 			}
@@ -46,26 +108,103 @@ func (m *Manager) Ensure(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logg
 				return ctrl.Result{}, err
 			}
 			log.Info("Pod created for fgtech", "pod", podName)
+			m.event(fg, corev1.EventTypeNormal, "PodCreated", fmt.Sprintf("pod %s created", podName))
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
 	}
 
-	if podNeedsUpdate(&existingPod, fg, m.defaultTTLSeconds, m.defaultSA, m.defaultPort) {
+	if res, done, err := m.handleHealth(ctx, fg, &existingPod, log); done {
+		return res, err
+	}
+
+	if !settings.ImageAllowed(fg.Spec.Image) {
+		if err := m.client.Delete(ctx, &existingPod); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		metrics.PodDeletions.WithLabelValues(metrics.DeletionImageNotAllowed).Inc()
+		m.rejectImage(fg, settings, log)
+		return ctrl.Result{}, nil
+	}
+
+	if reason := podNeedsUpdate(&existingPod, fg, settings); reason != "" {
 		if err := m.client.Delete(ctx, &existingPod); err != nil {
 			return ctrl.Result{}, err
 		}
-		log.Info("Pod deleted to refresh configuration", "pod", existingPod.Name)
+		metrics.PodRecreations.WithLabelValues(reason).Inc()
+		if reason == updateRestart {
+			restartedAt := metav1.NewTime(m.clock.Now())
+			fg.Status.RestartedAt = &restartedAt
+			log.Info("Pod deleted to restart", "pod", existingPod.Name, "restartedAt", fg.Annotations[fgtechv1.AnnotationRestartedAt])
+			m.event(fg, corev1.EventTypeNormal, "PodRestarted", fmt.Sprintf("pod %s deleted to be recreated, restart requested at %s", existingPod.Name, fg.Annotations[fgtechv1.AnnotationRestartedAt]))
+			return ctrl.Result{Requeue: true}, nil
+		}
+		log.Info("Pod deleted to refresh configuration", "pod", existingPod.Name, "reason", reason)
+		m.event(fg, corev1.EventTypeNormal, "PodRecreated", fmt.Sprintf("pod %s deleted to be recreated, %s changed", existingPod.Name, reason))
 		return ctrl.Result{Requeue: true}, nil
 	}
 
-	if err := m.ensureService(ctx, fg, log); err != nil {
+	if replaced, err := m.alignDeadline(ctx, &existingPod, fg, settings.TTLSeconds(fg), log); replaced || err != nil {
+		return ctrl.Result{Requeue: replaced}, err
+	}
+
+	if err := m.ensureService(ctx, fg, settings.Port, log); err != nil {
 		return ctrl.Result{}, err
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// rejectImage marks the Pod unhealthy when the class does not allow the image;
+// no Pod runs until spec.image or the class changes.
+func (m *Manager) rejectImage(fg *fgtechv1.Fgtech, settings class.Settings, log logr.Logger) {
+	msg := fmt.Sprintf("image %s is not allowed by class %s", fg.Spec.Image, settings.ClassName)
+	log.Info("Pod not created, image not allowed", "image", fg.Spec.Image, "class", settings.ClassName)
+	m.setHealthCondition(fg, Health{State: HealthFailed, Reason: "ImageNotAllowed", Message: msg}, m.clock.Now())
+}
+
+// alignDeadline keeps the deadline of a running Pod on the Fgtech expiry. The
+// API server only lets the deadline be set or decreased: it is patched when the
+// expiry moved earlier, and the Pod is replaced at once, with a deadline on the
+// new expiry, when an extension moved it later by more than deadlineSlack.
+// status.lastPodRecreationAt records the replacement, which does not feed the
+// recreation backoff.
+func (m *Manager) alignDeadline(ctx context.Context, p *corev1.Pod, fg *fgtechv1.Fgtech, ttlSeconds int64, log logr.Logger) (bool, error) {
+	start := p.CreationTimestamp.Time
+	if p.Status.StartTime != nil {
+		start = p.Status.StartTime.Time
+	}
+	if start.IsZero() {
+		return false, nil
+	}
+	expected := ActiveDeadlineFor(fg, ttlSeconds, start)
+	if expected == nil {
+		return false, nil
+	}
+	current := p.Spec.ActiveDeadlineSeconds
+	if current != nil && *expected-*current > int64(deadlineSlack/time.Second) {
+		if err := m.client.Delete(ctx, p); err != nil {
+			return false, err
+		}
+		metrics.PodRecreations.WithLabelValues(metrics.RecreationDeadlineExtended).Inc()
+		fg.Status.LastPodRecreationAt = &metav1.Time{Time: m.clock.Now().Truncate(time.Second)}
+		log.Info("Pod deleted to extend its deadline", "pod", p.Name, "activeDeadlineSeconds", *current, "expected", *expected)
+		m.event(fg, corev1.EventTypeNormal, "PodReplaced", fmt.Sprintf("pod %s deleted to be recreated, its activeDeadlineSeconds cannot follow the extended expiry", p.Name))
+		return true, nil
+	}
+	if current != nil && *current <= *expected {
+		return false, nil
+	}
+
+	patch := client.MergeFrom(p.DeepCopy())
+	p.Spec.ActiveDeadlineSeconds = expected
+	if err := m.client.Patch(ctx, p, patch); err != nil {
+		return false, err
+	}
+	log.Info("Pod deadline aligned with fgtech expiry", "pod", p.Name, "activeDeadlineSeconds", *expected)
+	return false, nil
+}
+
 func podNameFor(fg *fgtechv1.Fgtech) string {
 	return fmt.Sprintf("%s-pod", fg.Name)
 }
@@ -75,22 +214,25 @@ func PodNameFor(fg *fgtechv1.Fgtech) string {
 	return podNameFor(fg)
 }
 
-func buildPod(fg *fgtechv1.Fgtech, podName string, defaultTTLSeconds int64, defaultSA string, defaultPort int32) *corev1.Pod {
-	activeDeadline := ttlPointer(fg, defaultTTLSeconds)
-	return &corev1.Pod{
+func buildPod(fg *fgtechv1.Fgtech, podName string, activeDeadline *int64, settings class.Settings) *corev1.Pod {
+	p := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      podName,
 			Namespace: fg.Namespace,
 			Labels: map[string]string{
-				"app":            "fgtech",
-				"fgtech-name":    fg.Name,
+				LabelApp:         AppName,
+				LabelName:        fg.Name,
 				"fgtech-version": fg.Spec.Version,
 			},
 		},
 		Spec: corev1.PodSpec{
 			ActiveDeadlineSeconds: activeDeadline,
-			ServiceAccountName:    resolveServiceAccount(fg, defaultSA),
-			Volumes: []corev1.Volume{
+			ServiceAccountName:    resolveServiceAccount(fg, settings.ServiceAccount),
+			NodeSelector:          settings.NodeSelector,
+			Tolerations:           settings.Tolerations,
+			PriorityClassName:     settings.PriorityClassName,
+			SecurityContext:       settings.PodSecurityContext,
+			Volumes: append([]corev1.Volume{
 				{
 					Name: "kube-config",
 					VolumeSource: corev1.VolumeSource{
@@ -99,50 +241,142 @@ func buildPod(fg *fgtechv1.Fgtech, podName string, defaultTTLSeconds int64, defa
 						},
 					},
 				},
-			},
+			}, fg.Spec.Volumes...),
 			Containers: []corev1.Container{
 				{
 					Name:            "fgtech",
 					Image:           fg.Spec.Image,
 					ImagePullPolicy: corev1.PullIfNotPresent,
-					Env: []corev1.EnvVar{
+					Env: append([]corev1.EnvVar{
 						{
 							Name:  "FGTECH_VERSION",
 							Value: fg.Spec.Version,
 						},
-					},
-					Command: []string{"sh", "-c", "while true; do echo fgtech running; sleep 30; done"},
+					}, fg.Spec.Env...),
+					Command: commandFor(fg),
 					Ports: []corev1.ContainerPort{
 						{
 							Name:          "http",
-							ContainerPort: defaultPort,
+							ContainerPort: settings.Port,
 						},
 					},
-					VolumeMounts: []corev1.VolumeMount{
+					Resources:       settings.Resources,
+					SecurityContext: settings.SecurityContext,
+					ReadinessProbe:  fg.Spec.ReadinessProbe,
+					LivenessProbe:   fg.Spec.LivenessProbe,
+					VolumeMounts: append([]corev1.VolumeMount{
 						{
 							Name:      "kube-config",
 							MountPath: "/home/clovers/.kube",
 						},
-					},
+					}, fg.Spec.VolumeMounts...),
 				},
 			},
 			RestartPolicy: corev1.RestartPolicyAlways,
 		},
 	}
+	if hash := classHash(settings); hash != "" {
+		setAnnotation(p, classHashAnnotation, hash)
+	}
+	if hash := workloadHash(fg); hash != "" {
+		setAnnotation(p, workloadHashAnnotation, hash)
+	}
+	if restartedAt := fg.Annotations[fgtechv1.AnnotationRestartedAt]; restartedAt != "" {
+		setAnnotation(p, fgtechv1.AnnotationRestartedAt, restartedAt)
+	}
+	return p
 }
 
-func podNeedsUpdate(pod *corev1.Pod, fg *fgtechv1.Fgtech, defaultTTLSeconds int64, defaultSA string, defaultPort int32) bool {
+func setAnnotation(p *corev1.Pod, key, value string) {
+	if p.Annotations == nil {
+		p.Annotations = map[string]string{}
+	}
+	p.Annotations[key] = value
+}
+
+func commandFor(fg *fgtechv1.Fgtech) []string {
+	if len(fg.Spec.Command) > 0 {
+		return fg.Spec.Command
+	}
+	return defaultCommand
+}
+
+// workloadHash fingerprints the command, env, volumes and probes of the spec.
+// It is empty when none is set.
+func workloadHash(fg *fgtechv1.Fgtech) string {
+	w := fgtechv1.WorkloadTemplate{
+		Command:        fg.Spec.Command,
+		Env:            fg.Spec.Env,
+		Volumes:        fg.Spec.Volumes,
+		VolumeMounts:   fg.Spec.VolumeMounts,
+		ReadinessProbe: fg.Spec.ReadinessProbe,
+		LivenessProbe:  fg.Spec.LivenessProbe,
+	}
+	if equality.Semantic.DeepEqual(w, fgtechv1.WorkloadTemplate{}) {
+		return ""
+	}
+	return hashJSON(w)
+}
+
+// classHash fingerprints the class settings copied into the Pod spec. It is
+// empty when no class applies, so Pods built from the operator defaults alone
+// carry no annotation. RecreatePods is left out: toggling it changes no Pod.
+func classHash(settings class.Settings) string {
+	if settings.ClassName == "" {
+		return ""
+	}
+	return hashJSON(struct {
+		Class              string
+		Resources          corev1.ResourceRequirements
+		NodeSelector       map[string]string
+		Tolerations        []corev1.Toleration
+		PriorityClassName  string
+		PodSecurityContext *corev1.PodSecurityContext
+		SecurityContext    *corev1.SecurityContext
+	}{settings.ClassName, settings.Resources, settings.NodeSelector, settings.Tolerations,
+		settings.PriorityClassName, settings.PodSecurityContext, settings.SecurityContext})
+}
+
+func hashJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Reasons returned by podNeedsUpdate, used as the reason label of
+// fgtech_pod_recreations_total.
+const (
+	updateContainers     = "containers"
+	updateImage          = "image"
+	updatePort           = "port"
+	updateVersion        = "version"
+	updateServiceAccount = "serviceAccount"
+	updateClass          = "class"
+	updateWorkload       = "workload"
+	updateRestart        = "restart"
+)
+
+// podNeedsUpdate returns why the Pod differs from the desired one, or "" when
+// it is up to date.
+func podNeedsUpdate(pod *corev1.Pod, fg *fgtechv1.Fgtech, settings class.Settings) string {
 	if len(pod.Spec.Containers) == 0 {
-		return true
+		return updateContainers
+	}
+
+	// Checked first so that a restart requested with a spec change is
+	// recorded. Removing the annotation leaves the Pod alone.
+	if restartedAt := fg.Annotations[fgtechv1.AnnotationRestartedAt]; restartedAt != "" && pod.Annotations[fgtechv1.AnnotationRestartedAt] != restartedAt {
+		return updateRestart
 	}
 
 	container := pod.Spec.Containers[0]
 	if container.Image != fg.Spec.Image {
-		return true
+		return updateImage
 	}
 
-	if len(container.Ports) != 1 || container.Ports[0].ContainerPort != defaultPort {
-		return true
+	if len(container.Ports) != 1 || container.Ports[0].ContainerPort != settings.Port {
+		return updatePort
 	}
 
 	hasVersionEnv := false
@@ -150,40 +384,45 @@ func podNeedsUpdate(pod *corev1.Pod, fg *fgtechv1.Fgtech, defaultTTLSeconds int6
 		if env.Name == "FGTECH_VERSION" {
 			hasVersionEnv = true
 			if env.Value != fg.Spec.Version {
-				return true
+				return updateVersion
 			}
 		}
 	}
 	if !hasVersionEnv {
-		return true
+		return updateVersion
 	}
 
 	if pod.Labels["fgtech-version"] != fg.Spec.Version {
-		return true
+		return updateVersion
 	}
 
-	expectedTTL := ttlPointer(fg, defaultTTLSeconds)
-	if (pod.Spec.ActiveDeadlineSeconds == nil) != (expectedTTL == nil) {
-		return true
+	if pod.Spec.ServiceAccountName != resolveServiceAccount(fg, settings.ServiceAccount) {
+		return updateServiceAccount
 	}
-	if expectedTTL != nil && pod.Spec.ActiveDeadlineSeconds != nil && *pod.Spec.ActiveDeadlineSeconds != *expectedTTL {
-		return true
+
+	// Class changes reach running Pods only when the class opts in. A Pod
+	// without hash was built before the class applied, or before the
+	// annotation existed: it is not outdated.
+	if hash := pod.Annotations[classHashAnnotation]; settings.RecreatePods && hash != "" && hash != classHash(settings) {
+		return updateClass
 	}
 
-	if pod.Spec.ServiceAccountName != resolveServiceAccount(fg, defaultSA) {
-		return true
+	if pod.Annotations[workloadHashAnnotation] != workloadHash(fg) {
+		return updateWorkload
 	}
 
-	return false
+	return ""
 }
 
-func (m *Manager) ensureService(ctx context.Context, fg *fgtechv1.Fgtech, log logr.Logger) error {
+func (m *Manager) ensureService(ctx context.Context, fg *fgtechv1.Fgtech, port int32, log logr.Logger) (err error) {
+	ctx, span := tracing.Start(ctx, "Pod.ensureService", tracing.Fgtech(fg)...)
+	defer func() { tracing.End(span, "", err) }()
 	serviceName := ServiceNameFor(fg)
 	serviceKey := types.NamespacedName{Name: serviceName, Namespace: fg.Namespace}
 	var svc corev1.Service
 	if err := m.client.Get(ctx, serviceKey, &svc); err != nil {
 		if apierrors.IsNotFound(err) {
-			newSvc := buildService(fg, serviceName, m.defaultPort)
+			newSvc := buildService(fg, serviceName, port)
 			if err := controllerutil.SetControllerReference(fg, newSvc, m.scheme); err != nil {
 				return err
 			}
@@ -191,23 +430,32 @@ func (m *Manager) ensureService(ctx context.Context, fg *fgtechv1.Fgtech, log lo
 				return err
 			}
 			log.Info("Service created for fgtech", "service", serviceName)
+			m.event(fg, corev1.EventTypeNormal, "ServiceCreated", fmt.Sprintf("service %s created", serviceName))
 			return nil
 		}
 		return err
 	}
 
-	if serviceNeedsUpdate(&svc, fg, m.defaultPort) {
+	if serviceNeedsUpdate(&svc, fg, port) {
 		updatedSvc := svc.DeepCopy()
-		updateServiceFields(updatedSvc, fg, m.defaultPort)
+		updateServiceFields(updatedSvc, fg, port)
 		if err := m.client.Update(ctx, updatedSvc); err != nil {
 			return err
 		}
 		log.Info("Service updated for fgtech", "service", serviceName)
+		m.event(fg, corev1.EventTypeNormal, "ServiceUpdated", fmt.Sprintf("service %s updated", serviceName))
 	}
 
 	return nil
 }
 
+// event records an event on fg when a recorder is set.
+func (m *Manager) event(fg *fgtechv1.Fgtech, eventType, reason, message string) {
+	if m.recorder != nil {
+		m.recorder.Event(fg, eventType, reason, message)
+	}
+}
+
 func ServiceNameFor(fg *fgtechv1.Fgtech) string {
 	return fmt.Sprintf("%s-svc", fg.Name)
 }
@@ -217,10 +465,7 @@ func buildService(fg *fgtechv1.Fgtech, serviceName string, defaultPort int32) *c
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      serviceName,
 			Namespace: fg.Namespace,
-			Labels: map[string]string{
-				"app":         "fgtech",
-				"fgtech-name": fg.Name,
-			},
+			Labels:    ManagedLabels(fg.Name),
 		},
 	}
 	updateServiceFields(svc, fg, defaultPort)
@@ -229,7 +474,7 @@ func buildService(fg *fgtechv1.Fgtech, serviceName string, defaultPort int32) *c
 
 func updateServiceFields(svc *corev1.Service, fg *fgtechv1.Fgtech, defaultPort int32) {
 	svc.Spec.Selector = map[string]string{
-		"fgtech-name": fg.Name,
+		LabelName: fg.Name,
 	}
 	svc.Spec.Ports = []corev1.ServicePort{
 		{
@@ -243,7 +488,7 @@ func updateServiceFields(svc *corev1.Service, fg *fgtechv1.Fgtech, defaultPort i
 
 func serviceNeedsUpdate(svc *corev1.Service, fg *fgtechv1.Fgtech, defaultPort int32) bool {
 	expectedSelector := map[string]string{
-		"fgtech-name": fg.Name,
+		LabelName: fg.Name,
 	}
 	if !mapsEqual(svc.Spec.Selector, expectedSelector) {
 		return true
@@ -263,25 +508,53 @@ func serviceNeedsUpdate(svc *corev1.Service, fg *fgtechv1.Fgtech, defaultPort in
 	return false
 }
 
-func ttlPointer(fg *fgtechv1.Fgtech, defaultTTLSeconds int64) *int64 {
-	ttl := ResolveTTLSeconds(fg, defaultTTLSeconds)
-	if ttl <= 0 {
+// ActiveDeadlineFor returns the Pod activeDeadlineSeconds for a Pod started at
+// start: the time left until the Fgtech expiry, rounded up and at least one
+// second. It is nil without TTL and in idle mode, where the expiry keeps moving.
+// A Fgtech not persisted yet gets its full TTL. ttlSeconds is the TTL resolved
+// for fg, see class.Settings.TTLSeconds.
+func ActiveDeadlineFor(fg *fgtechv1.Fgtech, ttlSeconds int64, start time.Time) *int64 {
+	if fg.Spec.Idle != nil && fg.Spec.Idle.TimeoutSeconds > 0 {
 		return nil
 	}
-	return int64Ptr(ttl)
+	expiry, ok := ExpiryFor(fg, ttlSeconds)
+	if !ok {
+		return nil
+	}
+	if fg.Status.ExpiresAt == nil && LifetimeStart(fg).IsZero() {
+		return int64Ptr(ttlSeconds)
+	}
+	remaining := expiry.Sub(start)
+	seconds := int64(remaining / time.Second)
+	if remaining%time.Second > 0 {
+		seconds++
+	}
+	if seconds < 1 {
+		seconds = 1
+	}
+	return int64Ptr(seconds)
 }
 
-// ResolveTTLSeconds returns the effective TTL in seconds for a Fgtech,
-// preferring the spec override when positive, otherwise the provided default.
-// Returns 0 when no TTL should be applied.
-func ResolveTTLSeconds(fg *fgtechv1.Fgtech, defaultTTLSeconds int64) int64 {
-	if fg.Spec.TTLSeconds != nil && *fg.Spec.TTLSeconds > 0 {
-		return *fg.Spec.TTLSeconds
+// ExpiryFor returns the instant at which the Fgtech expires. status.expiresAt
+// wins when the reconciler has recorded it; otherwise the expiry is derived from
+// the lifetime start and the resolved TTL. The boolean is false when no TTL applies.
+func ExpiryFor(fg *fgtechv1.Fgtech, ttlSeconds int64) (time.Time, bool) {
+	if fg.Status.ExpiresAt != nil {
+		return fg.Status.ExpiresAt.Time, true
+	}
+	if ttlSeconds <= 0 {
+		return time.Time{}, false
 	}
-	if defaultTTLSeconds > 0 {
-		return defaultTTLSeconds
+	return LifetimeStart(fg).Add(time.Duration(ttlSeconds) * time.Second), true
+}
+
+// LifetimeStart returns the instant the current lifetime started: the last
+// wake-up recorded in status, or the creation time.
+func LifetimeStart(fg *fgtechv1.Fgtech) time.Time {
+	if fg.Status.ActiveSince != nil {
+		return fg.Status.ActiveSince.Time
 	}
-	return 0
+	return fg.CreationTimestamp.Time
 }
 
 func resolveServiceAccount(fg *fgtechv1.Fgtech, defaultSA string) string {
@@ -2,14 +2,27 @@ package pod
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/fgtech/ia/cursor/pkg/class"
+	"github.com/fgtech/ia/cursor/pkg/metrics"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/yaml"
@@ -59,7 +72,7 @@ func TestEnsureCreatesExpectedPod(t *testing.T) {
 
 			scheme := newPodScheme(t)
 			cl := fake.NewClientBuilder().WithScheme(scheme).Build()
-			mgr := NewManager(cl, scheme, tt.defaultTTLSeconds, tt.defaultSA, tt.defaultPort)
+			mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: tt.defaultTTLSeconds, ServiceAccount: tt.defaultSA, Port: tt.defaultPort}))
 
 			if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
 				t.Fatalf("Ensure returned error: %v", err)
@@ -125,7 +138,7 @@ func TestPodManifestMatchesExpectedYAML(t *testing.T) {
 	defaultPort := int32(8182)
 	scheme := newPodScheme(t)
 	cl := fake.NewClientBuilder().WithScheme(scheme).Build()
-	mgr := NewManager(cl, scheme, 3600, "default-sa", defaultPort)
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default-sa", Port: defaultPort}))
 
 	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
 		t.Fatalf("Ensure returned error: %v", err)
@@ -209,7 +222,7 @@ func TestPodIncludesKubeConfigVolumeAndMount(t *testing.T) {
 
 	scheme := newPodScheme(t)
 	cl := fake.NewClientBuilder().WithScheme(scheme).Build()
-	mgr := NewManager(cl, scheme, 3600, "default", 8080)
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}))
 
 	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
 		t.Fatalf("Ensure returned error: %v", err)
@@ -248,7 +261,7 @@ func TestServiceManifestMatchesExpectedYAML(t *testing.T) {
 	defaultPort := int32(8182)
 	scheme := newPodScheme(t)
 	cl := fake.NewClientBuilder().WithScheme(scheme).Build()
-	mgr := NewManager(cl, scheme, 3600, "test-sa", defaultPort)
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "test-sa", Port: defaultPort}))
 
 	// First call creates the Pod, second ensures the Service.
 	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
@@ -303,3 +316,476 @@ status:
 		t.Fatalf("generated service yaml differs.\nGot:\n%s\nWant:\n%s", string(actualYAML), expectedYAML)
 	}
 }
+
+func TestPreDeleteJobPodsAreNotServed(t *testing.T) {
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "test"},
+		Spec: fgtechv1.FgtechSpec{
+			Image:     "nginx:latest",
+			PreDelete: &fgtechv1.PreDeleteHook{Command: []string{"/bin/cleanup"}},
+		},
+	}
+	svc := &corev1.Service{}
+	updateServiceFields(svc, fg, 8080)
+
+	job := BuildPreDeleteJob(fg, "test-sa", 60)
+	podLabels := labels.Set(job.Spec.Template.Labels)
+	if labels.SelectorFromSet(svc.Spec.Selector).Matches(podLabels) {
+		t.Fatalf("service selector %v matches the pre-delete pod labels %v", svc.Spec.Selector, podLabels)
+	}
+	if podLabels[LabelComponent] != ComponentPreDelete {
+		t.Fatalf("pre-delete pod labels = %v, want %s=%s", podLabels, LabelComponent, ComponentPreDelete)
+	}
+}
+
+func TestEnsureReplacesPodPastItsDeadline(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		Status: fgtechv1.FgtechStatus{
+			// Extended by an hour; a replacement a minute ago does not delay this one.
+			ExpiresAt:           &metav1.Time{Time: now.Add(time.Hour)},
+			LastPodRecreationAt: &metav1.Time{Time: now.Add(-time.Minute)},
+			PodRecreations:      2,
+		},
+	}
+	// Extended while the operator was down: killed at the original expiry.
+	failed := buildPod(fg, PodNameFor(fg), int64Ptr(3600), class.Settings{ServiceAccount: "default", Port: 8080})
+	failed.Status = corev1.PodStatus{Phase: corev1.PodFailed, Reason: "DeadlineExceeded"}
+
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(failed).Build()
+	recorder := record.NewFakeRecorder(5)
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}), WithClock(clocktesting.NewFakePassiveClock(now)), WithRecorder(recorder))
+
+	res, err := mgr.Ensure(context.Background(), fg, logr.Discard())
+	if err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if !res.Requeue {
+		t.Fatalf("expected a requeue after deleting the failed pod")
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(failed), &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected failed pod to be deleted, got err: %v", err)
+	}
+	replaced := false
+	for len(recorder.Events) > 0 {
+		if ev := <-recorder.Events; strings.HasPrefix(ev, "Normal PodReplaced") && strings.Contains(ev, "activeDeadlineSeconds") {
+			replaced = true
+		}
+	}
+	if !replaced {
+		t.Fatalf("expected a PodReplaced event")
+	}
+	if fg.Status.PodRecreations != 2 {
+		t.Fatalf("PodRecreations = %d, a deadline is not a crash", fg.Status.PodRecreations)
+	}
+	if last := fg.Status.LastPodRecreationAt; last == nil || !last.Time.Equal(now) {
+		t.Fatalf("LastPodRecreationAt = %v, want %s", last, now)
+	}
+	if f := fg.Status.LastPodFailure; f == nil || f.Reason != "DeadlineExceeded" {
+		t.Fatalf("LastPodFailure = %+v, want DeadlineExceeded", f)
+	}
+
+	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	var pod corev1.Pod
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(failed), &pod); err != nil {
+		t.Fatalf("expected pod to be recreated: %v", err)
+	}
+	if pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds != 3600 {
+		t.Fatalf("ActiveDeadlineSeconds = %v, want the 3600s left", derefOrNil(pod.Spec.ActiveDeadlineSeconds))
+	}
+}
+
+func TestEnsureShortensDeadlineOfRunningPod(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		Status:     fgtechv1.FgtechStatus{ExpiresAt: &metav1.Time{Time: now.Add(15 * time.Minute)}},
+	}
+	running := buildPod(fg, PodNameFor(fg), int64Ptr(7200), class.Settings{ServiceAccount: "default", Port: 8080})
+	running.Status = corev1.PodStatus{Phase: corev1.PodRunning, StartTime: &metav1.Time{Time: now.Add(-45 * time.Minute)}}
+
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(running).Build()
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}), WithClock(clocktesting.NewFakePassiveClock(now)))
+
+	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	var pod corev1.Pod
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(running), &pod); err != nil {
+		t.Fatalf("expected pod to be kept: %v", err)
+	}
+	if pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds != 3600 {
+		t.Fatalf("ActiveDeadlineSeconds = %v, want 3600 (45m run + 15m left)", derefOrNil(pod.Spec.ActiveDeadlineSeconds))
+	}
+}
+
+func TestEnsureReplacesPodAfterExtension(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", CreationTimestamp: metav1.NewTime(now.Add(-45 * time.Minute))},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+		Status: fgtechv1.FgtechStatus{
+			// One hour TTL extended by another hour.
+			ExpiresAt:      &metav1.Time{Time: now.Add(75 * time.Minute)},
+			PodRecreations: 2,
+		},
+	}
+	running := buildPod(fg, PodNameFor(fg), int64Ptr(3600), class.Settings{ServiceAccount: "default", Port: 8080})
+	running.Status = corev1.PodStatus{Phase: corev1.PodRunning, StartTime: &metav1.Time{Time: now.Add(-45 * time.Minute)}}
+
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(running).Build()
+	recorder := record.NewFakeRecorder(5)
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}), WithClock(clocktesting.NewFakePassiveClock(now)), WithRecorder(recorder))
+
+	res, err := mgr.Ensure(context.Background(), fg, logr.Discard())
+	if err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if !res.Requeue {
+		t.Fatalf("expected a requeue after deleting the pod")
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(running), &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the pod to be deleted before its old deadline, got err: %v", err)
+	}
+	replaced := false
+	for len(recorder.Events) > 0 {
+		if ev := <-recorder.Events; strings.HasPrefix(ev, "Normal PodReplaced") && strings.Contains(ev, "extended expiry") {
+			replaced = true
+		}
+	}
+	if !replaced {
+		t.Fatalf("expected a PodReplaced event")
+	}
+	if fg.Status.PodRecreations != 2 {
+		t.Fatalf("PodRecreations = %d, an extension is not a crash", fg.Status.PodRecreations)
+	}
+	if last := fg.Status.LastPodRecreationAt; last == nil || !last.Time.Equal(now) {
+		t.Fatalf("LastPodRecreationAt = %v, want %s", last, now)
+	}
+
+	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	var pod corev1.Pod
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(running), &pod); err != nil {
+		t.Fatalf("expected pod to be recreated: %v", err)
+	}
+	if pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds != 4500 {
+		t.Fatalf("ActiveDeadlineSeconds = %v, want the 4500s left", derefOrNil(pod.Spec.ActiveDeadlineSeconds))
+	}
+}
+
+func TestEnsureDeadlineFollowsAbsoluteExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := metav1.NewTime(now.Add(10 * time.Minute))
+	tests := []struct {
+		name string
+		fg   fgtechv1.Fgtech
+		want *int64
+	}{
+		{
+			name: "remaining time of the current lifetime",
+			fg: fgtechv1.Fgtech{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-50 * time.Minute))},
+				Status:     fgtechv1.FgtechStatus{ExpiresAt: &expiresAt},
+			},
+			want: int64Ptr(600),
+		},
+		{
+			name: "derived from creation when status is empty",
+			fg: fgtechv1.Fgtech{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-30*time.Minute - 500*time.Millisecond))},
+			},
+			want: int64Ptr(1800),
+		},
+		{
+			name: "at least one second once expired",
+			fg: fgtechv1.Fgtech{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour))},
+			},
+			want: int64Ptr(1),
+		},
+		{
+			name: "no deadline in idle mode",
+			fg: fgtechv1.Fgtech{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now)},
+				Spec:       fgtechv1.FgtechSpec{Idle: &fgtechv1.IdleSpec{TimeoutSeconds: 900}},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fg := tt.fg.DeepCopy()
+			fg.Name, fg.Namespace = "demo", "default"
+			fg.Spec.Version, fg.Spec.Image = "1.0.0", "nginx:latest"
+
+			scheme := newPodScheme(t)
+			cl := fake.NewClientBuilder().WithScheme(scheme).Build()
+			mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}), WithClock(clocktesting.NewFakePassiveClock(now)))
+			if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+				t.Fatalf("Ensure returned error: %v", err)
+			}
+
+			var pod corev1.Pod
+			if err := cl.Get(context.Background(), client.ObjectKey{Namespace: fg.Namespace, Name: PodNameFor(fg)}, &pod); err != nil {
+				t.Fatalf("expected pod to be created: %v", err)
+			}
+			got := pod.Spec.ActiveDeadlineSeconds
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Fatalf("ActiveDeadlineSeconds = %v, want %v", derefOrNil(got), derefOrNil(tt.want))
+			}
+		})
+	}
+}
+
+func TestEnsureAppliesClassPlacement(t *testing.T) {
+	gpu := &fgtechv1.FgtechClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+		Spec: fgtechv1.FgtechClassSpec{
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+			},
+			NodeSelector:      map[string]string{"accelerator": "gpu"},
+			Tolerations:       []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+			PriorityClassName: "interactive",
+			AllowedRegistries: []string{"ghcr.io/fgtech"},
+		},
+	}
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "ghcr.io/fgtech/app:1", ClassName: "gpu"},
+	}
+
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(gpu).Build()
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}))
+
+	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	var pod corev1.Pod
+	key := client.ObjectKey{Namespace: fg.Namespace, Name: PodNameFor(fg)}
+	if err := cl.Get(context.Background(), key, &pod); err != nil {
+		t.Fatalf("expected pod to be created: %v", err)
+	}
+	if pod.Spec.NodeSelector["accelerator"] != "gpu" || len(pod.Spec.Tolerations) != 1 || pod.Spec.PriorityClassName != "interactive" {
+		t.Fatalf("class placement not applied: %+v", pod.Spec)
+	}
+	if got := pod.Spec.Containers[0].Resources.Limits.Memory().String(); got != "2Gi" {
+		t.Fatalf("memory limit = %s, want 2Gi", got)
+	}
+	if pod.Annotations[classHashAnnotation] == "" {
+		t.Fatalf("expected the class hash annotation")
+	}
+
+	// A class change leaves the running Pod alone...
+	classRecreations := testutil.ToFloat64(metrics.PodRecreations.WithLabelValues(updateClass))
+	gpu.Spec.PriorityClassName = "batch"
+	if err := cl.Update(context.Background(), gpu); err != nil {
+		t.Fatalf("update class: %v", err)
+	}
+	if res, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil || res.Requeue {
+		t.Fatalf("Ensure = %+v, %v; want the pod kept", res, err)
+	}
+	if err := cl.Get(context.Background(), key, &corev1.Pod{}); err != nil {
+		t.Fatalf("expected the running pod to be kept: %v", err)
+	}
+
+	// ...unless the class rolls its changes out.
+	gpu.Spec.RecreatePods = true
+	if err := cl.Update(context.Background(), gpu); err != nil {
+		t.Fatalf("update class: %v", err)
+	}
+	res, err := mgr.Ensure(context.Background(), fg, logr.Discard())
+	if err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if !res.Requeue {
+		t.Fatalf("expected the pod to be deleted and the fgtech requeued")
+	}
+	if err := cl.Get(context.Background(), key, &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected outdated pod to be deleted, got err: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.PodRecreations.WithLabelValues(updateClass)) - classRecreations; got != 1 {
+		t.Fatalf("class recreations = %v, want 1", got)
+	}
+
+	// Images outside the allowed registries get no Pod: the running one is
+	// deleted and not replaced.
+	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if err := cl.Get(context.Background(), key, &corev1.Pod{}); err != nil {
+		t.Fatalf("expected the pod to be recreated: %v", err)
+	}
+	deletions := testutil.ToFloat64(metrics.PodDeletions.WithLabelValues(metrics.DeletionImageNotAllowed))
+	fg.Spec.Image = "docker.io/someone/app:1"
+	if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if err := cl.Get(context.Background(), key, &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected no pod for a rejected image, got err: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.PodDeletions.WithLabelValues(metrics.DeletionImageNotAllowed)) - deletions; got != 1 {
+		t.Fatalf("image deletions = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.PodRecreations.WithLabelValues(metrics.DeletionImageNotAllowed)); got != 0 {
+		t.Fatalf("a deleted pod counted as recreated %v times", got)
+	}
+	cond := meta.FindStatusCondition(fg.Status.Conditions, fgtechv1.ConditionPodHealthy)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "ImageNotAllowed" {
+		t.Fatalf("PodHealthy condition = %+v, want False/ImageNotAllowed", cond)
+	}
+}
+
+func derefOrNil(v *int64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func TestPodNeedsUpdateReasons(t *testing.T) {
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	settings := class.Settings{ServiceAccount: "default", Port: 8080}
+	for _, tc := range []struct {
+		name     string
+		recreate bool
+		mutate   func(p *corev1.Pod)
+		want     string
+	}{
+		{name: "up to date", mutate: func(p *corev1.Pod) {}, want: ""},
+		{name: "no container", mutate: func(p *corev1.Pod) { p.Spec.Containers = nil }, want: updateContainers},
+		{name: "image", mutate: func(p *corev1.Pod) { p.Spec.Containers[0].Image = "nginx:1.25" }, want: updateImage},
+		{name: "port", mutate: func(p *corev1.Pod) { p.Spec.Containers[0].Ports[0].ContainerPort = 9090 }, want: updatePort},
+		{name: "version label", mutate: func(p *corev1.Pod) { p.Labels["fgtech-version"] = "0.9.0" }, want: updateVersion},
+		{name: "service account", mutate: func(p *corev1.Pod) { p.Spec.ServiceAccountName = "other" }, want: updateServiceAccount},
+		{name: "class", mutate: func(p *corev1.Pod) { setAnnotation(p, classHashAnnotation, "stale") }, want: ""},
+		{name: "class rolled out", recreate: true, mutate: func(p *corev1.Pod) { setAnnotation(p, classHashAnnotation, "stale") }, want: updateClass},
+		{name: "class without previous hash", recreate: true, mutate: func(p *corev1.Pod) { delete(p.Annotations, classHashAnnotation) }, want: ""},
+		{name: "workload", mutate: func(p *corev1.Pod) { setAnnotation(p, workloadHashAnnotation, "stale") }, want: updateWorkload},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := settings
+			if tc.recreate {
+				settings.ClassName, settings.RecreatePods = "gpu", true
+			}
+			p := buildPod(fg, PodNameFor(fg), nil, settings)
+			tc.mutate(p)
+			if got := podNeedsUpdate(p, fg, settings); got != tc.want {
+				t.Fatalf("podNeedsUpdate = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEnsureRecordsLifecycleEvents(t *testing.T) {
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).Build()
+	recorder := record.NewFakeRecorder(10)
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}), WithRecorder(recorder))
+
+	ensure := func() {
+		t.Helper()
+		if _, err := mgr.Ensure(context.Background(), fg, logr.Discard()); err != nil {
+			t.Fatalf("Ensure returned error: %v", err)
+		}
+	}
+	ensure()
+	ensure()
+	fg.Spec.Image = "nginx:1.25"
+	ensure()
+
+	want := []string{
+		"Normal PodCreated pod demo-pod created",
+		"Normal ServiceCreated service demo-svc created",
+		"Normal PodRecreated pod demo-pod deleted to be recreated, image changed",
+	}
+	for _, w := range want {
+		select {
+		case ev := <-recorder.Events:
+			if ev != w {
+				t.Fatalf("event = %q, want %q", ev, w)
+			}
+		default:
+			t.Fatalf("missing event %q", w)
+		}
+	}
+}
+
+func TestEnsureRestartsPodOnRestartedAt(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fg := &fgtechv1.Fgtech{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       fgtechv1.FgtechSpec{Version: "1.0.0", Image: "nginx:latest"},
+	}
+	scheme := newPodScheme(t)
+	cl := fake.NewClientBuilder().WithScheme(scheme).Build()
+	recorder := record.NewFakeRecorder(10)
+	mgr := NewManager(cl, scheme, class.NewResolver(cl, class.Defaults{TTLSeconds: 3600, ServiceAccount: "default", Port: 8080}),
+		WithRecorder(recorder), WithClock(clocktesting.NewFakePassiveClock(now)))
+	restarts := testutil.ToFloat64(metrics.PodRecreations.WithLabelValues(updateRestart))
+	ensure := func() ctrl.Result {
+		t.Helper()
+		res, err := mgr.Ensure(context.Background(), fg, logr.Discard())
+		if err != nil {
+			t.Fatalf("Ensure returned error: %v", err)
+		}
+		return res
+	}
+	podKey := client.ObjectKey{Namespace: "default", Name: PodNameFor(fg)}
+
+	ensure()
+	fg.Annotations = map[string]string{fgtechv1.AnnotationRestartedAt: "2024-06-01T12:00:00Z"}
+	if res := ensure(); !res.Requeue {
+		t.Fatalf("expected a requeue after the restart, got %+v", res)
+	}
+	if err := cl.Get(context.Background(), podKey, &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the pod deleted, got err: %v", err)
+	}
+	if fg.Status.RestartedAt == nil || !fg.Status.RestartedAt.Time.Equal(now) {
+		t.Fatalf("status.restartedAt = %v, want %v", fg.Status.RestartedAt, now)
+	}
+
+	// The new Pod carries the value: no further restart, even once removed.
+	ensure()
+	var p corev1.Pod
+	if err := cl.Get(context.Background(), podKey, &p); err != nil {
+		t.Fatalf("pod not recreated: %v", err)
+	}
+	if p.Annotations[fgtechv1.AnnotationRestartedAt] != "2024-06-01T12:00:00Z" {
+		t.Fatalf("pod annotations = %v", p.Annotations)
+	}
+	ensure()
+	delete(fg.Annotations, fgtechv1.AnnotationRestartedAt)
+	ensure()
+	if got := testutil.ToFloat64(metrics.PodRecreations.WithLabelValues(updateRestart)) - restarts; got != 1 {
+		t.Fatalf("restarts = %v, want 1", got)
+	}
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	want := "Normal PodRestarted pod demo-pod deleted to be recreated, restart requested at 2024-06-01T12:00:00Z"
+	if !slices.Contains(events, want) {
+		t.Fatalf("events = %v, want %q", events, want)
+	}
+}
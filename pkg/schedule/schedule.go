@@ -0,0 +1,137 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	// Embedded zone database so time zones resolve in minimal images.
+	_ "time/tzdata"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	"github.com/robfig/cron/v3"
+)
+
+// lookbacks are the successive horizons searched for the last occurrence of a
+// cron expression; short ones keep frequent expressions cheap.
+var lookbacks = []time.Duration{time.Hour, 24 * time.Hour, 8 * 24 * time.Hour, 32 * 24 * time.Hour, 367 * 24 * time.Hour}
+
+// maxTransitionProbes bounds the events inspected when looking for the next
+// state change, so overlapping windows cannot loop forever.
+const maxTransitionProbes = 32
+
+// Schedule is a parsed ScheduleSpec.
+type Schedule struct {
+	loc     *time.Location
+	windows []window
+}
+
+type window struct {
+	up   cron.Schedule
+	down cron.Schedule
+}
+
+// Parse validates a ScheduleSpec and returns the matching Schedule.
+func Parse(spec *fgtechv1.ScheduleSpec) (*Schedule, error) {
+	if spec == nil || len(spec.Windows) == 0 {
+		return nil, fmt.Errorf("schedule has no window")
+	}
+	loc := time.UTC
+	if spec.TimeZone != "" {
+		l, err := time.LoadLocation(spec.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", spec.TimeZone, err)
+		}
+		loc = l
+	}
+
+	s := &Schedule{loc: loc}
+	for i, w := range spec.Windows {
+		up, err := cron.ParseStandard(w.Up)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: invalid up expression %q: %w", i, w.Up, err)
+		}
+		down, err := cron.ParseStandard(w.Down)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: invalid down expression %q: %w", i, w.Down, err)
+		}
+		s.windows = append(s.windows, window{up: up, down: down})
+	}
+	return s, nil
+}
+
+// ParseAnnotation decodes the JSON ScheduleSpec stored in a namespace annotation.
+func ParseAnnotation(v string) (*fgtechv1.ScheduleSpec, error) {
+	var spec fgtechv1.ScheduleSpec
+	if err := json.Unmarshal([]byte(v), &spec); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", fgtechv1.AnnotationSchedule, err)
+	}
+	return &spec, nil
+}
+
+// IsUp reports whether the workload should run at t.
+func (s *Schedule) IsUp(t time.Time) bool {
+	t = t.In(s.loc)
+	for _, w := range s.windows {
+		lastUp := lastAtOrBefore(w.up, t)
+		if lastUp.IsZero() {
+			continue
+		}
+		lastDown := lastAtOrBefore(w.down, t)
+		if lastDown.IsZero() || lastUp.After(lastDown) {
+			return true
+		}
+	}
+	return false
+}
+
+// State returns whether the workload should run at now and when that changes.
+// The returned time is zero when no change is found.
+func (s *Schedule) State(now time.Time) (bool, time.Time) {
+	up := s.IsUp(now)
+	t := now.In(s.loc)
+	for i := 0; i < maxTransitionProbes; i++ {
+		next := s.nextEvent(t)
+		if next.IsZero() {
+			break
+		}
+		if s.IsUp(next) != up {
+			return up, next
+		}
+		t = next
+	}
+	return up, time.Time{}
+}
+
+func (s *Schedule) nextEvent(t time.Time) time.Time {
+	var next time.Time
+	for _, w := range s.windows {
+		for _, c := range []cron.Schedule{w.up, w.down} {
+			n := c.Next(t)
+			if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+				next = n
+			}
+		}
+	}
+	return next
+}
+
+// lastAtOrBefore returns the latest activation of c at or before t, or zero
+// when none happened within the longest lookback.
+func lastAtOrBefore(c cron.Schedule, t time.Time) time.Time {
+	for _, lb := range lookbacks {
+		var last time.Time
+		// cron.Next is strictly after its argument, start one second earlier.
+		cur := t.Add(-lb - time.Second)
+		for {
+			n := c.Next(cur)
+			if n.IsZero() || n.After(t) {
+				break
+			}
+			last, cur = n, n
+		}
+		if !last.IsZero() {
+			return last
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,72 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+)
+
+func officeHours(t *testing.T) *Schedule {
+	t.Helper()
+	s, err := Parse(&fgtechv1.ScheduleSpec{
+		TimeZone: "Europe/Paris",
+		Windows:  []fgtechv1.ScheduleWindow{{Up: "0 8 * * 1-5", Down: "0 19 * * 1-5"}},
+	})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return s
+}
+
+func TestScheduleState(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	s := officeHours(t)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		wantUp   bool
+		wantNext time.Time
+	}{
+		{name: "monday morning", now: time.Date(2024, 6, 3, 10, 0, 0, 0, paris), wantUp: true, wantNext: time.Date(2024, 6, 3, 19, 0, 0, 0, paris)},
+		{name: "monday night", now: time.Date(2024, 6, 3, 22, 0, 0, 0, paris), wantUp: false, wantNext: time.Date(2024, 6, 4, 8, 0, 0, 0, paris)},
+		{name: "friday evening skips weekend", now: time.Date(2024, 6, 7, 20, 0, 0, 0, paris), wantUp: false, wantNext: time.Date(2024, 6, 10, 8, 0, 0, 0, paris)},
+		{name: "exactly at up time", now: time.Date(2024, 6, 4, 8, 0, 0, 0, paris), wantUp: true, wantNext: time.Date(2024, 6, 4, 19, 0, 0, 0, paris)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, next := s.State(tt.now)
+			if up != tt.wantUp || !next.Equal(tt.wantNext) {
+				t.Fatalf("State(%s) = %v, %s; want %v, %s", tt.now, up, next, tt.wantUp, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidSpecs(t *testing.T) {
+	specs := []*fgtechv1.ScheduleSpec{
+		nil,
+		{},
+		{TimeZone: "Mars/Olympus", Windows: []fgtechv1.ScheduleWindow{{Up: "0 8 * * *", Down: "0 19 * * *"}}},
+		{Windows: []fgtechv1.ScheduleWindow{{Up: "at eight", Down: "0 19 * * *"}}},
+	}
+	for i, spec := range specs {
+		if _, err := Parse(spec); err == nil {
+			t.Fatalf("spec %d: expected error", i)
+		}
+	}
+}
+
+func TestParseAnnotation(t *testing.T) {
+	spec, err := ParseAnnotation(`{"timeZone":"UTC","windows":[{"up":"0 8 * * *","down":"0 18 * * *"}]}`)
+	if err != nil {
+		t.Fatalf("ParseAnnotation: %v", err)
+	}
+	if len(spec.Windows) != 1 || spec.Windows[0].Down != "0 18 * * *" {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+}
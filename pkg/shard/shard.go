@@ -0,0 +1,303 @@
+// Package shard splits the watched namespaces between operator replicas.
+// Every replica holds a member Lease that it renews; the namespaces are
+// assigned to the members whose Lease is live by rendezvous hashing, so a
+// member joining or leaving only moves the namespaces it gains or held.
+//
+// Each Lease also publishes the members its holder currently assigns the
+// namespaces with. A namespace is only taken over once the live member that
+// held it publishes members giving it away, or its Lease expires: two
+// replicas never own a namespace at once, whatever their renewal order.
+package shard
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LabelGroup marks the member Leases; its value is Options.Group.
+const LabelGroup = "fgtech.io/shard-group"
+
+// AnnotationMembers on a member Lease lists, comma-separated, the members its
+// holder assigns the namespaces with.
+const AnnotationMembers = "fgtech.io/shard-members"
+
+// Defaults of Options.
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewPeriod   = 5 * time.Second
+)
+
+// Options configure a Membership.
+type Options struct {
+	// Namespace holds the member Leases.
+	Namespace string
+	// Group prefixes the Lease names; replicas of the same group share the
+	// namespaces.
+	Group string
+	// Identity names this replica, the pod name usually.
+	Identity string
+	// LeaseDuration is how long a member stays live without renewing its
+	// Lease; its namespaces then move to the other members.
+	LeaseDuration time.Duration
+	// RenewPeriod is how often the Lease is renewed and the members listed.
+	RenewPeriod time.Duration
+}
+
+// Membership keeps this replica's Lease and the live members of the group.
+// It implements manager.Runnable and runs on every replica.
+type Membership struct {
+	client client.Client
+	reader client.Reader
+	log    logr.Logger
+	opts   Options
+	clock  clock.WithTicker
+
+	mu      sync.RWMutex
+	members []string
+	// peers holds the members published by the other live members.
+	peers     map[string][]string
+	renewed   time.Time
+	listeners []func()
+}
+
+// New returns the membership of opts.Identity. Leases are written with c and
+// listed with r, an uncached reader: the manager cache does not watch Leases.
+func New(c client.Client, r client.Reader, log logr.Logger, opts Options) *Membership {
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = DefaultLeaseDuration
+	}
+	if opts.RenewPeriod <= 0 {
+		opts.RenewPeriod = DefaultRenewPeriod
+	}
+	return &Membership{client: c, reader: r, log: log, opts: opts, clock: clock.RealClock{}}
+}
+
+// Owns reports whether namespace belongs to this replica. Cluster-scoped
+// objects, with an empty namespace, belong to every replica; namespaced ones
+// to none until the first renewal. A namespace assigned to this replica is
+// not owned yet while another live member still publishes members assigning
+// it to itself.
+func (m *Membership) Owns(namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if Owner(m.members, namespace) != m.opts.Identity {
+		return false
+	}
+	for peer, members := range m.peers {
+		if Owner(members, namespace) == peer {
+			return false
+		}
+	}
+	return true
+}
+
+// Members returns the live members, sorted.
+func (m *Membership) Members() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.members)
+}
+
+// OnChange registers fn, called after every change of the members.
+func (m *Membership) OnChange(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Owner returns the member a namespace is assigned to, "" without members:
+// the one with the highest hash of member and namespace.
+func Owner(members []string, namespace string) string {
+	var owner string
+	var best uint64
+	for _, member := range members {
+		digest := sha256.Sum256([]byte(member + "\x00" + namespace))
+		if sum := binary.BigEndian.Uint64(digest[:8]); owner == "" || sum > best {
+			owner, best = member, sum
+		}
+	}
+	return owner
+}
+
+// Start implements manager.Runnable. The Lease is deleted on return so that
+// the other members take the namespaces over without waiting for it to
+// expire.
+func (m *Membership) Start(ctx context.Context) error {
+	ticker := m.clock.NewTicker(m.opts.RenewPeriod)
+	defer ticker.Stop()
+	defer m.leave()
+	for {
+		m.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (m *Membership) NeedLeaderElection() bool {
+	return false
+}
+
+// ReadinessCheck is a healthz.Checker failing while the Lease has not been
+// renewed within LeaseDuration, when this replica owns no namespace.
+func (m *Membership) ReadinessCheck(_ *http.Request) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.renewed.IsZero() {
+		return errors.New("shard lease not acquired yet")
+	}
+	if since := m.clock.Since(m.renewed); since > m.opts.LeaseDuration {
+		return fmt.Errorf("shard lease not renewed for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+// refresh lists the live members, then renews the Lease publishing them, and
+// only then assigns the namespaces with them. Once the Lease is older than
+// LeaseDuration the other members consider this one gone: it drops every
+// namespace until it renews again.
+func (m *Membership) refresh(ctx context.Context) {
+	now := m.clock.Now()
+	m.mu.RLock()
+	members, peers := m.members, m.peers
+	m.mu.RUnlock()
+	listed, listErr := m.live(ctx, now)
+	if listErr == nil {
+		peers = listed
+		members = []string{m.opts.Identity}
+		for peer := range peers {
+			members = append(members, peer)
+		}
+		slices.Sort(members)
+	}
+	renewErr := m.renew(ctx, now, members)
+
+	m.mu.Lock()
+	if renewErr == nil {
+		m.renewed = now
+	} else {
+		// The new members are not published: keep the current ones until
+		// the Lease expires.
+		members, peers = m.members, m.peers
+		if m.clock.Since(m.renewed) > m.opts.LeaseDuration {
+			members, peers = nil, nil
+		}
+	}
+	changed := !slices.Equal(members, m.members) || !maps.EqualFunc(peers, m.peers, slices.Equal[[]string])
+	m.members, m.peers = members, peers
+	listeners := slices.Clone(m.listeners)
+	m.mu.Unlock()
+
+	if err := errors.Join(renewErr, listErr); err != nil {
+		m.log.Error(err, "unable to refresh shard membership")
+	}
+	if changed {
+		m.log.Info("shard members changed", "members", members)
+		for _, fn := range listeners {
+			fn()
+		}
+	}
+}
+
+func (m *Membership) leaseKey(identity string) types.NamespacedName {
+	return types.NamespacedName{Namespace: m.opts.Namespace, Name: m.opts.Group + "-shard-" + identity}
+}
+
+// renew renews the Lease of this member, publishing members.
+func (m *Membership) renew(ctx context.Context, now time.Time, members []string) error {
+	key := m.leaseKey(m.opts.Identity)
+	renewTime := metav1.NewMicroTime(now)
+	published := strings.Join(members, ",")
+	var lease coordinationv1.Lease
+	if err := m.reader.Get(ctx, key, &lease); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		lease = coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        key.Name,
+				Namespace:   key.Namespace,
+				Labels:      map[string]string{LabelGroup: m.opts.Group},
+				Annotations: map[string]string{AnnotationMembers: published},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(m.opts.Identity),
+				LeaseDurationSeconds: ptr.To(int32(m.opts.LeaseDuration / time.Second)),
+				AcquireTime:          &renewTime,
+				RenewTime:            &renewTime,
+			},
+		}
+		return m.client.Create(ctx, &lease)
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[AnnotationMembers] = published
+	lease.Spec.HolderIdentity = ptr.To(m.opts.Identity)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(m.opts.LeaseDuration / time.Second))
+	lease.Spec.RenewTime = &renewTime
+	return m.client.Update(ctx, &lease)
+}
+
+// live returns the other members whose Lease has been renewed within its
+// duration, with the members each one publishes.
+func (m *Membership) live(ctx context.Context, now time.Time) (map[string][]string, error) {
+	var list coordinationv1.LeaseList
+	if err := m.reader.List(ctx, &list, client.InNamespace(m.opts.Namespace), client.MatchingLabels{LabelGroup: m.opts.Group}); err != nil {
+		return nil, err
+	}
+	peers := map[string][]string{}
+	for _, lease := range list.Items {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil || *spec.HolderIdentity == m.opts.Identity {
+			continue
+		}
+		expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+		if !now.Before(expiry) {
+			continue
+		}
+		var members []string
+		if v := lease.Annotations[AnnotationMembers]; v != "" {
+			members = strings.Split(v, ",")
+		}
+		peers[*spec.HolderIdentity] = members
+	}
+	return peers, nil
+}
+
+// leave deletes the Lease with a fresh context, the manager one being done.
+func (m *Membership) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.RenewPeriod)
+	defer cancel()
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: m.leaseKey(m.opts.Identity).Name, Namespace: m.opts.Namespace}}
+	if err := m.client.Delete(ctx, lease); err != nil && !apierrors.IsNotFound(err) {
+		m.log.Error(err, "unable to release shard lease")
+	}
+	m.mu.Lock()
+	m.members, m.peers = nil, nil
+	m.mu.Unlock()
+}
@@ -0,0 +1,162 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOwnerMovesOnlyTheNamespacesOfALeavingMember(t *testing.T) {
+	members := []string{"op-a", "op-b", "op-c"}
+	before := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		ns := fmt.Sprintf("team-%d", i)
+		before[ns] = Owner(members, ns)
+		counts[before[ns]]++
+	}
+	for _, m := range members {
+		if counts[m] < 60 {
+			t.Fatalf("member %s owns %d of 300 namespaces: %v", m, counts[m], counts)
+		}
+	}
+
+	for ns, owner := range before {
+		after := Owner([]string{"op-a", "op-c"}, ns)
+		if owner != "op-b" && after != owner {
+			t.Fatalf("namespace %s moved from %s to %s", ns, owner, after)
+		}
+	}
+	if got := Owner(nil, "team-1"); got != "" {
+		t.Fatalf("Owner without members = %q", got)
+	}
+}
+
+func newMember(cl client.Client, clk *clocktesting.FakeClock, identity string) *Membership {
+	m := New(cl, cl, logr.Discard(), Options{Namespace: "fgtech-system", Group: "fgtech-operator", Identity: identity})
+	m.clock = clk
+	return m
+}
+
+func TestMembershipFailover(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	clk := clocktesting.NewFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	a, b := newMember(cl, clk, "op-a"), newMember(cl, clk, "op-b")
+	changes := 0
+	a.OnChange(func() { changes++ })
+	ctx := context.Background()
+
+	if a.Owns("team-a") || a.ReadinessCheck(nil) == nil {
+		t.Fatalf("a member must own nothing and be unready before its first renewal")
+	}
+	a.refresh(ctx)
+	b.refresh(ctx)
+	a.refresh(ctx)
+	b.refresh(ctx)
+	if got := a.Members(); !slices.Equal(got, []string{"op-a", "op-b"}) {
+		t.Fatalf("members = %v", got)
+	}
+	if err := a.ReadinessCheck(nil); err != nil {
+		t.Fatalf("readiness after renewal: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		ns := fmt.Sprintf("team-%d", i)
+		if a.Owns(ns) == b.Owns(ns) {
+			t.Fatalf("namespace %s owned by both or neither member", ns)
+		}
+	}
+	if !a.Owns("") || !b.Owns("") {
+		t.Fatalf("cluster-scoped objects belong to every member")
+	}
+
+	// b stops renewing: once its Lease expires, a takes every namespace.
+	clk.Step(DefaultLeaseDuration + time.Second)
+	a.refresh(ctx)
+	if got := a.Members(); !slices.Equal(got, []string{"op-a"}) {
+		t.Fatalf("members after failover = %v", got)
+	}
+	for i := 0; i < 20; i++ {
+		if !a.Owns(fmt.Sprintf("team-%d", i)) {
+			t.Fatalf("team-%d not taken over", i)
+		}
+	}
+	// a alone, a and b, a alone again.
+	if changes != 3 {
+		t.Fatalf("OnChange called %d times, want 3", changes)
+	}
+
+	a.leave()
+	var leases coordinationv1.LeaseList
+	if err := cl.List(ctx, &leases); err != nil {
+		t.Fatalf("list leases: %v", err)
+	}
+	if len(leases.Items) != 1 || *leases.Items[0].Spec.HolderIdentity != "op-b" {
+		t.Fatalf("leases after leave: %+v", leases.Items)
+	}
+	if a.Owns("team-1") {
+		t.Fatalf("a member that left must own nothing")
+	}
+}
+
+func TestMembershipHandsNamespacesOver(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	clk := clocktesting.NewFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	a, b := newMember(cl, clk, "op-a"), newMember(cl, clk, "op-b")
+	ctx := context.Background()
+	namespaces := make([]string, 20)
+	for i := range namespaces {
+		namespaces[i] = fmt.Sprintf("team-%d", i)
+	}
+	owned := func(m *Membership) int {
+		n := 0
+		for _, ns := range namespaces {
+			if m.Owns(ns) {
+				n++
+			}
+		}
+		return n
+	}
+	checkDisjoint := func(step string) {
+		t.Helper()
+		for _, ns := range namespaces {
+			if a.Owns(ns) && b.Owns(ns) {
+				t.Fatalf("%s: namespace %s owned by both members", step, ns)
+			}
+		}
+	}
+
+	a.refresh(ctx)
+	if owned(a) != len(namespaces) {
+		t.Fatalf("a alone owns %d namespaces", owned(a))
+	}
+
+	// b joins: it waits for a to publish the new members before taking its share.
+	b.refresh(ctx)
+	checkDisjoint("b joined")
+	if owned(b) != 0 {
+		t.Fatalf("b took %d namespaces before a gave them up", owned(b))
+	}
+	a.refresh(ctx)
+	checkDisjoint("a gave up")
+	b.refresh(ctx)
+	checkDisjoint("b took over")
+	if owned(a)+owned(b) != len(namespaces) || owned(b) == 0 {
+		t.Fatalf("a owns %d, b owns %d of %d namespaces", owned(a), owned(b), len(namespaces))
+	}
+
+	// b leaves cleanly: a takes its namespaces back at once.
+	b.leave()
+	a.refresh(ctx)
+	if owned(a) != len(namespaces) {
+		t.Fatalf("a owns %d namespaces after b left", owned(a))
+	}
+}
@@ -0,0 +1,274 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ParameterError reports parameters that do not match the template declarations.
+type ParameterError struct {
+	Problems []string
+}
+
+func (e *ParameterError) Error() string {
+	return "invalid template parameters: " + strings.Join(e.Problems, "; ")
+}
+
+// Render checks params against the declarations of t and substitutes them in
+// its workload. It returns the rendered workload and the values used, defaults
+// included. Errors other than *ParameterError denote a broken template.
+func Render(t *fgtechv1.FgtechTemplate, params map[string]string) (*fgtechv1.WorkloadTemplate, map[string]string, error) {
+	values, err := resolveParameters(t.Spec.Parameters, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := json.Marshal(t.Spec.Template)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, nil, err
+	}
+	doc, err = substitute(doc, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	if raw, err = json.Marshal(doc); err != nil {
+		return nil, nil, err
+	}
+	var out fgtechv1.WorkloadTemplate
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, nil, fmt.Errorf("rendered template does not decode: %w", err)
+	}
+	numericPorts(out.ReadinessProbe)
+	numericPorts(out.LivenessProbe)
+	return &out, values, nil
+}
+
+// numericPorts turns probe ports rendered from a parameter into numbers:
+// named ports can't be numeric.
+func numericPorts(p *corev1.Probe) {
+	if p == nil {
+		return
+	}
+	for _, port := range []*intstr.IntOrString{httpPort(p.HTTPGet), tcpPort(p.TCPSocket)} {
+		if port == nil || port.Type != intstr.String {
+			continue
+		}
+		if n, err := strconv.Atoi(port.StrVal); err == nil {
+			*port = intstr.FromInt(n)
+		}
+	}
+}
+
+func httpPort(a *corev1.HTTPGetAction) *intstr.IntOrString {
+	if a == nil {
+		return nil
+	}
+	return &a.Port
+}
+
+func tcpPort(a *corev1.TCPSocketAction) *intstr.IntOrString {
+	if a == nil {
+		return nil
+	}
+	return &a.Port
+}
+
+func resolveParameters(decls []fgtechv1.TemplateParameter, params map[string]string) (map[string]string, error) {
+	var problems []string
+	declared := make(map[string]bool, len(decls))
+	values := make(map[string]string, len(decls))
+	for _, d := range decls {
+		declared[d.Name] = true
+		v, ok := params[d.Name]
+		if !ok {
+			if d.Default == nil {
+				problems = append(problems, fmt.Sprintf("%s is required", d.Name))
+				continue
+			}
+			v = *d.Default
+		}
+		switch parameterType(d) {
+		case fgtechv1.ParameterTypeInteger:
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be an integer, got %q", d.Name, v))
+				continue
+			}
+		case fgtechv1.ParameterTypeBoolean:
+			if _, err := strconv.ParseBool(v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be a boolean, got %q", d.Name, v))
+				continue
+			}
+		case fgtechv1.ParameterTypeString:
+		default:
+			return nil, fmt.Errorf("parameter %s has unknown type %q", d.Name, d.Type)
+		}
+		values[d.Name] = v
+	}
+
+	unknown := make([]string, 0)
+	for name := range params {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("%s is not declared", name))
+	}
+
+	if len(problems) > 0 {
+		return nil, &ParameterError{Problems: problems}
+	}
+	return values, nil
+}
+
+func parameterType(p fgtechv1.TemplateParameter) string {
+	if p.Type == "" {
+		return fgtechv1.ParameterTypeString
+	}
+	return p.Type
+}
+
+// substitute walks a decoded JSON document and expands ${name} references in
+// every string. $${ escapes a literal ${.
+func substitute(node interface{}, values map[string]string) (interface{}, error) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			out, err := substitute(child, values)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = out
+		}
+		return v, nil
+	case []interface{}:
+		for i, child := range v {
+			out, err := substitute(child, values)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = out
+		}
+		return v, nil
+	case string:
+		return expand(v, values)
+	}
+	return node, nil
+}
+
+func expand(s string, values map[string]string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 2
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated parameter reference in %q", s)
+		}
+		name := s[i+2 : i+end]
+		v, ok := values[name]
+		if !ok {
+			return "", fmt.Errorf("template references undeclared parameter %s", name)
+		}
+		b.WriteString(v)
+		i += end
+	}
+	return b.String(), nil
+}
+
+// Apply completes spec with a rendered workload. Fields set on the Fgtech
+// win; env vars, volumes and volume mounts are merged by name (mount path for
+// mounts), the Fgtech entries replacing the template ones.
+func Apply(spec fgtechv1.FgtechSpec, w *fgtechv1.WorkloadTemplate) fgtechv1.FgtechSpec {
+	out := *spec.DeepCopy()
+	if w == nil {
+		return out
+	}
+	w = w.DeepCopy()
+	if out.Image == "" {
+		out.Image = w.Image
+	}
+	if len(out.Command) == 0 {
+		out.Command = w.Command
+	}
+	if out.ReadinessProbe == nil {
+		out.ReadinessProbe = w.ReadinessProbe
+	}
+	if out.LivenessProbe == nil {
+		out.LivenessProbe = w.LivenessProbe
+	}
+	out.Env = mergeEnv(w.Env, out.Env)
+	out.Volumes = mergeVolumes(w.Volumes, out.Volumes)
+	out.VolumeMounts = mergeMounts(w.VolumeMounts, out.VolumeMounts)
+	return out
+}
+
+func mergeEnv(base, override []corev1.EnvVar) []corev1.EnvVar {
+	if len(base) == 0 {
+		return override
+	}
+	seen := make(map[string]bool, len(override))
+	for _, e := range override {
+		seen[e.Name] = true
+	}
+	out := make([]corev1.EnvVar, 0, len(base)+len(override))
+	for _, e := range base {
+		if !seen[e.Name] {
+			out = append(out, e)
+		}
+	}
+	return append(out, override...)
+}
+
+func mergeVolumes(base, override []corev1.Volume) []corev1.Volume {
+	if len(base) == 0 {
+		return override
+	}
+	seen := make(map[string]bool, len(override))
+	for _, v := range override {
+		seen[v.Name] = true
+	}
+	out := make([]corev1.Volume, 0, len(base)+len(override))
+	for _, v := range base {
+		if !seen[v.Name] {
+			out = append(out, v)
+		}
+	}
+	return append(out, override...)
+}
+
+func mergeMounts(base, override []corev1.VolumeMount) []corev1.VolumeMount {
+	if len(base) == 0 {
+		return override
+	}
+	seen := make(map[string]bool, len(override))
+	for _, m := range override {
+		seen[m.MountPath] = true
+	}
+	out := make([]corev1.VolumeMount, 0, len(base)+len(override))
+	for _, m := range base {
+		if !seen[m.MountPath] {
+			out = append(out, m)
+		}
+	}
+	return append(out, override...)
+}
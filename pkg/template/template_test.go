@@ -0,0 +1,131 @@
+package template
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	fgtechv1 "github.com/fgtech/ia/cursor/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newTemplate() *fgtechv1.FgtechTemplate {
+	port := "8080"
+	debug := "false"
+	return &fgtechv1.FgtechTemplate{
+		Spec: fgtechv1.FgtechTemplateSpec{
+			Parameters: []fgtechv1.TemplateParameter{
+				{Name: "tag"},
+				{Name: "port", Type: fgtechv1.ParameterTypeInteger, Default: &port},
+				{Name: "debug", Type: fgtechv1.ParameterTypeBoolean, Default: &debug},
+			},
+			Template: fgtechv1.WorkloadTemplate{
+				Image:   "ghcr.io/fgtech/notebook:${tag}",
+				Command: []string{"serve", "--port=${port}", "--debug=${debug}", "--literal=$${tag}"},
+				Env: []corev1.EnvVar{
+					{Name: "PORT", Value: "${port}"},
+					{Name: "MODE", Value: "template"},
+				},
+				ReadinessProbe: &corev1.Probe{
+					ProbeHandler: corev1.ProbeHandler{
+						HTTPGet: &corev1.HTTPGetAction{Path: "/health", Port: intstr.FromString("${port}")},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	rendered, values, err := Render(newTemplate(), map[string]string{"tag": "1.2", "port": "9000"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if rendered.Image != "ghcr.io/fgtech/notebook:1.2" {
+		t.Fatalf("image = %s", rendered.Image)
+	}
+	want := []string{"serve", "--port=9000", "--debug=false", "--literal=${tag}"}
+	if strings.Join(rendered.Command, " ") != strings.Join(want, " ") {
+		t.Fatalf("command = %v, want %v", rendered.Command, want)
+	}
+	if rendered.Env[0].Value != "9000" {
+		t.Fatalf("env PORT = %q, want 9000", rendered.Env[0].Value)
+	}
+	port := rendered.ReadinessProbe.HTTPGet.Port
+	if port.Type != intstr.Int || port.IntValue() != 9000 {
+		t.Fatalf("probe port = %+v, want the integer 9000", port)
+	}
+	if values["debug"] != "false" || values["tag"] != "1.2" {
+		t.Fatalf("values = %v", values)
+	}
+}
+
+func TestRenderRejectsInvalidParameters(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   string
+	}{
+		{name: "missing required", params: map[string]string{}, want: "tag is required"},
+		{name: "wrong integer", params: map[string]string{"tag": "1", "port": "http"}, want: "port must be an integer"},
+		{name: "wrong boolean", params: map[string]string{"tag": "1", "debug": "maybe"}, want: "debug must be a boolean"},
+		{name: "undeclared", params: map[string]string{"tag": "1", "replicas": "2"}, want: "replicas is not declared"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Render(newTemplate(), tt.params)
+			var perr *ParameterError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a ParameterError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %q, want it to mention %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderRejectsUndeclaredReference(t *testing.T) {
+	tmpl := newTemplate()
+	tmpl.Spec.Template.Image = "nginx:${version}"
+	_, _, err := Render(tmpl, map[string]string{"tag": "1"})
+	var perr *ParameterError
+	if err == nil || errors.As(err, &perr) {
+		t.Fatalf("expected a template error, got %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	rendered := &fgtechv1.WorkloadTemplate{
+		Image:   "ghcr.io/fgtech/notebook:1.2",
+		Command: []string{"serve"},
+		Env:     []corev1.EnvVar{{Name: "MODE", Value: "template"}, {Name: "PORT", Value: "8080"}},
+		Volumes: []corev1.Volume{{Name: "data"}},
+	}
+	spec := fgtechv1.FgtechSpec{
+		Version: "1.0.0",
+		Env:     []corev1.EnvVar{{Name: "MODE", Value: "instance"}},
+		Volumes: []corev1.Volume{{Name: "cache"}},
+	}
+
+	got := Apply(spec, rendered)
+	if got.Image != rendered.Image || len(got.Command) != 1 {
+		t.Fatalf("template fields not applied: %+v", got)
+	}
+	env := map[string]string{}
+	for _, e := range got.Env {
+		env[e.Name] = e.Value
+	}
+	if len(got.Env) != 2 || env["MODE"] != "instance" || env["PORT"] != "8080" {
+		t.Fatalf("env = %v, want the instance MODE and the template PORT", got.Env)
+	}
+	if len(got.Volumes) != 2 {
+		t.Fatalf("volumes = %v, want data and cache", got.Volumes)
+	}
+
+	spec.Image = "nginx:1.25"
+	if got := Apply(spec, rendered); got.Image != "nginx:1.25" {
+		t.Fatalf("image = %s, want the Fgtech image to win", got.Image)
+	}
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// AttrKind is the kind of the object an API call works on.
+const AttrKind = attribute.Key("k8s.kind")
+
+// Client wraps c so that every API call opens a span named after the verb,
+// such as "k8s.Get", with the kind, namespace and name of the object.
+func Client(c client.Client) client.Client {
+	return &tracedClient{Client: c}
+}
+
+type tracedClient struct {
+	client.Client
+}
+
+func (c *tracedClient) start(ctx context.Context, verb string, obj runtime.Object, namespace, name string) (context.Context, func(error)) {
+	attrs := append(Object(namespace, name), AttrKind.String(c.kind(obj)))
+	ctx, span := Start(ctx, "k8s."+verb, attrs...)
+	return ctx, func(err error) { End(span, "", err) }
+}
+
+func (c *tracedClient) kind(obj runtime.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return ""
+	}
+	return gvk.Kind
+}
+
+func (c *tracedClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) (err error) {
+	ctx, end := c.start(ctx, "Get", obj, key.Namespace, key.Name)
+	defer func() { end(err) }()
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *tracedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (err error) {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	ctx, end := c.start(ctx, "List", list, listOpts.Namespace, "")
+	defer func() { end(err) }()
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *tracedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) (err error) {
+	ctx, end := c.start(ctx, "Create", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { end(err) }()
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *tracedClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) (err error) {
+	ctx, end := c.start(ctx, "Update", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { end(err) }()
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *tracedClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) (err error) {
+	ctx, end := c.start(ctx, "Patch", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { end(err) }()
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *tracedClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) (err error) {
+	ctx, end := c.start(ctx, "Delete", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { end(err) }()
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *tracedClient) Status() client.SubResourceWriter {
+	return &tracedStatusWriter{SubResourceWriter: c.Client.Status(), c: c}
+}
+
+type tracedStatusWriter struct {
+	client.SubResourceWriter
+	c *tracedClient
+}
+
+func (w *tracedStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) (err error) {
+	ctx, end := w.c.start(ctx, "UpdateStatus", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { end(err) }()
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *tracedStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) (err error) {
+	ctx, end := w.c.start(ctx, "PatchStatus", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { end(err) }()
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
@@ -0,0 +1,141 @@
+// Package tracing sets up OpenTelemetry tracing and holds the helpers the
+// reconcilers and managers use to open spans.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Exporters accepted by Setup.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Span attribute keys.
+const (
+	AttrNamespace = attribute.Key("fgtech.namespace")
+	AttrName      = attribute.Key("fgtech.name")
+	AttrUID       = attribute.Key("fgtech.uid")
+	AttrOutcome   = attribute.Key("fgtech.outcome")
+	// AttrExpired counts the Fgtechs expired by a TTL sweep.
+	AttrExpired = attribute.Key("fgtech.expired")
+)
+
+// Outcomes recorded by End.
+const (
+	OutcomeSuccess = "success"
+	OutcomeRequeue = "requeue"
+	OutcomeError   = "error"
+)
+
+const (
+	instrumentationName = "github.com/fgtech/ia/cursor"
+	serviceName         = "fgtech-operator"
+)
+
+// Options select the span exporter.
+type Options struct {
+	// Exporter is none, stdout or otlp.
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector; empty falls back
+	// to OTEL_EXPORTER_OTLP_ENDPOINT, then localhost:4318.
+	Endpoint string
+	// Insecure sends OTLP spans over plain HTTP.
+	Insecure bool
+}
+
+// Setup installs the global tracer provider selected by opts. The returned
+// function flushes the pending spans; with ExporterNone nothing is installed
+// and spans are discarded.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start opens a span named name, child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Object returns the namespace and name attributes of an object.
+func Object(namespace, name string) []attribute.KeyValue {
+	return []attribute.KeyValue{AttrNamespace.String(namespace), AttrName.String(name)}
+}
+
+// Fgtech returns the namespace, name and UID attributes of a Fgtech.
+func Fgtech(obj metav1.Object) []attribute.KeyValue {
+	return append(Object(obj.GetNamespace(), obj.GetName()), AttrUID.String(string(obj.GetUID())))
+}
+
+// SetUID records the Fgtech UID on the span in ctx, telling the spans of an
+// instance apart from those of a Fgtech later recreated under the same name.
+func SetUID(ctx context.Context, uid types.UID) {
+	trace.SpanFromContext(ctx).SetAttributes(AttrUID.String(string(uid)))
+}
+
+// End records the outcome and error of span and ends it. An empty outcome
+// is derived from err.
+func End(span trace.Span, outcome string, err error) {
+	if err != nil {
+		outcome = OutcomeError
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if outcome == "" {
+		outcome = OutcomeSuccess
+	}
+	span.SetAttributes(AttrOutcome.String(outcome))
+	span.End()
+}
+
+// EndResult ends span like End, the outcome being a requeue when res asks for
+// one.
+func EndResult(span trace.Span, res ctrl.Result, err error) {
+	outcome := OutcomeSuccess
+	if res.Requeue || res.RequeueAfter > 0 {
+		outcome = OutcomeRequeue
+	}
+	End(span, outcome, err)
+}
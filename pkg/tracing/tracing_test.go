@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return sr
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSetup(t *testing.T) {
+	for _, exporter := range []string{"", ExporterNone} {
+		shutdown, err := Setup(context.Background(), Options{Exporter: exporter})
+		if err != nil {
+			t.Fatalf("Setup(%q): %v", exporter, err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+	}
+	if _, err := Setup(context.Background(), Options{Exporter: "jaeger"}); err == nil {
+		t.Fatalf("expected an error for an unknown exporter")
+	}
+}
+
+func TestEndRecordsOutcome(t *testing.T) {
+	sr := recordSpans(t)
+	for _, tc := range []struct {
+		name    string
+		res     ctrl.Result
+		err     error
+		outcome string
+		status  codes.Code
+	}{
+		{name: "done", outcome: OutcomeSuccess, status: codes.Unset},
+		{name: "requeue", res: ctrl.Result{RequeueAfter: 1}, outcome: OutcomeRequeue, status: codes.Unset},
+		{name: "failed", res: ctrl.Result{Requeue: true}, err: errors.New("boom"), outcome: OutcomeError, status: codes.Error},
+	} {
+		_, span := Start(context.Background(), tc.name)
+		EndResult(span, tc.res, tc.err)
+		ended := sr.Ended()
+		got := ended[len(ended)-1]
+		if got.Name() != tc.name || attr(got, AttrOutcome) != tc.outcome || got.Status().Code != tc.status {
+			t.Fatalf("%s: span %s outcome=%q status=%v, want outcome=%q status=%v",
+				tc.name, got.Name(), attr(got, AttrOutcome), got.Status().Code, tc.outcome, tc.status)
+		}
+	}
+}
+
+func TestSetUIDAnnotatesCurrentSpan(t *testing.T) {
+	sr := recordSpans(t)
+	ctx, span := Start(context.Background(), "Fgtech.Reconcile", Object("team-a", "demo")...)
+	SetUID(ctx, "1234")
+	End(span, "", nil)
+
+	got := sr.Ended()[0]
+	if attr(got, AttrNamespace) != "team-a" || attr(got, AttrName) != "demo" || attr(got, AttrUID) != "1234" {
+		t.Fatalf("unexpected attributes %v", got.Attributes())
+	}
+}
+
+func TestClientTracesAPICalls(t *testing.T) {
+	sr := recordSpans(t)
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client scheme: %v", err)
+	}
+	c := Client(fake.NewClientBuilder().WithScheme(scheme).Build())
+	ctx := context.Background()
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "team-a"}}
+	if err := c.Create(ctx, pod); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := c.List(ctx, &corev1.PodList{}, client.InNamespace("team-a")); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "team-a", Name: "missing"}, &corev1.Pod{}); err == nil {
+		t.Fatalf("expected a not found error")
+	}
+
+	ended := sr.Ended()
+	want := []struct{ name, kind, name2, outcome string }{
+		{"k8s.Create", "Pod", "demo", OutcomeSuccess},
+		{"k8s.List", "PodList", "", OutcomeSuccess},
+		{"k8s.Get", "Pod", "missing", OutcomeError},
+	}
+	if len(ended) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(ended), len(want))
+	}
+	for i, w := range want {
+		s := ended[i]
+		if s.Name() != w.name || attr(s, AttrKind) != w.kind || attr(s, AttrName) != w.name2 ||
+			attr(s, AttrNamespace) != "team-a" || attr(s, AttrOutcome) != w.outcome {
+			t.Fatalf("span %d: %s %v, want %+v", i, s.Name(), s.Attributes(), w)
+		}
+	}
+}